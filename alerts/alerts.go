@@ -0,0 +1,272 @@
+// Package alerts raises and clears alerts on the devices in a cache by checking them against rules.
+package alerts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/byuoitav/event-forwarding-microservice/cache/shared"
+	"github.com/byuoitav/event-forwarding-microservice/config"
+	"github.com/byuoitav/event-forwarding-microservice/events"
+	sd "github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
+	"github.com/byuoitav/event-forwarding-microservice/transform"
+)
+
+// Engine checks devices against a set of rules
+type Engine struct {
+	rules []rule
+}
+
+// Change is an alert that was raised or cleared on a device
+type Change struct {
+	DeviceID string `json:"deviceID"`
+	Alert    string `json:"alert"`
+	Alerting bool   `json:"alerting"`
+	Message  string `json:"message,omitempty"`
+}
+
+type rule struct {
+	config.AlertRule
+
+	// for during, how long after midnight the window starts and ends
+	start time.Duration
+	end   time.Duration
+}
+
+// New builds an engine from the rules in the config
+func New(rules []config.AlertRule) (*Engine, error) {
+	e := &Engine{}
+
+	for _, r := range rules {
+		compiled := rule{AlertRule: r}
+		if r.Type == config.ALERTSTALE && len(r.Field) == 0 {
+			compiled.Field = "last-heartbeat"
+		}
+
+		if r.Type == config.ALERTDURING {
+			var err error
+			if compiled.start, err = config.ParseTimeOfDay(r.Start); err != nil {
+				return nil, fmt.Errorf("couldn't build alert %v: %w", r.Name, err)
+			}
+			if compiled.end, err = config.ParseTimeOfDay(r.End); err != nil {
+				return nil, fmt.Errorf("couldn't build alert %v: %w", r.Name, err)
+			}
+		}
+
+		e.rules = append(e.rules, compiled)
+	}
+
+	return e, nil
+}
+
+// Check checks every device in c against the rules. Alerts that were raised or cleared are stored on the device,
+// and the devices that changed are sent to the device forwarders. It returns what changed.
+func (e *Engine) Check(c shared.Cache, now time.Time) ([]Change, error) {
+	devices, err := c.GetAllDeviceRecords()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get devices to check: %w", err)
+	}
+
+	rooms, err := c.GetAllRoomRecords()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get rooms to check: %w", err)
+	}
+
+	roomInfo := make(map[string]sd.StaticRoom, len(rooms))
+	for _, room := range rooms {
+		roomInfo[room.RoomID] = room
+	}
+
+	var changes []Change
+	var errs []error
+
+	for _, device := range devices {
+		room := roomInfo[events.GenerateBasicDeviceInfo(device.DeviceID).RoomID]
+
+		changed, err := e.checkDevice(c, device, room, now)
+		changes = append(changes, changed...)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return changes, errors.Join(errs...)
+}
+
+// Evaluate returns the changes to device's alerts the rules call for, without storing them.
+// Alerts that room suppresses, or all of them if the device's notifications are suppressed, are masked: they aren't raised, and are cleared if they were.
+func (e *Engine) Evaluate(device sd.StaticDevice, room sd.StaticRoom, now time.Time) []Change {
+	doc, err := transform.Chain{}.Apply(device)
+	if err != nil {
+		return nil
+	}
+
+	deviceType := device.DeviceType
+	if len(deviceType) == 0 {
+		deviceType = shared.GetDeviceTypeByID(device.DeviceID)
+	}
+
+	var changes []Change
+	for _, r := range e.rules {
+		if !r.appliesTo(deviceType) {
+			continue
+		}
+
+		alerting, message, ok := r.evaluate(doc, now)
+		if Suppressed(device, room, r.Name, now) {
+			alerting, message, ok = false, "suppressed", true
+		}
+
+		if !ok || device.Alerts[r.Name].Alerting == alerting {
+			continue
+		}
+
+		changes = append(changes, Change{
+			DeviceID: device.DeviceID,
+			Alert:    r.Name,
+			Alerting: alerting,
+			Message:  message,
+		})
+	}
+
+	return changes
+}
+
+// Suppressed returns true if the alert called name is masked on device, because its notifications are suppressed or its room suppresses the alert
+func Suppressed(device sd.StaticDevice, room sd.StaticRoom, name string, now time.Time) bool {
+	if device.NotificationsSuppressed != nil && *device.NotificationsSuppressed {
+		return true
+	}
+
+	return room.SuppressesAlert(name, now)
+}
+
+func (e *Engine) checkDevice(c shared.Cache, device sd.StaticDevice, room sd.StaticRoom, now time.Time) ([]Change, error) {
+	changes := e.Evaluate(device, room, now)
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	for _, change := range changes {
+		alert := sd.Alert{
+			Alerting: change.Alerting,
+			Message:  change.Message,
+		}
+
+		if change.Alerting {
+			alert.AlertSent = now
+		} else {
+			// keep when it was raised
+			alert.AlertSent = device.Alerts[change.Alert].AlertSent
+		}
+
+		_, updated, err := c.StoreDeviceEvent(sd.State{
+			ID:    device.DeviceID,
+			Key:   "alerts." + change.Alert,
+			Time:  now,
+			Value: alert,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("couldn't store alert %v on %v: %w", change.Alert, device.DeviceID, err)
+		}
+
+		device = updated
+	}
+
+	if err := shared.ForwardDevice(device, true, c); err != nil {
+		return changes, fmt.Errorf("couldn't forward alerts on %v: %w", device.DeviceID, err)
+	}
+
+	if len(room.RoomID) > 0 {
+		if _, err := shared.RefreshRoom(c, room.RoomID, now); err != nil {
+			return changes, err
+		}
+	}
+
+	return changes, nil
+}
+
+func (r rule) appliesTo(deviceType string) bool {
+	if len(r.DeviceTypes) == 0 {
+		return true
+	}
+
+	for _, t := range r.DeviceTypes {
+		if strings.EqualFold(t, deviceType) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// evaluate returns whether the rule's condition is true, and a message describing it.
+// ok is false if the device doesn't have the field the rule checks.
+func (r rule) evaluate(doc map[string]interface{}, now time.Time) (alerting bool, message string, ok bool) {
+	v, ok := transform.Get(doc, r.Field)
+	if !ok || v == nil {
+		return false, "", false
+	}
+
+	switch r.Type {
+	case config.ALERTSTALE:
+		s, isString := v.(string)
+		if !isString {
+			return false, "", false
+		}
+
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil || t.IsZero() {
+			return false, "", false
+		}
+
+		max := time.Duration(r.Minutes) * time.Minute
+		alerting = now.Sub(t) > max
+		message = fmt.Sprintf("%v was %v (alert after %v)", r.Field, t.Format(time.RFC3339), max)
+	case config.ALERTABOVE, config.ALERTBELOW:
+		n, isNumber := v.(json.Number)
+		if !isNumber {
+			return false, "", false
+		}
+
+		f, err := n.Float64()
+		if err != nil {
+			return false, "", false
+		}
+
+		if r.Type == config.ALERTABOVE {
+			alerting = f > r.Threshold
+		} else {
+			alerting = f < r.Threshold
+		}
+		message = fmt.Sprintf("%v is %v (alert %v %v)", r.Field, n, r.Type, r.Threshold)
+	case config.ALERTDURING:
+		alerting = strings.EqualFold(fmt.Sprint(v), r.Value) && r.inWindow(now)
+		message = fmt.Sprintf("%v is %v (alert if %v between %v and %v)", r.Field, v, r.Value, r.Start, r.End)
+	default:
+		return false, "", false
+	}
+
+	if len(r.Message) > 0 {
+		message = r.Message
+	}
+
+	return alerting, message, true
+}
+
+// inWindow returns true if now, in local time, is between the rule's start and end
+func (r rule) inWindow(now time.Time) bool {
+	now = now.Local()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	tod := now.Sub(midnight)
+
+	if r.start <= r.end {
+		return tod >= r.start && tod < r.end
+	}
+
+	// wraps past midnight
+	return tod >= r.start || tod < r.end
+}
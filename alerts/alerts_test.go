@@ -0,0 +1,145 @@
+package alerts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/byuoitav/event-forwarding-microservice/cache/memorycache"
+	"github.com/byuoitav/event-forwarding-microservice/cache/shared"
+	"github.com/byuoitav/event-forwarding-microservice/config"
+	sd "github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testCache(t *testing.T, devices ...sd.StaticDevice) *memorycache.Memorycache {
+	c, err := memorycache.MakeMemoryCache(devices, nil, "0 0 0 * * *", config.Cache{Name: "test"})
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func device(t *testing.T, id string) sd.StaticDevice {
+	d, err := shared.GetNewDevice(id)
+	require.NoError(t, err)
+	return d
+}
+
+func TestCheck(t *testing.T) {
+	now := time.Now()
+
+	cp := device(t, "ITB-1101-CP1")
+	cp.LastHeartbeat = now.Add(-20 * time.Minute)
+
+	display := device(t, "ITB-1101-D1")
+	display.LastHeartbeat = now.Add(-time.Minute)
+	lampHours := 2100
+	display.LampHours = &lampHours
+
+	// no heartbeat or lamp hours, so nothing to check
+	mic := device(t, "ITB-1101-MIC1")
+
+	c := testCache(t, cp, display, mic)
+
+	e, err := New([]config.AlertRule{
+		{Name: "lost-heartbeat", Type: config.ALERTSTALE, Minutes: 10},
+		{Name: "lamp-hours", Type: config.ALERTABOVE, Field: "lamp-hours", Threshold: 2000, DeviceTypes: []string{"display"}},
+	})
+	require.NoError(t, err)
+
+	changes, err := e.Check(c, now)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []Change{
+		{DeviceID: "ITB-1101-CP1", Alert: "lost-heartbeat", Alerting: true, Message: "last-heartbeat was " + cp.LastHeartbeat.Format(time.RFC3339) + " (alert after 10m0s)"},
+		{DeviceID: "ITB-1101-D1", Alert: "lamp-hours", Alerting: true, Message: "lamp-hours is 2100 (alert above 2000)"},
+	}, changes)
+
+	stored, err := c.GetDeviceRecord("ITB-1101-CP1")
+	require.NoError(t, err)
+	assert.True(t, stored.Alerts["lost-heartbeat"].Alerting)
+	assert.Equal(t, now, stored.Alerts["lost-heartbeat"].AlertSent)
+	require.NotNil(t, stored.Alerting)
+	assert.True(t, *stored.Alerting)
+
+	// already raised, so nothing changes
+	changes, err = e.Check(c, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+
+	// a heartbeat clears it
+	_, _, err = c.StoreDeviceEvent(sd.State{ID: "ITB-1101-CP1", Key: "last-heartbeat", Time: now.Add(2 * time.Minute), Value: now.Add(2 * time.Minute)})
+	require.NoError(t, err)
+
+	changes, err = e.Check(c, now.Add(3*time.Minute))
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.False(t, changes[0].Alerting)
+
+	stored, err = c.GetDeviceRecord("ITB-1101-CP1")
+	require.NoError(t, err)
+	assert.False(t, stored.Alerts["lost-heartbeat"].Alerting)
+	assert.Equal(t, now, stored.Alerts["lost-heartbeat"].AlertSent)
+	assert.False(t, *stored.Alerting)
+}
+
+func TestDuring(t *testing.T) {
+	e, err := New([]config.AlertRule{
+		{Name: "power-overnight", Type: config.ALERTDURING, Field: "power", Value: "on", Start: "22:00", End: "06:00"},
+	})
+	require.NoError(t, err)
+
+	d := device(t, "ITB-1101-D1")
+	d.Power = "on"
+
+	day := time.Date(2024, 1, 2, 15, 0, 0, 0, time.Local)
+	assert.Empty(t, e.Evaluate(d, sd.StaticRoom{}, day))
+
+	for _, hour := range []int{22, 23, 0, 5} {
+		night := time.Date(2024, 1, 2, hour, 30, 0, 0, time.Local)
+		changes := e.Evaluate(d, sd.StaticRoom{}, night)
+		require.Len(t, changes, 1, "hour %v", hour)
+		assert.True(t, changes[0].Alerting)
+	}
+
+	d.Power = "standby"
+	assert.Empty(t, e.Evaluate(d, sd.StaticRoom{}, time.Date(2024, 1, 2, 23, 0, 0, 0, time.Local)))
+}
+
+func TestSuppressed(t *testing.T) {
+	now := time.Date(2024, 1, 2, 12, 0, 0, 0, time.Local)
+	e, err := New([]config.AlertRule{
+		{Name: "lamp-hours", Type: config.ALERTABOVE, Field: "lamp-hours", Threshold: 2000},
+		{Name: "power-overnight", Type: config.ALERTDURING, Field: "power", Value: "on", Start: "00:00", End: "23:59"},
+	})
+	require.NoError(t, err)
+
+	d := device(t, "ITB-1101-D1")
+	lampHours := 2100
+	d.LampHours = &lampHours
+	d.Power = "on"
+
+	room := sd.StaticRoom{RoomID: "ITB-1101", AlertsToSupress: []string{"lamp-hours"}}
+	changes := e.Evaluate(d, room, now)
+	require.Len(t, changes, 1)
+	assert.Equal(t, "power-overnight", changes[0].Alert)
+
+	// maintenance mode masks everything, and clears what was raised
+	on := true
+	room.MaintenenceMode = &on
+	room.MaintenenceModeEndTime = now.Add(time.Hour)
+	d.Alerts = map[string]sd.Alert{"power-overnight": {Alerting: true}}
+
+	changes = e.Evaluate(d, room, now)
+	require.Len(t, changes, 1)
+	assert.Equal(t, Change{DeviceID: "ITB-1101-D1", Alert: "power-overnight", Message: "suppressed"}, changes[0])
+
+	// once it ends, power-overnight is already raised and lamp-hours is still suppressed
+	assert.Empty(t, e.Evaluate(d, room, now.Add(2*time.Hour)))
+
+	// a device's own suppression masks everything
+	d.NotificationsSuppressed = &on
+	room = sd.StaticRoom{RoomID: "ITB-1101"}
+	changes = e.Evaluate(d, room, now)
+	require.Len(t, changes, 1)
+	assert.False(t, changes[0].Alerting)
+}
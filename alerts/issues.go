@@ -0,0 +1,240 @@
+package alerts
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/byuoitav/event-forwarding-microservice/config"
+	"github.com/byuoitav/event-forwarding-microservice/events"
+	sd "github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
+	"github.com/byuoitav/event-forwarding-microservice/structs"
+)
+
+// AutoResolved is the resolution code of an issue that was resolved because all of its alerts cleared
+const AutoResolved = "auto-resolved"
+
+// Issues keeps an open room issue for each room that has alerting devices
+type Issues struct {
+	open map[string]*structs.RoomIssue
+}
+
+// NewIssues returns an empty set of issues
+func NewIssues() *Issues {
+	return &Issues{
+		open: make(map[string]*structs.RoomIssue),
+	}
+}
+
+// Seed adds issues that were left open, e.g. by a previous run, so they're resolved once their rooms stop alerting.
+// Resolved issues, and issues for rooms that already have one open, are skipped. It returns how many were added.
+func (s *Issues) Seed(open []structs.RoomIssue) int {
+	added := 0
+	for i := range open {
+		issue := open[i]
+		if issue.Resolved || len(issue.RoomID) == 0 {
+			continue
+		}
+
+		if _, ok := s.open[issue.RoomID]; ok {
+			continue
+		}
+
+		s.open[issue.RoomID] = &issue
+		added++
+	}
+
+	return added
+}
+
+// activeAlert is an alert that's currently raised on a device
+type activeAlert struct {
+	device sd.StaticDevice
+	name   string
+	alert  sd.Alert
+}
+
+// Update brings the issues in line with the alerts on devices. A room's issue is opened when the first of its devices
+// starts alerting and resolved once none of them are. Suppressed alerts don't count. Rules give the severity of each alert,
+// and rooms the tags, system type, and suppressed alerts of each room, either may be empty. It returns the issues that
+// changed, and every issue that was open.
+func (s *Issues) Update(devices []sd.StaticDevice, rooms []sd.StaticRoom, rules []config.AlertRule, now time.Time) (changed, all []structs.RoomIssue) {
+	roomInfo := make(map[string]sd.StaticRoom, len(rooms))
+	for _, room := range rooms {
+		roomInfo[room.RoomID] = room
+	}
+
+	byRoom := make(map[string][]activeAlert)
+	for _, device := range devices {
+		room := events.GenerateBasicDeviceInfo(device.DeviceID).RoomID
+		if len(room) == 0 {
+			continue
+		}
+
+		for name, alert := range device.Alerts {
+			if alert.Alerting && !Suppressed(device, roomInfo[room], name, now) {
+				byRoom[room] = append(byRoom[room], activeAlert{device: device, name: name, alert: alert})
+			}
+		}
+	}
+
+	severities := make(map[string]structs.AlertSeverity, len(rules))
+	for _, r := range rules {
+		if len(r.Severity) > 0 {
+			severities[r.Name] = structs.AlertSeverity(r.Severity)
+		}
+	}
+
+	for room, active := range byRoom {
+		issue, ok := s.open[room]
+		if !ok {
+			issue = newIssue(room, active, now)
+			s.open[room] = issue
+		}
+
+		if updateIssue(issue, active, roomInfo[room], severities, now) || !ok {
+			changed = append(changed, *issue)
+		}
+	}
+
+	for room, issue := range s.open {
+		if _, ok := byRoom[room]; ok {
+			all = append(all, *issue)
+			continue
+		}
+
+		updateIssue(issue, nil, roomInfo[room], severities, now)
+		issue.Resolved = true
+		issue.ResolutionInfo = structs.ResolutionInfo{
+			Code:       AutoResolved,
+			Notes:      "all alerts cleared",
+			ResolvedAt: now,
+		}
+
+		changed = append(changed, *issue)
+		all = append(all, *issue)
+		delete(s.open, room)
+	}
+
+	sortIssues(changed)
+	sortIssues(all)
+	return changed, all
+}
+
+// newIssue starts an issue for a room, starting when the oldest of its alerts was raised
+func newIssue(room string, active []activeAlert, now time.Time) *structs.RoomIssue {
+	start := now
+	for _, a := range active {
+		if !a.alert.AlertSent.IsZero() && a.alert.AlertSent.Before(start) {
+			start = a.alert.AlertSent
+		}
+	}
+
+	return &structs.RoomIssue{
+		// the ID comes from when it started so an issue keeps its ID across restarts
+		RoomIssueID:   fmt.Sprintf("%v-%v", room, start.Unix()),
+		BasicRoomInfo: events.GenerateBasicRoomInfo(room),
+	}
+}
+
+// updateIssue makes the issue's alerts match active, returning true if anything changed
+func updateIssue(issue *structs.RoomIssue, active []activeAlert, room sd.StaticRoom, severities map[string]structs.AlertSeverity, now time.Time) bool {
+	changed := false
+
+	sort.Slice(active, func(i, j int) bool {
+		if active[i].device.DeviceID != active[j].device.DeviceID {
+			return active[i].device.DeviceID < active[j].device.DeviceID
+		}
+		return active[i].name < active[j].name
+	})
+
+	raised := make(map[string]bool, len(active))
+	for _, a := range active {
+		id := alertID(a.device.DeviceID, a.name)
+		raised[id] = true
+
+		i := findAlert(issue.Alerts, id)
+		if i < 0 {
+			severity, ok := severities[a.name]
+			if !ok {
+				severity = structs.Warning
+			}
+
+			start := a.alert.AlertSent
+			if start.IsZero() {
+				start = now
+			}
+
+			issue.Alerts = append(issue.Alerts, structs.Alert{
+				BasicDeviceInfo:     events.GenerateBasicDeviceInfo(a.device.DeviceID),
+				AlertID:             id,
+				Type:                structs.AlertType(a.name),
+				Category:            structs.System,
+				Severity:            severity,
+				Message:             a.alert.Message,
+				AlertStartTime:      start,
+				AlertLastUpdateTime: now,
+				Active:              true,
+				DeviceTags:          a.device.Tags,
+			})
+			changed = true
+			continue
+		}
+
+		existing := &issue.Alerts[i]
+		if !existing.Active || existing.Message != a.alert.Message {
+			if existing.Message != a.alert.Message && len(existing.Message) > 0 {
+				existing.MessageLog = append(existing.MessageLog, existing.Message)
+			}
+
+			existing.Active = true
+			existing.Message = a.alert.Message
+			existing.AlertEndTime = time.Time{}
+			existing.AlertLastUpdateTime = now
+			changed = true
+		}
+	}
+
+	for i := range issue.Alerts {
+		if issue.Alerts[i].Active && !raised[issue.Alerts[i].AlertID] {
+			issue.Alerts[i].Active = false
+			issue.Alerts[i].AlertEndTime = now
+			issue.Alerts[i].AlertLastUpdateTime = now
+			changed = true
+		}
+	}
+
+	issue.RoomTags = room.Tags
+	issue.SystemType = ""
+	if len(room.SystemType) > 0 {
+		issue.SystemType = room.SystemType[0]
+	}
+	for i := range issue.Alerts {
+		issue.Alerts[i].RoomTags = room.Tags
+		issue.Alerts[i].SystemType = issue.SystemType
+	}
+
+	if changed {
+		issue.CalculateAggregateInfo()
+	}
+
+	return changed
+}
+
+// alertID identifies an alert on a device within an issue
+func alertID(deviceID, name string) string {
+	return deviceID + "^" + name
+}
+
+func findAlert(alerts []structs.Alert, id string) int {
+	for i := range alerts {
+		if alerts[i].AlertID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func sortIssues(issues []structs.RoomIssue) {
+	sort.Slice(issues, func(i, j int) bool { return issues[i].RoomIssueID < issues[j].RoomIssueID })
+}
@@ -0,0 +1,102 @@
+package alerts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/byuoitav/event-forwarding-microservice/config"
+	"github.com/byuoitav/event-forwarding-microservice/events"
+	sd "github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
+	"github.com/byuoitav/event-forwarding-microservice/structs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func alerting(t *testing.T, id string, raised time.Time, names ...string) sd.StaticDevice {
+	d := device(t, id)
+	d.Alerts = make(map[string]sd.Alert)
+	for _, name := range names {
+		d.Alerts[name] = sd.Alert{Alerting: true, AlertSent: raised, Message: name + " on " + id}
+	}
+	return d
+}
+
+func TestIssues(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	rules := []config.AlertRule{{Name: "lost-heartbeat", Severity: "Critical"}}
+	rooms := []sd.StaticRoom{{RoomID: "ITB-1101", SystemType: []string{sd.Pi}, Tags: []string{"classroom"}}}
+	issues := NewIssues()
+
+	// one issue for the room, no matter how many of its devices are alerting
+	changed, all := issues.Update([]sd.StaticDevice{
+		alerting(t, "ITB-1101-CP1", start, "lost-heartbeat"),
+		alerting(t, "ITB-1101-D1", start.Add(time.Minute), "lamp-hours"),
+		device(t, "ITB-1102-D1"),
+	}, rooms, rules, start.Add(2*time.Minute))
+
+	require.Len(t, changed, 1)
+	assert.Equal(t, all, changed)
+
+	issue := changed[0]
+	assert.Equal(t, "ITB-1101-1704164645", issue.RoomIssueID)
+	assert.Equal(t, "ITB", issue.BuildingID)
+	assert.Equal(t, sd.Pi, issue.SystemType)
+	assert.Equal(t, []string{"classroom"}, issue.RoomTags)
+	assert.Equal(t, 2, issue.AlertActiveCount)
+	assert.Equal(t, []string{"ITB-1101-CP1", "ITB-1101-D1"}, issue.ActiveAlertDevices)
+	assert.ElementsMatch(t, []structs.AlertSeverity{structs.Critical, structs.Warning}, issue.ActiveAlertSeverities)
+	assert.Equal(t, start, issue.Alerts[0].AlertStartTime)
+
+	// nothing changed
+	changed, all = issues.Update([]sd.StaticDevice{
+		alerting(t, "ITB-1101-CP1", start, "lost-heartbeat"),
+		alerting(t, "ITB-1101-D1", start.Add(time.Minute), "lamp-hours"),
+	}, rooms, rules, start.Add(3*time.Minute))
+	assert.Empty(t, changed)
+	assert.Len(t, all, 1)
+
+	// one of them cleared
+	changed, _ = issues.Update([]sd.StaticDevice{
+		alerting(t, "ITB-1101-CP1", start, "lost-heartbeat"),
+		device(t, "ITB-1101-D1"),
+	}, rooms, rules, start.Add(4*time.Minute))
+	require.Len(t, changed, 1)
+	assert.Equal(t, 1, changed[0].AlertActiveCount)
+	assert.Equal(t, 2, changed[0].AlertCount)
+	assert.Equal(t, start.Add(4*time.Minute), changed[0].Alerts[1].AlertEndTime)
+	assert.False(t, changed[0].Resolved)
+
+	// all of them cleared
+	changed, all = issues.Update([]sd.StaticDevice{device(t, "ITB-1101-CP1")}, rooms, rules, start.Add(5*time.Minute))
+	require.Len(t, changed, 1)
+	assert.Equal(t, all, changed)
+	assert.True(t, changed[0].Resolved)
+	assert.Equal(t, AutoResolved, changed[0].ResolutionInfo.Code)
+	assert.Equal(t, start.Add(5*time.Minute), changed[0].ResolutionInfo.ResolvedAt)
+	assert.Equal(t, 0, changed[0].AlertActiveCount)
+
+	// the next alert opens a new issue
+	changed, _ = issues.Update([]sd.StaticDevice{alerting(t, "ITB-1101-CP1", start.Add(time.Hour), "lost-heartbeat")}, rooms, rules, start.Add(time.Hour))
+	require.Len(t, changed, 1)
+	assert.NotEqual(t, issue.RoomIssueID, changed[0].RoomIssueID)
+	assert.False(t, changed[0].Resolved)
+}
+
+func TestSeedIssues(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	issues := NewIssues()
+
+	open := []structs.RoomIssue{
+		{RoomIssueID: "ITB-1101-1704164645", BasicRoomInfo: events.GenerateBasicRoomInfo("ITB-1101")},
+		{RoomIssueID: "ITB-1102-1704164645", BasicRoomInfo: events.GenerateBasicRoomInfo("ITB-1102"), Resolved: true},
+	}
+	assert.Equal(t, 1, issues.Seed(open))
+
+	// the room cleared while the service was down, so its issue is resolved on the first check
+	changed, all := issues.Update([]sd.StaticDevice{device(t, "ITB-1101-D1")}, nil, nil, start)
+	require.Len(t, changed, 1)
+	assert.Equal(t, all, changed)
+	assert.Equal(t, "ITB-1101-1704164645", changed[0].RoomIssueID)
+	assert.True(t, changed[0].Resolved)
+	assert.Equal(t, AutoResolved, changed[0].ResolutionInfo.Code)
+}
@@ -0,0 +1,234 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/byuoitav/event-forwarding-microservice/cache"
+	"github.com/byuoitav/event-forwarding-microservice/cache/shared"
+	"github.com/byuoitav/event-forwarding-microservice/config"
+	"github.com/byuoitav/event-forwarding-microservice/elk"
+	"github.com/byuoitav/event-forwarding-microservice/forwarding"
+	"github.com/byuoitav/event-forwarding-microservice/structs"
+)
+
+// idleInterval is how often Run looks at the config again while the engine is off
+const idleInterval = time.Minute
+
+// issues is the room issues built from each check's alerts
+var issues = NewIssues()
+
+// maxOpenIssues is the most open issues read from an issue index on startup
+const maxOpenIssues = 10000
+
+// Run checks the devices in the configured cache against the alert rules every interval until ctx is done.
+// The config is read again before each check, so reloads are picked up.
+func Run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	seeded := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		c := config.GetConfig()
+		if c.Alerts.Interval <= 0 || len(c.Alerts.Rules) == 0 {
+			timer.Reset(idleInterval)
+			continue
+		}
+
+		// issues left open by the last run are picked up first, so they're resolved if their rooms cleared while it was down
+		if !seeded {
+			seeded = seedIssues(c)
+		}
+
+		check(c)
+		timer.Reset(time.Duration(c.Alerts.Interval) * time.Second)
+	}
+}
+
+func check(c config.Config) {
+	name := c.Alerts.CacheName
+	if len(name) == 0 && len(c.Caches) > 0 {
+		name = c.Caches[0].Name
+	}
+
+	ca := cache.GetCache(name)
+	if ca == nil {
+		slog.Warn("Couldn't check alerts: cache not found", "cache", name)
+		return
+	}
+
+	e, err := New(c.Alerts.Rules)
+	if err != nil {
+		slog.Error("Couldn't check alerts", "error", err)
+		return
+	}
+
+	start := time.Now()
+	changes, err := e.Check(ca, start)
+	if err != nil {
+		slog.Warn("Problem checking alerts", "error", err)
+	}
+
+	for _, change := range changes {
+		slog.Info("Alert changed", "deviceID", change.DeviceID, "alert", change.Alert, "alerting", change.Alerting, "message", change.Message)
+	}
+
+	if err := updateIssues(ca, c.Alerts.Rules, start); err != nil {
+		slog.Warn("Problem updating room issues", "error", err)
+	}
+
+	slog.Debug("Checked alerts", "cache", name, "changes", len(changes), "took", time.Since(start))
+}
+
+// updateIssues rebuilds the room issues from the alerts on the devices in ca, and forwards them
+func updateIssues(ca shared.Cache, rules []config.AlertRule, now time.Time) error {
+	devices, err := ca.GetAllDeviceRecords()
+	if err != nil {
+		return fmt.Errorf("couldn't get devices: %w", err)
+	}
+
+	rooms, err := ca.GetAllRoomRecords()
+	if err != nil {
+		return fmt.Errorf("couldn't get rooms: %w", err)
+	}
+
+	changed, all := issues.Update(devices, rooms, rules, now)
+	for _, issue := range changed {
+		slog.Info("Room issue changed", "id", issue.RoomIssueID, "activeAlerts", issue.AlertActiveCount, "resolved", issue.Resolved)
+	}
+
+	ForwardIssues(changed, all)
+	return nil
+}
+
+// seedIssues adds the issues left open in the index of each elkstatic issue forwarder, returns false if any of them couldn't be read
+func seedIssues(c config.Config) bool {
+	var errs []error
+	for _, f := range c.Forwarders {
+		if f.Type != config.ELKSTATIC || f.DataType != config.ISSUE {
+			continue
+		}
+
+		open, err := openIssues(f.Elk)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("couldn't read open issues for %v: %w", f.Name, err))
+			continue
+		}
+
+		slog.Info("Loaded open room issues", "forwarder", f.Name, "issues", issues.Seed(open))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		slog.Warn("Problem loading open room issues, trying again next check", "error", err)
+		return false
+	}
+
+	return true
+}
+
+// openIssues reads the issues that haven't been resolved from an issue index, newest first.
+// With a rotating index an issue can be open in an old index and resolved in a newer one, those aren't returned.
+func openIssues(c config.ElkForwarder) ([]structs.RoomIssue, error) {
+	index := c.IndexPattern
+	if c.IndexRotationInterval != config.NOROTATE {
+		index += "-*"
+	}
+	url := fmt.Sprintf("%v/%v/_search", strings.TrimRight(c.URL, "/"), index)
+
+	open, err := searchIssues(url, map[string]interface{}{
+		"term": map[string]interface{}{"resolved": false},
+	}, maxOpenIssues)
+	if err != nil || len(open) == 0 {
+		return nil, err
+	}
+
+	ids := make([]string, len(open))
+	for i := range open {
+		ids[i] = open[i].RoomIssueID
+	}
+
+	resolved, err := searchIssues(url, map[string]interface{}{
+		"bool": map[string]interface{}{
+			"filter": []interface{}{
+				map[string]interface{}{"terms": map[string]interface{}{"_id": ids}},
+				map[string]interface{}{"term": map[string]interface{}{"resolved": true}},
+			},
+		},
+	}, len(ids))
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(map[string]bool, len(resolved))
+	for _, issue := range resolved {
+		done[issue.RoomIssueID] = true
+	}
+
+	var toReturn []structs.RoomIssue
+	for _, issue := range open {
+		if !done[issue.RoomIssueID] {
+			toReturn = append(toReturn, issue)
+		}
+	}
+
+	// IDs end in when the issue started, so the newest issue for a room is kept if it has more than one
+	sort.Slice(toReturn, func(i, j int) bool { return toReturn[i].RoomIssueID > toReturn[j].RoomIssueID })
+	return toReturn, nil
+}
+
+func searchIssues(url string, query map[string]interface{}, size int) ([]structs.RoomIssue, error) {
+	body, err := elk.MakeGenericELKRequestWithTimeout(url, http.MethodPost, elk.GenericQuery{Query: query, Size: size}, "", "", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp elk.RoomIssueQueryResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("couldn't parse issues: %w", err)
+	}
+
+	toReturn := make([]structs.RoomIssue, len(resp.Hits.Wrappers))
+	for i, w := range resp.Hits.Wrappers {
+		toReturn[i] = w.Alert
+		if len(toReturn[i].RoomIssueID) == 0 {
+			toReturn[i].RoomIssueID = w.ID
+		}
+	}
+
+	return toReturn, nil
+}
+
+// ForwardIssues sends the issues that changed to the delta issue forwarders, and every issue to the all issue forwarders.
+// all includes every open issue, so all forwarders are sent each open issue again after every check.
+func ForwardIssues(changed, all []structs.RoomIssue) {
+	list := forwarding.GetManagersForType(config.ISSUE, config.DELTA)
+	for i := range list {
+		for j := range changed {
+			if err := list[i].Send(changed[j]); err != nil {
+				slog.Warn("Problem sending room issue", "id", changed[j].RoomIssueID, "error", err)
+			}
+		}
+	}
+
+	list = forwarding.GetManagersForType(config.ISSUE, config.ALL)
+	for i := range list {
+		for j := range all {
+			if err := list[i].Send(all[j]); err != nil {
+				slog.Warn("Problem sending room issue", "id", all[j].RoomIssueID, "error", err)
+			}
+		}
+	}
+}
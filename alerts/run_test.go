@@ -0,0 +1,46 @@
+package alerts
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/byuoitav/event-forwarding-microservice/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenIssues(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/av-issues-*/_search", r.URL.Path)
+		body, _ := io.ReadAll(r.Body)
+
+		// what's open, then which of those were resolved in a newer index
+		if !strings.Contains(string(body), `"_id"`) {
+			w.Write([]byte(`{"hits": {"hits": [
+				{"_id": "ITB-1101-1704164645", "_source": {"id": "ITB-1101-1704164645", "roomID": "ITB-1101", "resolved": false}},
+				{"_id": "ITB-1101-1704160000", "_source": {"id": "ITB-1101-1704160000", "roomID": "ITB-1101", "resolved": false}},
+				{"_id": "ITB-1102-1704164645", "_source": {"roomID": "ITB-1102", "resolved": false}}
+			]}}`))
+			return
+		}
+
+		w.Write([]byte(`{"hits": {"hits": [
+			{"_id": "ITB-1102-1704164645", "_source": {"id": "ITB-1102-1704164645", "roomID": "ITB-1102", "resolved": true}}
+		]}}`))
+	}))
+	defer server.Close()
+
+	open, err := openIssues(config.ElkForwarder{URL: server.URL + "/", IndexPattern: "av-issues", IndexRotationInterval: config.DAILY})
+	require.NoError(t, err)
+	require.Len(t, open, 2)
+	assert.Equal(t, "ITB-1101-1704164645", open[0].RoomIssueID)
+	assert.Equal(t, "ITB-1101-1704160000", open[1].RoomIssueID)
+
+	// the newest issue for the room is the one kept open
+	s := NewIssues()
+	assert.Equal(t, 1, s.Seed(open))
+	assert.Equal(t, "ITB-1101-1704164645", s.open["ITB-1101"].RoomIssueID)
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errDisabled is the response to admin requests when there isn't a token to check them against
+var errDisabled = errors.New("admin endpoints are disabled, set an admin token to enable them")
+
+// RequireToken only lets through requests with an "Authorization: Bearer <token>" header.
+// If token is empty every request is refused, so admin endpoints are off unless a token is set.
+func RequireToken(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(token) == 0 {
+			c.AbortWithStatusJSON(http.StatusForbidden, errDisabled.Error())
+			return
+		}
+
+		auth := c.GetHeader("Authorization")
+		given, ok := strings.CutPrefix(auth, "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, "invalid or missing token")
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,173 @@
+// Package api has the handlers for reading and changing what's in the caches over HTTP.
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/byuoitav/event-forwarding-microservice/cache"
+	"github.com/byuoitav/event-forwarding-microservice/cache/shared"
+	sd "github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
+	"github.com/gin-gonic/gin"
+)
+
+// DeviceList is a page of devices
+type DeviceList struct {
+	Total   int               `json:"total"`
+	Offset  int               `json:"offset"`
+	Limit   int               `json:"limit"`
+	Devices []sd.StaticDevice `json:"devices"`
+}
+
+// RoomList is a page of rooms
+type RoomList struct {
+	Total  int             `json:"total"`
+	Offset int             `json:"offset"`
+	Limit  int             `json:"limit"`
+	Rooms  []sd.StaticRoom `json:"rooms"`
+}
+
+// getCache returns the cache named in the path, responding with a 404 if there isn't one
+func getCache(c *gin.Context) (shared.Cache, bool) {
+	ca := cache.GetCache(c.Param("name"))
+	if ca == nil {
+		c.JSON(http.StatusNotFound, fmt.Sprintf("cache %v not found", c.Param("name")))
+		return nil, false
+	}
+
+	return ca, true
+}
+
+// GetDevices responds with a page of the devices in a cache that match the query
+func GetDevices(c *gin.Context) {
+	ca, ok := getCache(c)
+	if !ok {
+		return
+	}
+
+	devices, err := ca.GetAllDeviceRecords()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondDevices(c, devices, "")
+}
+
+// GetDevice responds with a device in a cache
+func GetDevice(c *gin.Context) {
+	ca, ok := getCache(c)
+	if !ok {
+		return
+	}
+
+	device, err := ca.GetDeviceRecord(c.Param("id"))
+	switch {
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, err.Error())
+	case len(device.DeviceID) == 0:
+		c.JSON(http.StatusNotFound, fmt.Sprintf("device %v not found", c.Param("id")))
+	default:
+		c.JSON(http.StatusOK, device)
+	}
+}
+
+// GetRooms responds with a page of the rooms in a cache that match the query
+func GetRooms(c *gin.Context) {
+	ca, ok := getCache(c)
+	if !ok {
+		return
+	}
+
+	rooms, err := ca.GetAllRoomRecords()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	q, err := parseQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].RoomID < rooms[j].RoomID })
+
+	resp := RoomList{Offset: q.offset, Limit: q.limit, Rooms: []sd.StaticRoom{}}
+	for _, room := range rooms {
+		if !q.matchesRoom(room) {
+			continue
+		}
+
+		if resp.Total >= q.offset && len(resp.Rooms) < q.limit {
+			resp.Rooms = append(resp.Rooms, room)
+		}
+		resp.Total++
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetRoom responds with a room in a cache
+func GetRoom(c *gin.Context) {
+	ca, ok := getCache(c)
+	if !ok {
+		return
+	}
+
+	room, err := ca.GetRoomRecord(c.Param("id"))
+	switch {
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, err.Error())
+	case len(room.RoomID) == 0:
+		c.JSON(http.StatusNotFound, fmt.Sprintf("room %v not found", c.Param("id")))
+	default:
+		c.JSON(http.StatusOK, room)
+	}
+}
+
+// GetRoomDevices responds with a page of the devices in a room that match the query
+func GetRoomDevices(c *gin.Context) {
+	ca, ok := getCache(c)
+	if !ok {
+		return
+	}
+
+	devices, err := ca.GetAllDeviceRecords()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondDevices(c, devices, c.Param("id"))
+}
+
+// respondDevices responds with the page of devices that match the query, limited to devices in room if it isn't empty
+func respondDevices(c *gin.Context, devices []sd.StaticDevice, room string) {
+	q, err := parseQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if len(room) > 0 {
+		q.rooms = []string{room}
+	}
+
+	sort.Slice(devices, func(i, j int) bool { return devices[i].DeviceID < devices[j].DeviceID })
+
+	resp := DeviceList{Offset: q.offset, Limit: q.limit, Devices: []sd.StaticDevice{}}
+	for _, device := range devices {
+		if !q.matchesDevice(device) {
+			continue
+		}
+
+		if resp.Total >= q.offset && len(resp.Devices) < q.limit {
+			resp.Devices = append(resp.Devices, device)
+		}
+		resp.Total++
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/byuoitav/event-forwarding-microservice/cache"
+	"github.com/byuoitav/event-forwarding-microservice/cache/memorycache"
+	"github.com/byuoitav/event-forwarding-microservice/cache/shared"
+	"github.com/byuoitav/event-forwarding-microservice/config"
+	sd "github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testRouter(t *testing.T) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	devices := []sd.StaticDevice{}
+	for _, id := range []string{"ITB-1101-D1", "ITB-1101-CP1", "ITB-1102-D1", "JFSB-B100-D1"} {
+		device, err := shared.GetNewDevice(id)
+		require.NoError(t, err)
+		devices = append(devices, device)
+	}
+	devices[0].Power = "on"
+	devices[2].Power = "standby"
+
+	rooms := []sd.StaticRoom{}
+	for _, id := range []string{"ITB-1101", "ITB-1102", "JFSB-B100"} {
+		room, err := shared.GetNewRoom(id)
+		require.NoError(t, err)
+		rooms = append(rooms, room)
+	}
+
+	c, err := memorycache.MakeMemoryCache(devices, rooms, "0 0 0 * * *", config.Cache{Name: "test"})
+	require.NoError(t, err)
+
+	// don't load the caches from the config
+	cache.ApplyConfig(config.Config{})
+	cache.Caches["test"] = c
+	t.Cleanup(func() {
+		delete(cache.Caches, "test")
+		c.Close()
+	})
+
+	router := gin.New()
+	router.GET("/cache/:name/devices", GetDevices)
+	router.GET("/cache/:name/devices/:id", GetDevice)
+	router.GET("/cache/:name/rooms", GetRooms)
+	router.GET("/cache/:name/rooms/:id", GetRoom)
+	router.GET("/cache/:name/rooms/:id/devices", GetRoomDevices)
+	return router
+}
+
+func get(t *testing.T, router *gin.Engine, url string, v interface{}) int {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+
+	if v != nil && w.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), v))
+	}
+	return w.Code
+}
+
+func deviceIDs(l DeviceList) []string {
+	var ids []string
+	for _, d := range l.Devices {
+		ids = append(ids, d.DeviceID)
+	}
+	return ids
+}
+
+func TestGetDevices(t *testing.T) {
+	router := testRouter(t)
+
+	var l DeviceList
+	assert.Equal(t, http.StatusOK, get(t, router, "/cache/test/devices", &l))
+	assert.Equal(t, 4, l.Total)
+	assert.Equal(t, []string{"ITB-1101-CP1", "ITB-1101-D1", "ITB-1102-D1", "JFSB-B100-D1"}, deviceIDs(l))
+
+	l = DeviceList{}
+	get(t, router, "/cache/test/devices?building=itb&type=display", &l)
+	assert.Equal(t, []string{"ITB-1101-D1", "ITB-1102-D1"}, deviceIDs(l))
+
+	l = DeviceList{}
+	get(t, router, "/cache/test/devices?power=on&power=standby", &l)
+	assert.Equal(t, []string{"ITB-1101-D1", "ITB-1102-D1"}, deviceIDs(l))
+
+	l = DeviceList{}
+	get(t, router, "/cache/test/devices?limit=2&offset=1", &l)
+	assert.Equal(t, 4, l.Total)
+	assert.Equal(t, []string{"ITB-1101-D1", "ITB-1102-D1"}, deviceIDs(l))
+
+	l = DeviceList{}
+	get(t, router, "/cache/test/rooms/ITB-1101/devices", &l)
+	assert.Equal(t, []string{"ITB-1101-CP1", "ITB-1101-D1"}, deviceIDs(l))
+
+	var d sd.StaticDevice
+	assert.Equal(t, http.StatusOK, get(t, router, "/cache/test/devices/ITB-1101-D1", &d))
+	assert.Equal(t, "on", d.Power)
+
+	assert.Equal(t, http.StatusNotFound, get(t, router, "/cache/test/devices/ITB-1101-D2", nil))
+	assert.Equal(t, http.StatusNotFound, get(t, router, "/cache/legacy/devices", nil))
+	assert.Equal(t, http.StatusBadRequest, get(t, router, "/cache/test/devices?limit=0", nil))
+}
+
+func TestGetRooms(t *testing.T) {
+	router := testRouter(t)
+
+	var l RoomList
+	assert.Equal(t, http.StatusOK, get(t, router, "/cache/test/rooms?building=ITB", &l))
+	assert.Equal(t, 2, l.Total)
+	require.Len(t, l.Rooms, 2)
+	assert.Equal(t, "ITB-1101", l.Rooms[0].RoomID)
+
+	var r sd.StaticRoom
+	assert.Equal(t, http.StatusOK, get(t, router, "/cache/test/rooms/JFSB-B100", &r))
+	assert.Equal(t, "JFSB-B100", r.RoomID)
+
+	assert.Equal(t, http.StatusNotFound, get(t, router, "/cache/test/rooms/JFSB-B101", nil))
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/byuoitav/event-forwarding-microservice/cache/shared"
+	"github.com/byuoitav/event-forwarding-microservice/events"
+	"github.com/byuoitav/event-forwarding-microservice/forwarding"
+	"github.com/gin-gonic/gin"
+)
+
+// DeleteResult is what was removed by a delete, and which forwarders the deletes were sent to
+type DeleteResult struct {
+	Room       string   `json:"room,omitempty"`
+	Devices    []string `json:"devices"`
+	Forwarders []string `json:"forwarders"`
+	Errors     []string `json:"errors,omitempty"`
+}
+
+// DeleteDevice removes a device from a cache, and sends a delete for it to the cache's static forwarders
+func DeleteDevice(c *gin.Context) {
+	ca, ok := getCache(c)
+	if !ok {
+		return
+	}
+
+	id := c.Param("id")
+	if err := ca.RemoveDevice(id); err != nil {
+		c.JSON(http.StatusInternalServerError, fmt.Sprintf("couldn't remove device %v: %v", id, err))
+		return
+	}
+
+	resp := DeleteResult{Devices: []string{id}}
+	resp.forward(forwarding.DeleteDevice(ca.GetCacheName(), id))
+
+	// the room's device count and alerting depend on the device
+	if room := events.GenerateBasicDeviceInfo(id).RoomID; len(room) > 0 {
+		if _, err := shared.RefreshRoom(ca, room, time.Now()); err != nil {
+			slog.Warn("couldn't refresh room after deleting device", "device", id, "error", err)
+		}
+	}
+
+	slog.Info("deleted device", "cache", ca.GetCacheName(), "device", id, "forwarders", resp.Forwarders)
+	resp.respond(c)
+}
+
+// NukeRoom removes a room and all of its devices from a cache, and sends a delete for each of them to the cache's static forwarders
+func NukeRoom(c *gin.Context) {
+	ca, ok := getCache(c)
+	if !ok {
+		return
+	}
+
+	id := c.Param("id")
+	devices, err := ca.NukeRoom(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, fmt.Sprintf("couldn't nuke room %v: %v", id, err))
+		return
+	}
+
+	resp := DeleteResult{Room: id, Devices: devices}
+	resp.forward(forwarding.DeleteRoom(ca.GetCacheName(), id))
+	for _, device := range devices {
+		resp.forward(forwarding.DeleteDevice(ca.GetCacheName(), device))
+	}
+
+	slog.Info("nuked room", "cache", ca.GetCacheName(), "room", id, "devices", len(devices), "forwarders", resp.Forwarders)
+	resp.respond(c)
+}
+
+// forward adds the forwarders a delete was sent to, and any errors sending it
+func (r *DeleteResult) forward(sent []string, err error) {
+	for _, name := range sent {
+		if !contains(r.Forwarders, name) {
+			r.Forwarders = append(r.Forwarders, name)
+		}
+	}
+
+	if err == nil {
+		return
+	}
+
+	// a joined error is reported as each of the errors
+	if errs, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range errs.Unwrap() {
+			r.Errors = append(r.Errors, e.Error())
+		}
+		return
+	}
+
+	r.Errors = append(r.Errors, err.Error())
+}
+
+// respond responds with the result, with a 502 if a forwarder couldn't take a delete.
+// the records are already gone from the cache at this point, so that's the only thing that failed.
+func (r *DeleteResult) respond(c *gin.Context) {
+	if r.Devices == nil {
+		r.Devices = []string{}
+	}
+	if r.Forwarders == nil {
+		r.Forwarders = []string{}
+	}
+
+	if len(r.Errors) > 0 {
+		slog.Warn("couldn't send every delete", "errors", r.Errors)
+		c.JSON(http.StatusBadGateway, r)
+		return
+	}
+
+	c.JSON(http.StatusOK, r)
+}
+
+func contains(l []string, s string) bool {
+	for i := range l {
+		if l[i] == s {
+			return true
+		}
+	}
+	return false
+}
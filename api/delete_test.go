@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/byuoitav/event-forwarding-microservice/config"
+	"github.com/byuoitav/event-forwarding-microservice/forwarding"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func adminRouter(t *testing.T, token string) *gin.Engine {
+	router := testRouter(t)
+
+	// no forwarders to send deletes to
+	forwarding.ApplyConfig(config.Config{})
+
+	admin := router.Group("", RequireToken(token))
+	admin.DELETE("/cache/:name/devices/:id", DeleteDevice)
+	admin.DELETE("/cache/:name/rooms/:id", NukeRoom)
+	return router
+}
+
+func del(t *testing.T, router *gin.Engine, url, token string, v interface{}) int {
+	req := httptest.NewRequest(http.MethodDelete, url, nil)
+	if len(token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if v != nil && w.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), v))
+	}
+	return w.Code
+}
+
+func TestRequireToken(t *testing.T) {
+	router := adminRouter(t, "secret")
+	assert.Equal(t, http.StatusUnauthorized, del(t, router, "/cache/test/devices/ITB-1101-D1", "", nil))
+	assert.Equal(t, http.StatusUnauthorized, del(t, router, "/cache/test/devices/ITB-1101-D1", "wrong", nil))
+	assert.Equal(t, http.StatusOK, get(t, router, "/cache/test/devices/ITB-1101-D1", nil))
+
+	router = adminRouter(t, "")
+	assert.Equal(t, http.StatusForbidden, del(t, router, "/cache/test/devices/ITB-1101-D1", "", nil))
+}
+
+func TestDeleteDevice(t *testing.T) {
+	router := adminRouter(t, "secret")
+
+	var r DeleteResult
+	assert.Equal(t, http.StatusOK, del(t, router, "/cache/test/devices/ITB-1101-D1", "secret", &r))
+	assert.Equal(t, []string{"ITB-1101-D1"}, r.Devices)
+	assert.Equal(t, []string{}, r.Forwarders)
+
+	assert.Equal(t, http.StatusNotFound, get(t, router, "/cache/test/devices/ITB-1101-D1", nil))
+	assert.Equal(t, http.StatusNotFound, del(t, router, "/cache/legacy/devices/ITB-1101-D1", "secret", nil))
+}
+
+func TestNukeRoom(t *testing.T) {
+	router := adminRouter(t, "secret")
+
+	var r DeleteResult
+	assert.Equal(t, http.StatusOK, del(t, router, "/cache/test/rooms/ITB-1101", "secret", &r))
+	assert.Equal(t, "ITB-1101", r.Room)
+	assert.ElementsMatch(t, []string{"ITB-1101-D1", "ITB-1101-CP1"}, r.Devices)
+
+	assert.Equal(t, http.StatusNotFound, get(t, router, "/cache/test/rooms/ITB-1101", nil))
+
+	var l DeviceList
+	get(t, router, "/cache/test/devices", &l)
+	assert.Equal(t, []string{"ITB-1102-D1", "JFSB-B100-D1"}, deviceIDs(l))
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/byuoitav/event-forwarding-microservice/cache/shared"
+	sd "github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
+	"github.com/gin-gonic/gin"
+)
+
+// MaintenanceRequest is the body of a request to put a room in maintenance mode
+type MaintenanceRequest struct {
+	// Until is when maintenance mode ends. Duration, e.g. 2h30m, can be given instead.
+	// If neither is set the room stays in maintenance mode until it's taken out.
+	Until    time.Time `json:"until"`
+	Duration string    `json:"duration"`
+
+	// AlertsToSuppress replaces the alerts suppressed in the room, if it's set
+	AlertsToSuppress []string `json:"alerts-to-suppress"`
+}
+
+// SetMaintenance puts a room in a cache in maintenance mode
+func SetMaintenance(c *gin.Context) {
+	ca, room, ok := getRoom(c)
+	if !ok {
+		return
+	}
+
+	var req MaintenanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, fmt.Sprintf("invalid maintenance request: %v", err))
+		return
+	}
+
+	now := time.Now()
+	w := shared.MaintenanceWindow{
+		Until:            req.Until,
+		AlertsToSuppress: req.AlertsToSuppress,
+	}
+
+	if len(req.Duration) > 0 {
+		if !req.Until.IsZero() {
+			c.JSON(http.StatusBadRequest, "only one of until and duration can be set")
+			return
+		}
+
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			c.JSON(http.StatusBadRequest, fmt.Sprintf("invalid duration %q", req.Duration))
+			return
+		}
+		w.Until = now.Add(d)
+	}
+
+	if !w.Until.IsZero() && !w.Until.After(now) {
+		c.JSON(http.StatusBadRequest, "until must be in the future")
+		return
+	}
+
+	updated, err := shared.SetMaintenance(ca, room.RoomID, w, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	slog.Info("set maintenance mode", "cache", ca.GetCacheName(), "room", room.RoomID, "until", w.Until, "alertsToSuppress", updated.AlertsToSupress)
+	c.JSON(http.StatusOK, updated)
+}
+
+// EndMaintenance takes a room in a cache out of maintenance mode
+func EndMaintenance(c *gin.Context) {
+	ca, room, ok := getRoom(c)
+	if !ok {
+		return
+	}
+
+	updated, err := shared.EndMaintenance(ca, room.RoomID, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	slog.Info("ended maintenance mode", "cache", ca.GetCacheName(), "room", room.RoomID)
+	c.JSON(http.StatusOK, updated)
+}
+
+// getRoom returns the cache and room named in the path, responding with a 404 if either doesn't exist
+func getRoom(c *gin.Context) (shared.Cache, sd.StaticRoom, bool) {
+	ca, ok := getCache(c)
+	if !ok {
+		return nil, sd.StaticRoom{}, false
+	}
+
+	room, err := ca.GetRoomRecord(c.Param("id"))
+	switch {
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, err.Error())
+		return nil, sd.StaticRoom{}, false
+	case len(room.RoomID) == 0:
+		c.JSON(http.StatusNotFound, fmt.Sprintf("room %v not found", c.Param("id")))
+		return nil, sd.StaticRoom{}, false
+	}
+
+	return ca, room, true
+}
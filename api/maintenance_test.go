@@ -0,0 +1,117 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/byuoitav/event-forwarding-microservice/cache"
+	"github.com/byuoitav/event-forwarding-microservice/cache/shared"
+	sd "github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func maintenanceRouter(t *testing.T) *gin.Engine {
+	router := adminRouter(t, "secret")
+
+	admin := router.Group("", RequireToken("secret"))
+	admin.PUT("/cache/:name/rooms/:id/maintenance", SetMaintenance)
+	admin.DELETE("/cache/:name/rooms/:id/maintenance", EndMaintenance)
+	return router
+}
+
+func put(t *testing.T, router *gin.Engine, url, body string, v interface{}) int {
+	req := httptest.NewRequest(http.MethodPut, url, bytes.NewBufferString(body))
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if v != nil && w.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), v))
+	}
+	return w.Code
+}
+
+func TestMaintenance(t *testing.T) {
+	router := maintenanceRouter(t)
+
+	var room sd.StaticRoom
+	assert.Equal(t, http.StatusOK, put(t, router, "/cache/test/rooms/ITB-1101/maintenance", `{"duration": "2h", "alerts-to-suppress": ["lamp-hours"]}`, &room))
+	require.NotNil(t, room.MaintenenceMode)
+	assert.True(t, *room.MaintenenceMode)
+	assert.False(t, *room.Monitoring)
+	assert.WithinDuration(t, time.Now().Add(2*time.Hour), room.MaintenenceModeEndTime, time.Minute)
+	assert.Equal(t, []string{"lamp-hours"}, room.AlertsToSupress)
+	assert.True(t, room.InMaintenance(time.Now()))
+
+	assert.Equal(t, http.StatusBadRequest, put(t, router, "/cache/test/rooms/ITB-1101/maintenance", `{"duration": "soon"}`, nil))
+	assert.Equal(t, http.StatusBadRequest, put(t, router, "/cache/test/rooms/ITB-1101/maintenance", `{"until": "2001-01-01T00:00:00Z"}`, nil))
+	assert.Equal(t, http.StatusNotFound, put(t, router, "/cache/test/rooms/ITB-1199/maintenance", `{}`, nil))
+
+	room = sd.StaticRoom{}
+	assert.Equal(t, http.StatusOK, del(t, router, "/cache/test/rooms/ITB-1101/maintenance", "secret", &room))
+	assert.False(t, *room.MaintenenceMode)
+	assert.True(t, *room.Monitoring)
+
+	// suppressed alerts stay after maintenance mode ends
+	assert.Equal(t, []string{"lamp-hours"}, room.AlertsToSupress)
+}
+
+func TestExpireMaintenance(t *testing.T) {
+	maintenanceRouter(t)
+	c := cache.GetCache("test")
+
+	now := time.Now()
+	_, err := shared.SetMaintenance(c, "ITB-1101", shared.MaintenanceWindow{Until: now.Add(time.Hour)}, now)
+	require.NoError(t, err)
+	_, err = shared.SetMaintenance(c, "ITB-1102", shared.MaintenanceWindow{Until: now.Add(2 * time.Hour)}, now)
+	require.NoError(t, err)
+
+	expired, err := shared.ExpireMaintenance(c, now.Add(90*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ITB-1101"}, expired)
+
+	room, err := c.GetRoomRecord("ITB-1101")
+	require.NoError(t, err)
+	assert.False(t, room.InMaintenance(now))
+
+	room, err = c.GetRoomRecord("ITB-1102")
+	require.NoError(t, err)
+	assert.True(t, room.InMaintenance(now))
+}
+
+func TestMaintenanceWithoutEnd(t *testing.T) {
+	maintenanceRouter(t)
+	c := cache.GetCache("test")
+
+	now := time.Now()
+	_, err := shared.SetMaintenance(c, "ITB-1101", shared.MaintenanceWindow{Until: now.Add(time.Hour)}, now)
+	require.NoError(t, err)
+	_, err = shared.SetMaintenance(c, "ITB-1102", shared.MaintenanceWindow{Until: now.Add(3 * time.Hour)}, now)
+	require.NoError(t, err)
+
+	// leaving out the end time clears the old one, whether it's passed or not
+	later := now.Add(2 * time.Hour)
+	for _, id := range []string{"ITB-1101", "ITB-1102"} {
+		room, err := shared.SetMaintenance(c, id, shared.MaintenanceWindow{}, later)
+		require.NoError(t, err)
+		assert.True(t, room.MaintenenceModeEndTime.IsZero())
+	}
+
+	expired, err := shared.ExpireMaintenance(c, now.Add(4*time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, expired)
+
+	for _, id := range []string{"ITB-1101", "ITB-1102"} {
+		room, err := c.GetRoomRecord(id)
+		require.NoError(t, err)
+		assert.True(t, room.InMaintenance(now.Add(24*time.Hour)), id)
+	}
+}
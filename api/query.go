@@ -0,0 +1,164 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/byuoitav/event-forwarding-microservice/cache/shared"
+	sd "github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
+	"github.com/byuoitav/event-forwarding-microservice/transform"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+// query is what a list request is filtered and paged by.
+// Any query parameter that isn't one of the named ones is a field in the record to match, e.g. ?power=on.
+type query struct {
+	buildings   []string
+	rooms       []string
+	deviceTypes []string
+	fields      map[string][]string
+
+	offset int
+	limit  int
+}
+
+func parseQuery(c *gin.Context) (query, error) {
+	q := query{
+		fields: make(map[string][]string),
+		limit:  defaultLimit,
+	}
+
+	for key, vals := range c.Request.URL.Query() {
+		switch key {
+		case "building":
+			q.buildings = vals
+		case "room":
+			q.rooms = vals
+		case "type":
+			q.deviceTypes = vals
+		case "offset":
+			offset, err := strconv.Atoi(vals[0])
+			if err != nil || offset < 0 {
+				return q, fmt.Errorf("invalid offset %q", vals[0])
+			}
+			q.offset = offset
+		case "limit":
+			limit, err := strconv.Atoi(vals[0])
+			if err != nil || limit < 1 || limit > maxLimit {
+				return q, fmt.Errorf("invalid limit %q, must be between 1 and %v", vals[0], maxLimit)
+			}
+			q.limit = limit
+		default:
+			q.fields[key] = vals
+		}
+	}
+
+	return q, nil
+}
+
+func (q query) matchesDevice(device sd.StaticDevice) bool {
+	deviceType := device.DeviceType
+	if len(deviceType) == 0 {
+		deviceType = shared.GetDeviceTypeByID(device.DeviceID)
+	}
+
+	if !anyEqual(q.buildings, device.Building) || !anyEqual(q.rooms, device.Room) || !anyEqual(q.deviceTypes, deviceType) {
+		return false
+	}
+
+	return q.matchesFields(device)
+}
+
+func (q query) matchesRoom(room sd.StaticRoom) bool {
+	building := room.BuildingID
+	if len(building) == 0 {
+		building = transform.BuildingFromID(room.RoomID)
+	}
+
+	if !anyEqual(q.buildings, building) || !anyEqual(q.rooms, room.RoomID) {
+		return false
+	}
+
+	return q.matchesFields(room)
+}
+
+// matchesFields returns true if every field in the query has one of its values in the record
+func (q query) matchesFields(record interface{}) bool {
+	if len(q.fields) == 0 {
+		return true
+	}
+
+	b, err := json.Marshal(record)
+	if err != nil {
+		return false
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var doc map[string]interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return false
+	}
+
+	for field, vals := range q.fields {
+		if !anyEqual(vals, values(doc, field)...) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// values returns the values at a dotted path in doc as strings, with a value for each item if it's a list
+func values(doc map[string]interface{}, path string) []string {
+	var cur interface{} = doc
+	for _, p := range strings.Split(path, ".") {
+		obj, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		if cur, ok = obj[p]; !ok {
+			return nil
+		}
+	}
+
+	switch v := cur.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		var toReturn []string
+		for i := range v {
+			toReturn = append(toReturn, fmt.Sprint(v[i]))
+		}
+		return toReturn
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
+
+// anyEqual returns true if want is empty, or if any of have is in want, ignoring case
+func anyEqual(want []string, have ...string) bool {
+	if len(want) == 0 {
+		return true
+	}
+
+	for _, w := range want {
+		for _, h := range have {
+			if strings.EqualFold(w, h) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
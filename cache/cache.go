@@ -5,16 +5,44 @@ import (
 	"sync"
 
 	"github.com/byuoitav/event-forwarding-microservice/cache/shared"
+	"github.com/byuoitav/event-forwarding-microservice/config"
 )
 
 // Caches .
 var Caches map[string]shared.Cache
 var cachesInit sync.Once
+var cachesLock sync.RWMutex
+
+// cacheConfigs holds the config each cache in Caches was built from
+var cacheConfigs map[string]config.Cache
+
+// statuses holds how each cache's initialization went
+var statuses map[string]Status
+
+// Status is how a cache's initialization went
+type Status struct {
+	// Initialized is true if the cache was built and everything in its storage was loaded into it
+	Initialized bool   `json:"initialized"`
+	Error       string `json:"error,omitempty"`
+
+	// how many devices and rooms it started with
+	Devices int `json:"devices"`
+	Rooms   int `json:"rooms"`
+}
+
+// closer is implemented by caches that have background work to stop when they are removed
+type closer interface {
+	Close() error
+}
 
 // GetCache .
 func GetCache(cacheType string) shared.Cache {
 	cachesInit.Do(InitializeCaches)
 	slog.Debug("Cache type", "type", cacheType)
+
+	cachesLock.RLock()
+	defer cachesLock.RUnlock()
+
 	toReturn, ok := Caches[cacheType]
 	if !ok {
 		slog.Warn("Cache of type does not exist", "type", cacheType)
@@ -22,3 +50,44 @@ func GetCache(cacheType string) shared.Cache {
 	}
 	return toReturn
 }
+
+// LookupCache returns the named cache. Unlike GetCache it doesn't initialize the caches,
+// so it's safe to use from anything that may run while they're being built.
+func LookupCache(name string) (shared.Cache, bool) {
+	cachesLock.RLock()
+	defer cachesLock.RUnlock()
+
+	toReturn, ok := Caches[name]
+	return toReturn, ok
+}
+
+// ListCaches returns the caches that have been built, without initializing them
+func ListCaches() []shared.Cache {
+	cachesLock.RLock()
+	defer cachesLock.RUnlock()
+
+	toReturn := make([]shared.Cache, 0, len(Caches))
+	for _, c := range Caches {
+		toReturn = append(toReturn, c)
+	}
+	return toReturn
+}
+
+// Statuses returns how the initialization of each configured cache went, by name. Caches that haven't been built yet have the error "not initialized".
+func Statuses() map[string]Status {
+	toReturn := make(map[string]Status)
+	for _, c := range config.GetConfig().Caches {
+		toReturn[c.Name] = getStatus(c.Name)
+	}
+	return toReturn
+}
+
+func getStatus(name string) Status {
+	cachesLock.RLock()
+	defer cachesLock.RUnlock()
+
+	if s, ok := statuses[name]; ok {
+		return s
+	}
+	return Status{Error: "not initialized"}
+}
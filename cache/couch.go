@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/byuoitav/event-forwarding-microservice/couch"
+	"github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
+)
+
+// couchPageSize is how many documents are requested from couch at a time
+const couchPageSize = 1000
+
+type couchFindQuery struct {
+	Selector map[string]interface{} `json:"selector"`
+	Limit    int                    `json:"limit"`
+	Bookmark string                 `json:"bookmark,omitempty"`
+}
+
+type couchFindResponse struct {
+	Docs     []json.RawMessage `json:"docs"`
+	Bookmark string            `json:"bookmark"`
+	Warning  string            `json:"warning"`
+}
+
+// couchDoc is enough of a document to tell if it's a device or a room
+type couchDoc struct {
+	ID       string `json:"_id"`
+	DeviceID string `json:"deviceID"`
+	RoomID   string `json:"roomID"`
+}
+
+// GetCouchStaticRecords pages through every document in the database and unmarshals the devices and rooms in it.
+// Devices are the documents with a deviceID, like the ones written by the couch forwarder, and rooms the documents with a roomID.
+func GetCouchStaticRecords(url, database string) ([]statedefinition.StaticDevice, []statedefinition.StaticRoom, error) {
+	slog.Debug("Getting device and room information from couch", "database", database)
+	addr := fmt.Sprintf("%v/%v/_find", strings.Trim(url, "/"), database)
+
+	var devs []statedefinition.StaticDevice
+	var rooms []statedefinition.StaticRoom
+
+	query := couchFindQuery{
+		Selector: map[string]interface{}{
+			"_id": map[string]interface{}{"$gt": nil},
+		},
+		Limit: couchPageSize,
+	}
+
+	for page := 1; ; page++ {
+		resp, err := couch.MakeRequest(addr, http.MethodPost, query)
+		if err != nil {
+			return devs, rooms, fmt.Errorf("Couldn't retrieve couch database %v for cache: %w", database, err)
+		}
+
+		var findResp couchFindResponse
+		if err := json.Unmarshal(resp, &findResp); err != nil {
+			return devs, rooms, fmt.Errorf("Couldn't unmarshal response from couch database %v: %w", database, err)
+		}
+
+		if len(findResp.Warning) > 0 {
+			slog.Debug("Warning from couch", "database", database, "warning", findResp.Warning)
+		}
+
+		for i := range findResp.Docs {
+			var doc couchDoc
+			if err := json.Unmarshal(findResp.Docs[i], &doc); err != nil {
+				slog.Warn("Skipping couch document that couldn't be read", "database", database, "error", err)
+				continue
+			}
+
+			switch {
+			case len(doc.DeviceID) > 0:
+				var dev statedefinition.StaticDevice
+				if err := json.Unmarshal(findResp.Docs[i], &dev); err != nil {
+					slog.Warn("Skipping device that couldn't be read", "database", database, "id", doc.ID, "error", err)
+					continue
+				}
+				devs = append(devs, dev)
+			case len(doc.RoomID) > 0:
+				var room statedefinition.StaticRoom
+				if err := json.Unmarshal(findResp.Docs[i], &room); err != nil {
+					slog.Warn("Skipping room that couldn't be read", "database", database, "id", doc.ID, "error", err)
+					continue
+				}
+				rooms = append(rooms, room)
+			}
+		}
+
+		slog.Info("Loaded page from couch", "database", database, "page", page, "devices", len(devs), "rooms", len(rooms))
+
+		// the last page is short, and couch hands back the same bookmark once there aren't any more
+		if len(findResp.Docs) < couchPageSize || len(findResp.Bookmark) == 0 || findResp.Bookmark == query.Bookmark {
+			return devs, rooms, nil
+		}
+		query.Bookmark = findResp.Bookmark
+	}
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetCouchStaticRecords(t *testing.T) {
+	docs := []interface{}{
+		map[string]string{"_id": "_design/views", "language": "javascript"},
+		map[string]string{"_id": "ITB-1101", "_rev": "1-a", "roomID": "ITB-1101", "designation": "production"},
+	}
+	for i := 0; i < couchPageSize+10; i++ {
+		id := fmt.Sprintf("ITB-%d-D1", i)
+		docs = append(docs, map[string]string{"_id": id, "_rev": "1-a", "deviceID": id, "power": "on"})
+	}
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "/devices/_find", r.URL.Path)
+		assert.Equal(t, http.MethodPost, r.Method)
+
+		var query couchFindQuery
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&query))
+		assert.Equal(t, couchPageSize, query.Limit)
+
+		// the bookmark is where the page starts
+		start := 0
+		if len(query.Bookmark) > 0 {
+			start, _ = strconv.Atoi(query.Bookmark)
+		}
+		end := min(start+query.Limit, len(docs))
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"docs":     docs[start:end],
+			"bookmark": strconv.Itoa(end),
+		})
+	}))
+	defer server.Close()
+
+	devs, rooms, err := GetCouchStaticRecords(server.URL+"/", "devices")
+	require.NoError(t, err)
+	assert.Equal(t, 2, requests)
+
+	require.Len(t, devs, couchPageSize+10)
+	assert.Equal(t, "ITB-0-D1", devs[0].DeviceID)
+	assert.Equal(t, "on", devs[0].Power)
+
+	require.Len(t, rooms, 1)
+	assert.Equal(t, statedefinition.StaticRoom{RoomID: "ITB-1101", Designation: "production"}, rooms[0])
+}
+
+func TestGetCouchStaticRecordsError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"not_found","reason":"Database does not exist."}`))
+	}))
+	defer server.Close()
+
+	_, _, err := GetCouchStaticRecords(server.URL, "devices")
+	assert.Error(t, err)
+}
@@ -1,128 +1,263 @@
 package cache
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"reflect"
+	"time"
 
 	"github.com/byuoitav/event-forwarding-microservice/cache/memorycache"
+	"github.com/byuoitav/event-forwarding-microservice/cache/rediscache"
 	"github.com/byuoitav/event-forwarding-microservice/cache/shared"
 	"github.com/byuoitav/event-forwarding-microservice/config"
 	"github.com/byuoitav/event-forwarding-microservice/elk"
+	"github.com/byuoitav/event-forwarding-microservice/forwarding"
 	"github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
 )
 
-const maxSize = 10000
 const pushCron = "0 0 0 * * *"
 
-// InitializeCaches initializes the caches with data from ELK
+// noCrons is set by DisableCrons
+var noCrons bool
+
+// DisableCrons keeps caches built after it's called from pushing their devices or expiring maintenance mode on a schedule,
+// e.g. for a replay that shouldn't do either. Call it before the caches are built.
+func DisableCrons() {
+	noCrons = true
+}
+
+/*
+LoadMemoryCache builds a memory cache loaded from i's storage, whatever i's cache type is. It isn't one of the caches in Caches and doesn't run any crons,
+so nothing done to it reaches i's real cache, e.g. for a dry run. Whatever could be loaded is returned along with any error loading it.
+*/
+func LoadMemoryCache(i config.Cache) (*memorycache.Memorycache, error) {
+	devs, rooms, loadErr := loadFromStorage(i)
+
+	c, err := memorycache.MakeMemoryCache(devs, rooms, "", i)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't make memory cache for %v: %w", i.Name, err)
+	}
+
+	return c, loadErr
+}
+
+// InitializeCaches initializes the caches with data from their storage
 func InitializeCaches() {
 	slog.Info("Initializing Caches")
-	Caches = make(map[string]shared.Cache)
+	applyConfig(config.GetConfig())
+	slog.Info("Caches Initialized.")
+}
+
+// ApplyConfig reconciles the caches with the caches in c. New caches are loaded from their storage, removed caches are stopped,
+// and changed caches are rebuilt from the records in the old cache, falling back to their storage for anything the old cache didn't have.
+func ApplyConfig(c config.Config) {
+	// the config being applied replaces the initial one
+	cachesInit.Do(func() {})
+
+	slog.Info("Applying cache config")
+	applyConfig(c)
+	slog.Info("Cache config applied")
+}
+
+func applyConfig(c config.Config) {
+	cachesLock.RLock()
+	old := Caches
+	oldConfigs := cacheConfigs
+	cachesLock.RUnlock()
+
+	next := make(map[string]shared.Cache)
+	nextConfigs := make(map[string]config.Cache)
+	nextStatuses := make(map[string]Status)
 
-	c := config.GetConfig()
 	for _, i := range c.Caches {
+		if cur, ok := old[i.Name]; ok && reflect.DeepEqual(oldConfigs[i.Name], i) {
+			next[i.Name] = cur
+			nextConfigs[i.Name] = i
+			nextStatuses[i.Name] = getStatus(i.Name)
+			continue
+		}
+
 		slog.Info("Initializing cache", "name", i.Name)
 		var devs []statedefinition.StaticDevice
 		var rooms []statedefinition.StaticRoom
-		var er error
-		//depending on storage, data, and cache type depends on what function we call.
-		switch i.StorageType {
-		case config.Elk:
-			//within the elk type
-			devs, er = GetElkStaticDevices(i.ELKinfo.DeviceIndex, i.ELKinfo.URL)
-			if er != nil {
-				slog.Error("Couldn't get information for device cache", "name", i.Name, "error", er.Error())
-			}
 
-			if i.ELKinfo.RoomIndex != "" {
-				rooms, er = GetElkStaticRooms(i.ELKinfo.RoomIndex, i.ELKinfo.URL)
-				if er != nil {
-					slog.Error("Couldn't get information for room cache", "name", i.Name, "error", er.Error())
-				}
-			}
-		default:
-			slog.Info("No storage type")
+		// keep what we already know when a cache is rebuilt
+		if cur, ok := old[i.Name]; ok {
+			slog.Info("Rebuilding cache from its current records", "name", i.Name)
+			devs, _ = cur.GetAllDeviceRecords()
+			rooms, _ = cur.GetAllRoomRecords()
 		}
+
+		storedDevs, storedRooms, loadErr := loadFromStorage(i)
+		devs = append(devs, storedDevs...)
+		rooms = append(rooms, storedRooms...)
+
 		cache, err := makeCache(devs, rooms, i)
 		if err != nil {
 			slog.Error("Couldn't make cache", "error", err.Error())
+			nextStatuses[i.Name] = Status{Error: err.Error()}
 			continue
 		}
 
-		Caches[i.Name] = cache
+		next[i.Name] = cache
+		nextConfigs[i.Name] = i
+
+		status := Status{Initialized: loadErr == nil, Devices: len(devs), Rooms: len(rooms)}
+		if loadErr != nil {
+			status.Error = loadErr.Error()
+		}
+		nextStatuses[i.Name] = status
 		slog.Info("Cache initialized", "name", i.Name, "type", i.CacheType, "devices", len(devs), "rooms", len(rooms))
 	}
 
-	slog.Info("Caches Initialized.")
-}
+	cachesLock.Lock()
+	Caches = next
+	cacheConfigs = nextConfigs
+	statuses = nextStatuses
+	cachesLock.Unlock()
 
-// GetElkStaticDevices queries the provided index in ELK and unmarshals the records into a list of static devices
-func GetElkStaticDevices(index, url string) ([]statedefinition.StaticDevice, error) {
-	slog.Debug("Getting device information from", "index", index)
-	query := elk.GenericQuery{
-		Size: maxSize,
-	}
+	// anything still using an old cache gets errors from it once it's stopped, rather than waiting on it
+	for name, cur := range old {
+		if next[name] == cur {
+			continue
+		}
 
-	b, er := json.Marshal(query)
-	if er != nil {
-		return []statedefinition.StaticDevice{}, fmt.Errorf("Couldn't marshal generic query %v: %w", query, er)
+		slog.Info("Stopping cache", "name", name)
+		if cl, ok := cur.(closer); ok {
+			if err := cl.Close(); err != nil {
+				slog.Error("Couldn't stop cache", "name", name, "error", err)
+			}
+		}
 	}
+}
 
-	resp, err := elk.MakeGenericELKRequest(fmt.Sprintf("%v/%v/_search", url, index), "GET", b, "", "")
-	if err != nil {
-		return []statedefinition.StaticDevice{}, fmt.Errorf("Couldn't retrieve static index %v for cache: %w", index, err)
-	}
+// loadFromStorage gets the devices and rooms for a cache from its persistent storage.
+// Whatever could be loaded is returned along with any errors.
+func loadFromStorage(i config.Cache) ([]statedefinition.StaticDevice, []statedefinition.StaticRoom, error) {
+	var devs []statedefinition.StaticDevice
+	var rooms []statedefinition.StaticRoom
+	var er error
+	var errs []error
 
-	var queryResp elk.StaticDeviceQueryResponse
-	er = json.Unmarshal(resp, &queryResp)
-	if er != nil {
-		return []statedefinition.StaticDevice{}, fmt.Errorf("Couldn't unmarshal response from static index %v: %w", index, er)
+	//depending on storage, data, and cache type depends on what function we call.
+	switch i.StorageType {
+	case config.Elk:
+		//within the elk type
+		devs, er = GetElkStaticDevices(i.ELKinfo.DeviceIndex, i.ELKinfo.URL, getScrollOptions(i.ELKinfo))
+		if er != nil {
+			slog.Error("Couldn't get information for device cache", "name", i.Name, "error", er.Error())
+			errs = append(errs, er)
+		}
+
+		if i.ELKinfo.RoomIndex != "" {
+			rooms, er = GetElkStaticRooms(i.ELKinfo.RoomIndex, i.ELKinfo.URL, getScrollOptions(i.ELKinfo))
+			if er != nil {
+				slog.Error("Couldn't get information for room cache", "name", i.Name, "error", er.Error())
+				errs = append(errs, er)
+			}
+		}
+	case config.Couch:
+		devs, rooms, er = GetCouchStaticRecords(i.CouchInfo.URL, i.CouchInfo.DatabaseName)
+		if er != nil {
+			slog.Error("Couldn't get information for cache from couch", "name", i.Name, "error", er.Error())
+			errs = append(errs, er)
+		}
+	default:
+		slog.Info("No storage type")
 	}
 
+	return devs, rooms, errors.Join(errs...)
+}
+
+// GetElkStaticDevices pages through the provided index in ELK and unmarshals the records into a list of static devices
+func GetElkStaticDevices(index, url string, opts elk.ScrollOptions) ([]statedefinition.StaticDevice, error) {
+	slog.Debug("Getting device information from", "index", index)
+
+	// a restarted scroll gets documents again, so they're kept by ID
 	var toReturn []statedefinition.StaticDevice
-	for i := range queryResp.Hits.Wrappers {
-		toReturn = append(toReturn, queryResp.Hits.Wrappers[i].Device)
+	seen := make(map[string]int)
+	err := elk.Scroll(context.Background(), url, index, opts, func(hits []elk.ScrollHit) error {
+		for i := range hits {
+			var dev statedefinition.StaticDevice
+			if err := json.Unmarshal(hits[i].Source, &dev); err != nil {
+				return fmt.Errorf("Couldn't unmarshal device %v from static index %v: %w", hits[i].ID, index, err)
+			}
+
+			if j, ok := seen[hits[i].ID]; ok {
+				toReturn[j] = dev
+				continue
+			}
+			seen[hits[i].ID] = len(toReturn)
+			toReturn = append(toReturn, dev)
+		}
+		return nil
+	})
+	if err != nil {
+		return toReturn, fmt.Errorf("Couldn't retrieve static index %v for cache: %w", index, err)
 	}
 
 	return toReturn, nil
 }
 
-// GetElkStaticRooms retrieves the list of static rooms from the privided elk index - assumes the ELK_DIRECT_ADDRESS env variable.
-func GetElkStaticRooms(index, url string) ([]statedefinition.StaticRoom, error) {
-	query := elk.GenericQuery{
-		Size: maxSize,
-	}
+// GetElkStaticRooms pages through the provided index in ELK and unmarshals the records into a list of static rooms
+func GetElkStaticRooms(index, url string, opts elk.ScrollOptions) ([]statedefinition.StaticRoom, error) {
+	slog.Info("Getting the info for", "index", index)
 
-	b, er := json.Marshal(query)
-	if er != nil {
-		return []statedefinition.StaticRoom{}, fmt.Errorf("Couldn't marshal generic query %v: %w", query, er)
-	}
+	// a restarted scroll gets documents again, so they're kept by ID
+	var toReturn []statedefinition.StaticRoom
+	seen := make(map[string]int)
+	err := elk.Scroll(context.Background(), url, index, opts, func(hits []elk.ScrollHit) error {
+		for i := range hits {
+			var room statedefinition.StaticRoom
+			if err := json.Unmarshal(hits[i].Source, &room); err != nil {
+				return fmt.Errorf("Couldn't unmarshal room %v from static index %v: %w", hits[i].ID, index, err)
+			}
 
-	resp, err := elk.MakeGenericELKRequest(fmt.Sprintf("%v/%v/_search", url, index), "GET", b, "", "")
+			if j, ok := seen[hits[i].ID]; ok {
+				toReturn[j] = room
+				continue
+			}
+			seen[hits[i].ID] = len(toReturn)
+			toReturn = append(toReturn, room)
+		}
+		return nil
+	})
 	if err != nil {
-		return []statedefinition.StaticRoom{}, fmt.Errorf("Couldn't retrieve static index %v for cache: %w", index, err)
+		return toReturn, fmt.Errorf("Couldn't retrieve static index %v for cache: %w", index, err)
 	}
-	slog.Info("Getting the info for", "index", index)
 
-	var queryResp elk.StaticRoomQueryResponse
-	er = json.Unmarshal(resp, &queryResp)
-	if er != nil {
-		return []statedefinition.StaticRoom{}, fmt.Errorf("Couldn't unmarshal response from static index %v: %w", index, er)
-	}
+	return toReturn, nil
+}
 
-	var toReturn []statedefinition.StaticRoom
-	for i := range queryResp.Hits.Wrappers {
-		toReturn = append(toReturn, queryResp.Hits.Wrappers[i].Room)
+// getScrollOptions builds the options for loading a cache from ELK, filling in defaults for anything unset
+func getScrollOptions(c config.ElkCache) elk.ScrollOptions {
+	opts := elk.DefaultScrollOptions
+	opts.Retry = forwarding.GetRetryPolicy(c.Retry)
+
+	if c.PageSize > 0 {
+		opts.PageSize = c.PageSize
+	}
+	if c.Timeout > 0 {
+		opts.Timeout = time.Duration(c.Timeout) * time.Second
 	}
 
-	return toReturn, nil
+	return opts
 }
 
-func makeCache(devices []statedefinition.StaticDevice, rooms []statedefinition.StaticRoom, config config.Cache) (shared.Cache, error) {
-	switch config.CacheType {
-	case "memory":
-		return memorycache.MakeMemoryCache(devices, rooms, pushCron, config)
+func makeCache(devices []statedefinition.StaticDevice, rooms []statedefinition.StaticRoom, c config.Cache) (shared.Cache, error) {
+	cron := pushCron
+	if noCrons {
+		cron = ""
+	}
+
+	switch c.CacheType {
+	case config.MEMORY:
+		return memorycache.MakeMemoryCache(devices, rooms, cron, c)
+	case config.REDIS:
+		return rediscache.MakeRedisCache(devices, rooms, cron, c)
 	}
-	return nil, fmt.Errorf("Unknown cache type %v", config.CacheType)
+	return nil, fmt.Errorf("Unknown cache type %v", c.CacheType)
 }
@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/byuoitav/event-forwarding-microservice/config"
+	"github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyConfig(t *testing.T) {
+	t.Cleanup(func() { ApplyConfig(config.Config{}) })
+
+	def := config.Cache{Name: "default", CacheType: config.MEMORY}
+	legacy := config.Cache{Name: "legacy", CacheType: config.MEMORY}
+	ApplyConfig(config.Config{Caches: []config.Cache{def, legacy}})
+
+	first, ok := LookupCache("default")
+	require.True(t, ok)
+	old, ok := LookupCache("legacy")
+	require.True(t, ok)
+
+	_, _, err := first.StoreDeviceEvent(statedefinition.State{ID: "ITB-1101-D1", Key: "power", Value: "on", Time: time.Now()})
+	require.NoError(t, err)
+
+	// nothing changed, so it's the same cache
+	ApplyConfig(config.Config{Caches: []config.Cache{def, legacy}})
+	c, _ := LookupCache("default")
+	assert.Same(t, first, c)
+
+	// a changed cache is rebuilt with what it already had, and a removed one is stopped
+	def.ELKinfo.PageSize = 500
+	ApplyConfig(config.Config{Caches: []config.Cache{def}})
+
+	c, ok = LookupCache("default")
+	require.True(t, ok)
+	assert.NotSame(t, first, c)
+
+	device, err := c.GetDeviceRecord("ITB-1101-D1")
+	require.NoError(t, err)
+	assert.Equal(t, "on", device.Power)
+
+	_, ok = LookupCache("legacy")
+	assert.False(t, ok)
+	assert.Len(t, ListCaches(), 1)
+
+	// the old caches are stopped, so they're empty
+	devices, err := first.GetAllDeviceRecords()
+	require.NoError(t, err)
+	assert.Empty(t, devices)
+
+	devices, err = old.GetAllDeviceRecords()
+	require.NoError(t, err)
+	assert.Empty(t, devices)
+
+	assert.Equal(t, Status{Initialized: true, Devices: 1}, getStatus("default"))
+	assert.Equal(t, Status{Error: "not initialized"}, getStatus("legacy"))
+}
+
+func TestApplyConfigUnknownCacheType(t *testing.T) {
+	t.Cleanup(func() { ApplyConfig(config.Config{}) })
+
+	ApplyConfig(config.Config{Caches: []config.Cache{{Name: "default", CacheType: "unknown"}}})
+
+	_, ok := LookupCache("default")
+	assert.False(t, ok)
+	assert.NotEmpty(t, getStatus("default").Error)
+}
+
+func TestApplyConfigShortLoad(t *testing.T) {
+	t.Cleanup(func() { ApplyConfig(config.Config{}) })
+
+	// five devices match, but the scroll ends after one
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := map[string]interface{}{
+			"_scroll_id": "1",
+			"hits":       map[string]interface{}{"total": 5, "hits": []interface{}{}},
+		}
+		if r.URL.Path == "/devices/_search" {
+			resp["hits"].(map[string]interface{})["hits"] = []interface{}{
+				map[string]interface{}{"_id": "ITB-1101-D1", "_source": map[string]interface{}{"deviceID": "ITB-1101-D1"}},
+			}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(server.Close)
+
+	ApplyConfig(config.Config{Caches: []config.Cache{{
+		Name:        "default",
+		CacheType:   config.MEMORY,
+		StorageType: config.Elk,
+		ELKinfo:     config.ElkCache{URL: server.URL, DeviceIndex: "devices"},
+	}}})
+
+	// the cache still has what was loaded
+	_, ok := LookupCache("default")
+	require.True(t, ok)
+
+	status := getStatus("default")
+	assert.False(t, status.Initialized)
+	assert.Equal(t, 1, status.Devices)
+	assert.Contains(t, status.Error, "only loaded 1 of 5 documents")
+}
+
+func TestLoadMemoryCache(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := map[string]interface{}{
+			"_scroll_id": "1",
+			"hits":       map[string]interface{}{"total": 1, "hits": []interface{}{}},
+		}
+		if r.URL.Path == "/devices/_search" {
+			resp["hits"].(map[string]interface{})["hits"] = []interface{}{
+				map[string]interface{}{"_id": "ITB-1101-D1", "_source": map[string]interface{}{"deviceID": "ITB-1101-D1", "power": "on"}},
+			}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(server.Close)
+
+	// a redis cache is loaded from its storage, without connecting to redis
+	c, err := LoadMemoryCache(config.Cache{
+		Name:        "default",
+		CacheType:   config.REDIS,
+		StorageType: config.Elk,
+		ELKinfo:     config.ElkCache{URL: server.URL, DeviceIndex: "devices"},
+		RedisInfo:   config.RedisCache{URL: "redis://localhost:1"},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+
+	device, err := c.GetDeviceRecord("ITB-1101-D1")
+	require.NoError(t, err)
+	assert.Equal(t, "on", device.Power)
+
+	_, ok := LookupCache("default")
+	assert.False(t, ok)
+}
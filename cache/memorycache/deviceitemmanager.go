@@ -17,6 +17,9 @@ type DeviceItemManager struct {
 	WriteRequests chan DeviceTransactionRequest //channel to buffer changes to the device.
 	ReadRequests  chan chan sd.StaticDevice
 	KillChannel   chan bool
+
+	// closed once the manager has been killed and answered anyone waiting on it
+	Done chan struct{}
 }
 
 // DeviceTransactionRequest is submitted to read/write a the device being managed by this manager
@@ -45,6 +48,8 @@ func GetNewDeviceManager(id string) (DeviceItemManager, error) {
 	a := DeviceItemManager{
 		WriteRequests: make(chan DeviceTransactionRequest, 100),
 		ReadRequests:  make(chan chan sd.StaticDevice, 100),
+		KillChannel:   make(chan bool, 1),
+		Done:          make(chan struct{}),
 	}
 
 	dev, err := shared.GetNewDevice(id)
@@ -60,6 +65,8 @@ func GetNewDeviceManagerWithDevice(dev sd.StaticDevice) (DeviceItemManager, erro
 	a := DeviceItemManager{
 		WriteRequests: make(chan DeviceTransactionRequest, 100),
 		ReadRequests:  make(chan chan sd.StaticDevice, 100),
+		KillChannel:   make(chan bool, 1),
+		Done:          make(chan struct{}),
 	}
 
 	rm := strings.Split(dev.DeviceID, "-")
@@ -73,6 +80,8 @@ func GetNewDeviceManagerWithDevice(dev sd.StaticDevice) (DeviceItemManager, erro
 
 // StartDeviceManager is a blocking call to start that device manager listening over the read and write channels.
 func StartDeviceManager(m DeviceItemManager, device sd.StaticDevice) {
+	defer close(m.Done)
+
 	var merged sd.StaticDevice
 	var changes bool
 	var err error
@@ -82,7 +91,22 @@ func StartDeviceManager(m DeviceItemManager, device sd.StaticDevice) {
 
 		case <-m.KillChannel:
 			slog.Info("Killing device manager", "deviceID", device.DeviceID)
-			return
+
+			//let anyone still waiting on this manager know it's gone
+			for {
+				select {
+				case write := <-m.WriteRequests:
+					if write.ResponseChan != nil {
+						write.ResponseChan <- DeviceTransactionResponse{Error: errDeviceKilled, NewDevice: device, Changes: false}
+					}
+				case read := <-m.ReadRequests:
+					if read != nil {
+						read <- device
+					}
+				default:
+					return
+				}
+			}
 
 		case write := <-m.WriteRequests:
 			if write.ResponseChan == nil {
@@ -126,3 +150,53 @@ func StartDeviceManager(m DeviceItemManager, device sd.StaticDevice) {
 		}
 	}
 }
+
+// errDeviceKilled is returned for requests to a device manager that has been killed
+var errDeviceKilled = errors.New("Device manager was killed")
+
+// write submits req and waits for the response. Requests to a manager that has been killed get an error instead of waiting forever.
+func (m DeviceItemManager) write(req DeviceTransactionRequest) DeviceTransactionResponse {
+	req.ResponseChan = make(chan DeviceTransactionResponse, 1)
+
+	select {
+	case m.WriteRequests <- req:
+	case <-m.Done:
+		return DeviceTransactionResponse{Error: errDeviceKilled}
+	}
+
+	select {
+	case resp := <-req.ResponseChan:
+		return resp
+	case <-m.Done:
+		// it may have answered on its way out
+		select {
+		case resp := <-req.ResponseChan:
+			return resp
+		default:
+			return DeviceTransactionResponse{Error: errDeviceKilled}
+		}
+	}
+}
+
+// read returns a copy of the device, false if the manager has been killed
+func (m DeviceItemManager) read() (sd.StaticDevice, bool) {
+	respChan := make(chan sd.StaticDevice, 1)
+
+	select {
+	case m.ReadRequests <- respChan:
+	case <-m.Done:
+		return sd.StaticDevice{}, false
+	}
+
+	select {
+	case dev := <-respChan:
+		return dev, true
+	case <-m.Done:
+		select {
+		case dev := <-respChan:
+			return dev, true
+		default:
+			return sd.StaticDevice{}, false
+		}
+	}
+}
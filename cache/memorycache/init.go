@@ -8,7 +8,7 @@ import (
 	"github.com/robfig/cron"
 )
 
-// MakeMemoryCache .
+// MakeMemoryCache builds a memory cache with devices and rooms. An empty pushCron doesn't start any crons.
 func MakeMemoryCache(devices []statedefinition.StaticDevice, rooms []statedefinition.StaticRoom, pushCron string, c config.Cache) (*Memorycache, error) {
 	toReturn := Memorycache{
 		cacheType: "memory",
@@ -16,15 +16,24 @@ func MakeMemoryCache(devices []statedefinition.StaticDevice, rooms []statedefini
 		name:      c.Name,
 	}
 
-	slog.Info("adding the cron push")
-	//build our push cron
-	er := toReturn.pushCron.AddFunc(pushCron, toReturn.PushAllDevices)
-	if er != nil {
-		slog.Error("Couldn't add the push all devices cron job to the cache")
-	}
+	//no push schedule means no crons at all, e.g. for a cache that's only being replayed into
+	if len(pushCron) > 0 {
+		slog.Info("adding the cron push")
+		//build our push cron
+		er := toReturn.pushCron.AddFunc(pushCron, toReturn.PushAllDevices)
+		if er != nil {
+			slog.Error("Couldn't add the push all devices cron job to the cache")
+		}
 
-	//starting the cron job
-	toReturn.pushCron.Start()
+		//every minute, take rooms whose maintenance mode has ended out of it
+		er = toReturn.pushCron.AddFunc("@every 1m", toReturn.ExpireMaintenance)
+		if er != nil {
+			slog.Error("Couldn't add the expire maintenance mode cron job to the cache")
+		}
+
+		//starting the cron job
+		toReturn.pushCron.Start()
+	}
 
 	//go through and create our maps
 	toReturn.deviceCache = make(map[string]DeviceItemManager)
@@ -47,13 +56,10 @@ func MakeMemoryCache(devices []statedefinition.StaticDevice, rooms []statedefini
 			continue
 		}
 
-		respChan := make(chan DeviceTransactionResponse, 1)
-		v.WriteRequests <- DeviceTransactionRequest{
+		val := v.write(DeviceTransactionRequest{
 			MergeDeviceEdit: true,
 			MergeDevice:     devices[i],
-			ResponseChan:    respChan,
-		}
-		val := <-respChan
+		})
 
 		if val.Error != nil {
 			slog.Error("Error initializing cache", "deviceID", devices[i].DeviceID, "error", val.Error.Error())
@@ -64,23 +70,17 @@ func MakeMemoryCache(devices []statedefinition.StaticDevice, rooms []statedefini
 	toReturn.roomCache = make(map[string]RoomItemManager)
 	for i := range rooms {
 		//check for duplicate
-		v, ok := toReturn.roomCache[devices[i].DeviceID]
+		_, ok := toReturn.roomCache[rooms[i].RoomID]
 		if ok {
 			continue
 		}
-		v = GetNewRoomManager(rooms[i].RoomID)
 
-		respChan := make(chan RoomTransactionResponse, 1)
-		v.WriteRequests <- RoomTransactionRequest{
-			MergeRoom:    rooms[i],
-			ResponseChan: respChan,
+		if len(rooms[i].RoomID) < 1 {
+			slog.Error("RoomID cannot be blank.", "room", rooms[i])
+			continue
 		}
-		val := <-respChan
 
-		if val.Error != nil {
-			slog.Error("Error initializing cache", "roomID", rooms[i].RoomID, "error", val.Error.Error())
-		}
-		toReturn.roomCache[rooms[i].RoomID] = v
+		toReturn.roomCache[rooms[i].RoomID] = GetNewRoomManagerWithRoom(rooms[i])
 	}
 
 	return &toReturn, nil
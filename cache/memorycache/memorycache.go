@@ -36,6 +36,27 @@ func (c *Memorycache) GetCacheName() string {
 	return c.name
 }
 
+// Close stops the push cron and all of the device and room managers
+func (c *Memorycache) Close() error {
+	c.pushCron.Stop()
+
+	c.devicelock.Lock()
+	for _, v := range c.deviceCache {
+		v.KillChannel <- true
+	}
+	c.deviceCache = make(map[string]DeviceItemManager)
+	c.devicelock.Unlock()
+
+	c.roomlock.Lock()
+	for _, v := range c.roomCache {
+		v.KillChannel <- true
+	}
+	c.roomCache = make(map[string]RoomItemManager)
+	c.roomlock.Unlock()
+
+	return nil
+}
+
 // GetDeviceManagerList .
 func (c *Memorycache) GetDeviceManagerList() (int, []string, error) {
 	toReturn := []string{}
@@ -46,6 +67,19 @@ func (c *Memorycache) GetDeviceManagerList() (int, []string, error) {
 	return len(c.deviceCache), toReturn, nil
 }
 
+// Size returns how many devices and rooms are in the cache
+func (c *Memorycache) Size() (int, int) {
+	c.devicelock.RLock()
+	devices := len(c.deviceCache)
+	c.devicelock.RUnlock()
+
+	c.roomlock.RLock()
+	rooms := len(c.roomCache)
+	c.roomlock.RUnlock()
+
+	return devices, rooms
+}
+
 // StoreAndForwardEvent .
 func (c *Memorycache) StoreAndForwardEvent(v events.Event) (bool, error) {
 	return shared.ForwardAndStoreEvent(v, c)
@@ -78,17 +112,11 @@ func (c *Memorycache) StoreDeviceEvent(toSave statedefinition.State) (bool, stat
 		c.devicelock.Unlock()
 	}
 
-	respChan := make(chan DeviceTransactionResponse, 1)
-
-	//send a request to update
-	manager.WriteRequests <- DeviceTransactionRequest{
-		EventEdit:    true,
-		Event:        toSave,
-		ResponseChan: respChan,
-	}
-
-	//wait for a response
-	resp := <-respChan
+	//send a request to update, and wait for a response
+	resp := manager.write(DeviceTransactionRequest{
+		EventEdit: true,
+		Event:     toSave,
+	})
 
 	if resp.Error != nil {
 		return false, statedefinition.StaticDevice{}, errors.New("Couldn't store event: " + resp.Error.Error())
@@ -123,17 +151,11 @@ func (c *Memorycache) CheckAndStoreDevice(device statedefinition.StaticDevice) (
 		c.devicelock.Unlock()
 	}
 
-	respChan := make(chan DeviceTransactionResponse, 1)
-
-	//send a request to update
-	manager.WriteRequests <- DeviceTransactionRequest{
+	//send a request to update, and wait for a response
+	resp := manager.write(DeviceTransactionRequest{
 		MergeDeviceEdit: true,
 		MergeDevice:     device,
-		ResponseChan:    respChan,
-	}
-
-	//wait for a response
-	resp := <-respChan
+	})
 
 	if resp.Error != nil {
 		return false, statedefinition.StaticDevice{}, errors.New("Couldn't store device: " + resp.Error.Error())
@@ -146,16 +168,15 @@ func (c *Memorycache) CheckAndStoreDevice(device statedefinition.StaticDevice) (
 
 // GetDeviceRecord returns a device with the corresponding ID, if any is found in the memorycache
 func (c *Memorycache) GetDeviceRecord(deviceID string) (statedefinition.StaticDevice, error) {
-
+	c.devicelock.RLock()
 	manager, ok := c.deviceCache[deviceID]
+	c.devicelock.RUnlock()
 	if !ok {
 		return statedefinition.StaticDevice{}, nil
 	}
 
-	respChan := make(chan statedefinition.StaticDevice, 1)
-
-	manager.ReadRequests <- respChan
-	return <-respChan, nil
+	device, _ := manager.read()
+	return device, nil
 }
 
 /*
@@ -169,21 +190,18 @@ func (c *Memorycache) CheckAndStoreRoom(room statedefinition.StaticRoom) (bool,
 		return false, statedefinition.StaticRoom{}, errors.New("Static room must have a roomID to be compared and stored")
 	}
 
+	c.roomlock.Lock()
 	manager, ok := c.roomCache[room.RoomID]
 	if !ok {
 		manager = GetNewRoomManager(room.RoomID)
+		c.roomCache[room.RoomID] = manager
 	}
+	c.roomlock.Unlock()
 
-	respChan := make(chan RoomTransactionResponse, 1)
-
-	//send a request to update
-	manager.WriteRequests <- RoomTransactionRequest{
-		MergeRoom:    room,
-		ResponseChan: respChan,
-	}
-
-	//wait for a response
-	resp := <-respChan
+	//send a request to update, and wait for a response
+	resp := manager.write(RoomTransactionRequest{
+		MergeRoom: room,
+	})
 
 	if resp.Error != nil {
 		return false, statedefinition.StaticRoom{}, errors.New("Couldn't store room: " + resp.Error.Error())
@@ -199,32 +217,69 @@ func (c *Memorycache) PushAllDevices() {
 	shared.PushAllDevices(c)
 }
 
+// ExpireMaintenance takes rooms whose maintenance mode has ended out of it
+func (c *Memorycache) ExpireMaintenance() {
+	if _, err := shared.ExpireMaintenance(c, time.Now()); err != nil {
+		slog.Warn("Couldn't expire maintenance mode", "error", err)
+	}
+}
+
 // GetRoomRecord returns a room
 func (c *Memorycache) GetRoomRecord(roomID string) (statedefinition.StaticRoom, error) {
+	c.roomlock.RLock()
 	manager, ok := c.roomCache[roomID]
+	c.roomlock.RUnlock()
 	if !ok {
 		return statedefinition.StaticRoom{}, nil
 	}
 
-	respChan := make(chan statedefinition.StaticRoom, 1)
+	room, _ := manager.read()
+	return room, nil
+}
+
+// GetRoomDeviceRecords returns the devices in a room
+func (c *Memorycache) GetRoomDeviceRecords(roomID string) ([]statedefinition.StaticDevice, error) {
+	managers := []DeviceItemManager{}
+
+	c.devicelock.RLock()
+	for k, v := range c.deviceCache {
+		if strings.HasPrefix(k, roomID+"-") {
+			managers = append(managers, v)
+		}
+	}
+	c.devicelock.RUnlock()
+
+	toReturn := make([]statedefinition.StaticDevice, 0, len(managers))
+	for i := range managers {
+		if device, ok := managers[i].read(); ok {
+			toReturn = append(toReturn, device)
+		}
+	}
 
-	manager.ReadRequests <- respChan
-	return <-respChan, nil
+	return toReturn, nil
 }
 
 // GetAllDeviceRecords .
 func (c *Memorycache) GetAllDeviceRecords() ([]statedefinition.StaticDevice, error) {
 	toReturn := []statedefinition.StaticDevice{}
 
+	c.devicelock.RLock()
 	expected := len(c.deviceCache)
 	ReadChannel := make(chan statedefinition.StaticDevice, expected)
 
-	c.devicelock.RLock()
 	for _, v := range c.deviceCache {
-		v.ReadRequests <- ReadChannel
+		select {
+		case v.ReadRequests <- ReadChannel:
+		case <-v.Done:
+			expected--
+		}
 	}
 	c.devicelock.RUnlock()
 
+	if expected == 0 {
+		return toReturn, nil
+	}
+
 	timeoutTimer := time.NewTimer(1 * time.Second)
 
 	received := 0
@@ -248,15 +303,23 @@ func (c *Memorycache) GetAllDeviceRecords() ([]statedefinition.StaticDevice, err
 func (c *Memorycache) GetAllRoomRecords() ([]statedefinition.StaticRoom, error) {
 	toReturn := []statedefinition.StaticRoom{}
 
-	expected := len(c.deviceCache)
+	c.roomlock.RLock()
+	expected := len(c.roomCache)
 	ReadChannel := make(chan statedefinition.StaticRoom, expected)
 
-	c.roomlock.RLock()
 	for _, v := range c.roomCache {
-		v.ReadRequests <- ReadChannel
+		select {
+		case v.ReadRequests <- ReadChannel:
+		case <-v.Done:
+			expected--
+		}
 	}
 	c.roomlock.RUnlock()
 
+	if expected == 0 {
+		return toReturn, nil
+	}
+
 	timeoutTimer := time.NewTimer(1 * time.Second)
 
 	received := 0
@@ -320,7 +383,7 @@ func (c *Memorycache) NukeRoom(id string) ([]string, error) {
 	toDelete := []string{}
 	c.devicelock.RLock()
 	for k := range c.deviceCache {
-		if strings.HasPrefix(k, id) {
+		if strings.HasPrefix(k, id+"-") {
 			toDelete = append(toDelete, k)
 		}
 	}
@@ -0,0 +1,181 @@
+package memorycache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/byuoitav/event-forwarding-microservice/cache/shared"
+	"github.com/byuoitav/event-forwarding-microservice/config"
+	"github.com/byuoitav/event-forwarding-microservice/events"
+	sd "github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testCache(t *testing.T, rooms ...sd.StaticRoom) *Memorycache {
+	c, err := MakeMemoryCache(nil, rooms, "0 0 0 * * *", config.Cache{Name: "test"})
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func event(device, key, value string, ts time.Time, tags ...string) events.Event {
+	info := events.GenerateBasicDeviceInfo(device)
+	return events.Event{
+		GeneratingSystem: info.RoomID + "-CP1",
+		Timestamp:        ts,
+		EventTags:        tags,
+		TargetDevice:     info,
+		AffectedRoom:     info.BasicRoomInfo,
+		Key:              key,
+		Value:            value,
+	}
+}
+
+func TestRoomFromEvents(t *testing.T) {
+	c := testCache(t)
+	start := time.Now().Add(-time.Minute)
+
+	_, err := c.StoreAndForwardEvent(event("ITB-1101-D1", "power", "on", start, events.CoreState))
+	require.NoError(t, err)
+
+	room, err := c.GetRoomRecord("ITB-1101")
+	require.NoError(t, err)
+	assert.Equal(t, "ITB-1101", room.RoomID)
+	assert.Equal(t, "ITB", room.BuildingID)
+	assert.Equal(t, []string{sd.Pi}, room.SystemType)
+	assert.True(t, start.Equal(room.LastActivity))
+	require.NotNil(t, room.DeviceCount)
+	assert.Equal(t, 2, *room.DeviceCount) // the display, and the control processor's heartbeat
+	require.NotNil(t, room.Alerting)
+	assert.False(t, *room.Alerting)
+
+	// an older event doesn't move last activity back
+	_, err = c.StoreAndForwardEvent(event("ITB-1101-SP1", "power", "on", start.Add(-time.Hour), events.CoreState))
+	require.NoError(t, err)
+
+	room, err = c.GetRoomRecord("ITB-1101")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{sd.Pi, sd.Scheduling}, room.SystemType)
+	assert.True(t, start.Equal(room.LastActivity))
+	assert.Equal(t, 3, *room.DeviceCount)
+
+	rooms, err := c.GetAllRoomRecords()
+	require.NoError(t, err)
+	assert.Len(t, rooms, 1)
+}
+
+// scanCounter counts how often a room's devices are read
+type scanCounter struct {
+	*Memorycache
+	scans int
+}
+
+func (c *scanCounter) GetRoomDeviceRecords(roomID string) ([]sd.StaticDevice, error) {
+	c.scans++
+	return c.Memorycache.GetRoomDeviceRecords(roomID)
+}
+
+func TestRoomDevicesOnlyCountedWhenAdded(t *testing.T) {
+	c := &scanCounter{Memorycache: testCache(t)}
+	now := time.Now()
+
+	// the control processor's heartbeat and the display are both new
+	_, err := shared.ForwardAndStoreEvent(event("ITB-1101-D1", "power", "on", now, events.CoreState), c)
+	require.NoError(t, err)
+	assert.Equal(t, 2, c.scans)
+
+	// events for devices that are already cached don't read the room's devices
+	for i := 0; i < 5; i++ {
+		_, err = shared.ForwardAndStoreEvent(event("ITB-1101-D1", "input", "hdmi1", now, events.CoreState), c)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, c.scans)
+
+	_, err = shared.ForwardAndStoreEvent(event("ITB-1101-D2", "power", "on", now, events.CoreState), c)
+	require.NoError(t, err)
+	assert.Equal(t, 3, c.scans)
+
+	room, err := c.GetRoomRecord("ITB-1101")
+	require.NoError(t, err)
+	require.NotNil(t, room.DeviceCount)
+	assert.Equal(t, 3, *room.DeviceCount)
+
+	// removing a device is picked up by refreshing the room
+	require.NoError(t, c.RemoveDevice("ITB-1101-D2"))
+	_, err = shared.RefreshRoom(c, "ITB-1101", time.Now())
+	require.NoError(t, err)
+
+	room, err = c.GetRoomRecord("ITB-1101")
+	require.NoError(t, err)
+	assert.Equal(t, 2, *room.DeviceCount)
+}
+
+func TestRefreshRoom(t *testing.T) {
+	room, err := shared.GetNewRoom("ITB-1101")
+	require.NoError(t, err)
+	c := testCache(t, room)
+
+	// preloaded rooms keep their building
+	stored, err := c.GetRoomRecord("ITB-1101")
+	require.NoError(t, err)
+	assert.Equal(t, "ITB", stored.BuildingID)
+
+	_, err = c.StoreAndForwardEvent(event("ITB-1101-D1", "power", "on", time.Now(), events.CoreState))
+	require.NoError(t, err)
+
+	_, _, err = c.StoreDeviceEvent(sd.State{
+		ID:    "ITB-1101-D1",
+		Key:   "alerts.lamp-hours",
+		Time:  time.Now(),
+		Value: sd.Alert{Alerting: true},
+	})
+	require.NoError(t, err)
+
+	changes, err := shared.RefreshRoom(c, "ITB-1101", time.Now())
+	require.NoError(t, err)
+	assert.True(t, changes)
+
+	stored, err = c.GetRoomRecord("ITB-1101")
+	require.NoError(t, err)
+	require.NotNil(t, stored.Alerting)
+	assert.True(t, *stored.Alerting)
+
+	// nothing to refresh on a room that isn't cached
+	changes, err = shared.RefreshRoom(c, "ITB-1102", time.Now())
+	require.NoError(t, err)
+	assert.False(t, changes)
+}
+
+func TestKilledManagers(t *testing.T) {
+	c := testCache(t, sd.StaticRoom{RoomID: "ITB-1101"})
+
+	_, err := c.StoreAndForwardEvent(event("ITB-1101-D1", "power", "on", time.Now(), events.CoreState))
+	require.NoError(t, err)
+
+	// held by something still working with the cache when it's closed
+	c.devicelock.RLock()
+	device := c.deviceCache["ITB-1101-D1"]
+	c.devicelock.RUnlock()
+	c.roomlock.RLock()
+	room := c.roomCache["ITB-1101"]
+	c.roomlock.RUnlock()
+
+	require.NoError(t, c.Close())
+	<-device.Done
+	<-room.Done
+
+	// more requests than the managers buffer, none of which wait forever
+	for i := 0; i < 150; i++ {
+		resp := device.write(DeviceTransactionRequest{EventEdit: true, Event: sd.State{ID: "ITB-1101-D1", Key: "power", Value: "standby", Time: time.Now()}})
+		assert.ErrorIs(t, resp.Error, errDeviceKilled)
+
+		_, ok := device.read()
+		assert.False(t, ok)
+
+		assert.ErrorIs(t, room.write(RoomTransactionRequest{MergeRoom: sd.StaticRoom{RoomID: "ITB-1101"}}).Error, errRoomKilled)
+
+		_, ok = room.read()
+		assert.False(t, ok)
+	}
+}
@@ -3,6 +3,7 @@ package memorycache
 import (
 	"errors"
 	"log/slog"
+	"strings"
 	"time"
 
 	sd "github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
@@ -14,6 +15,9 @@ type RoomItemManager struct {
 	WriteRequests chan RoomTransactionRequest //channel to buffer changes to the room.
 	ReadRequests  chan chan sd.StaticRoom
 	KillChannel   chan bool
+
+	// closed once the manager has been killed and answered anyone waiting on it
+	Done chan struct{}
 }
 
 // RoomTransactionRequest is submitted to read/write a the room being managed by this manager
@@ -34,6 +38,8 @@ func GetNewRoomManager(id string) RoomItemManager {
 	a := RoomItemManager{
 		WriteRequests: make(chan RoomTransactionRequest, 100),
 		ReadRequests:  make(chan chan sd.StaticRoom, 100),
+		KillChannel:   make(chan bool, 1),
+		Done:          make(chan struct{}),
 	}
 
 	F := false
@@ -44,12 +50,36 @@ func GetNewRoomManager(id string) RoomItemManager {
 		MaintenenceMode: &F,
 	}
 
+	// rooms are named BLDG-ROOM
+	if split := strings.Split(id, "-"); len(split) == 2 {
+		room.BuildingID = split[0]
+	}
+
+	go StartRoomManager(a, room)
+	return a
+}
+
+// GetNewRoomManagerWithRoom will assume overwriting of all the info, won't initialize to default values
+func GetNewRoomManagerWithRoom(room sd.StaticRoom) RoomItemManager {
+	a := RoomItemManager{
+		WriteRequests: make(chan RoomTransactionRequest, 100),
+		ReadRequests:  make(chan chan sd.StaticRoom, 100),
+		KillChannel:   make(chan bool, 1),
+		Done:          make(chan struct{}),
+	}
+
+	if room.UpdateTimes == nil {
+		room.UpdateTimes = make(map[string]time.Time)
+	}
+
 	go StartRoomManager(a, room)
 	return a
 }
 
 // StartRoomManager .
 func StartRoomManager(m RoomItemManager, room sd.StaticRoom) {
+	defer close(m.Done)
+
 	var merged sd.StaticRoom
 	var changes bool
 	var err error
@@ -58,7 +88,18 @@ func StartRoomManager(m RoomItemManager, room sd.StaticRoom) {
 		select {
 		case <-m.KillChannel:
 			slog.Info("Killing room manager", "roomID", room.RoomID)
-			return
+
+			//let anyone still waiting on this manager know it's gone
+			for {
+				select {
+				case write := <-m.WriteRequests:
+					write.ResponseChan <- RoomTransactionResponse{Error: errRoomKilled, NewRoom: room, Changes: false}
+				case read := <-m.ReadRequests:
+					read <- room
+				default:
+					return
+				}
+			}
 		case write := <-m.WriteRequests:
 			if write.MergeRoom.RoomID != room.RoomID {
 				write.ResponseChan <- RoomTransactionResponse{Error: errors.New("Can't change the ID of a room"), NewRoom: room, Changes: false}
@@ -78,3 +119,53 @@ func StartRoomManager(m RoomItemManager, room sd.StaticRoom) {
 		}
 	}
 }
+
+// errRoomKilled is returned for requests to a room manager that has been killed
+var errRoomKilled = errors.New("Room manager was killed")
+
+// write submits req and waits for the response. Requests to a manager that has been killed get an error instead of waiting forever.
+func (m RoomItemManager) write(req RoomTransactionRequest) RoomTransactionResponse {
+	req.ResponseChan = make(chan RoomTransactionResponse, 1)
+
+	select {
+	case m.WriteRequests <- req:
+	case <-m.Done:
+		return RoomTransactionResponse{Error: errRoomKilled}
+	}
+
+	select {
+	case resp := <-req.ResponseChan:
+		return resp
+	case <-m.Done:
+		// it may have answered on its way out
+		select {
+		case resp := <-req.ResponseChan:
+			return resp
+		default:
+			return RoomTransactionResponse{Error: errRoomKilled}
+		}
+	}
+}
+
+// read returns a copy of the room, false if the manager has been killed
+func (m RoomItemManager) read() (sd.StaticRoom, bool) {
+	respChan := make(chan sd.StaticRoom, 1)
+
+	select {
+	case m.ReadRequests <- respChan:
+	case <-m.Done:
+		return sd.StaticRoom{}, false
+	}
+
+	select {
+	case room := <-respChan:
+		return room, true
+	case <-m.Done:
+		select {
+		case room := <-respChan:
+			return room, true
+		default:
+			return sd.StaticRoom{}, false
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package rediscache
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/byuoitav/event-forwarding-microservice/config"
+	"github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
+	"github.com/redis/go-redis/v9"
+	"github.com/robfig/cron"
+)
+
+// MakeRedisCache connects to the device and room databases in c.RedisInfo and merges devices and rooms into what is already stored there.
+// An empty pushCron doesn't start any crons.
+func MakeRedisCache(devices []statedefinition.StaticDevice, rooms []statedefinition.StaticRoom, pushCron string, c config.Cache) (*Rediscache, error) {
+	devOpts, err := options(c.RedisInfo, c.RedisInfo.DevDatabase)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't make redis cache %v: %w", c.Name, err)
+	}
+
+	roomOpts, err := options(c.RedisInfo, c.RedisInfo.RoomDatabase)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't make redis cache %v: %w", c.Name, err)
+	}
+
+	toReturn := Rediscache{
+		cacheType: config.REDIS,
+		name:      c.Name,
+		devices:   redis.NewClient(devOpts),
+		rooms:     redis.NewClient(roomOpts),
+		pushCron:  cron.New(),
+	}
+
+	for _, client := range []*redis.Client{toReturn.devices, toReturn.rooms} {
+		if err := client.Ping(context.Background()).Err(); err != nil {
+			toReturn.devices.Close()
+			toReturn.rooms.Close()
+			return nil, fmt.Errorf("couldn't connect to redis for cache %v: %w", c.Name, err)
+		}
+	}
+
+	//no push schedule means no crons at all, e.g. for a cache that's only being replayed into
+	if len(pushCron) > 0 {
+		slog.Info("adding the cron push")
+		//build our push cron
+		er := toReturn.pushCron.AddFunc(pushCron, toReturn.PushAllDevices)
+		if er != nil {
+			slog.Error("Couldn't add the push all devices cron job to the cache")
+		}
+
+		//every minute, take rooms whose maintenance mode has ended out of it
+		er = toReturn.pushCron.AddFunc("@every 1m", toReturn.ExpireMaintenance)
+		if er != nil {
+			slog.Error("Couldn't add the expire maintenance mode cron job to the cache")
+		}
+
+		//starting the cron job
+		toReturn.pushCron.Start()
+	}
+
+	//merge what we were given with what's already stored
+	for i := range devices {
+		if len(devices[i].DeviceID) < 1 {
+			slog.Error("DeviceID cannot be blank.", "device", devices[i])
+			continue
+		}
+
+		// devices that aren't stored yet are stored as they are
+		device := devices[i]
+		_, _, err := toReturn.mergeDevice(device, func(string) (statedefinition.StaticDevice, error) { return device, nil })
+		if err != nil {
+			slog.Error("Error initializing cache", "deviceID", devices[i].DeviceID, "error", err.Error())
+		}
+	}
+
+	for i := range rooms {
+		if len(rooms[i].RoomID) < 1 {
+			slog.Error("RoomID cannot be blank.", "room", rooms[i])
+			continue
+		}
+
+		room := rooms[i]
+		_, _, err := toReturn.mergeRoom(room, func(string) statedefinition.StaticRoom { return room })
+		if err != nil {
+			slog.Error("Error initializing cache", "roomID", rooms[i].RoomID, "error", err.Error())
+		}
+	}
+
+	return &toReturn, nil
+}
+
+// options builds the client options for database db, the URL can be a redis:// URL or just host:port
+func options(info config.RedisCache, db int) (*redis.Options, error) {
+	if !strings.Contains(info.URL, "://") {
+		return &redis.Options{
+			Addr:     info.URL,
+			Password: info.Password,
+			DB:       db,
+		}, nil
+	}
+
+	opts, err := redis.ParseURL(info.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis url %v: %w", info.URL, err)
+	}
+
+	if len(info.Password) > 0 {
+		opts.Password = info.Password
+	}
+	opts.DB = db
+	return opts, nil
+}
@@ -0,0 +1,461 @@
+// Package rediscache is a cache kept in redis, so several instances can share it and it survives restarts.
+package rediscache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/byuoitav/event-forwarding-microservice/cache/shared"
+	"github.com/byuoitav/event-forwarding-microservice/events"
+	sd "github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
+	"github.com/redis/go-redis/v9"
+	"github.com/robfig/cron"
+)
+
+const (
+	// keys are prefixed so the device and room databases can be the same one
+	devicePrefix = "device:"
+	roomPrefix   = "room:"
+
+	// how many times an update is retried when another instance changes the same record at the same time
+	maxRetries = 50
+
+	// how many keys are scanned/read at a time
+	batchSize = 500
+)
+
+// Rediscache .
+type Rediscache struct {
+	devices *redis.Client
+	rooms   *redis.Client
+
+	cacheType string
+	name      string
+
+	pushCron *cron.Cron
+}
+
+// GetCacheType .
+func (c *Rediscache) GetCacheType() string {
+	return c.cacheType
+}
+
+// GetCacheName .
+func (c *Rediscache) GetCacheName() string {
+	return c.name
+}
+
+// Close stops the push cron and closes the connections to redis. What's stored in redis is kept.
+func (c *Rediscache) Close() error {
+	c.pushCron.Stop()
+
+	return errors.Join(c.devices.Close(), c.rooms.Close())
+}
+
+// Size returns how many devices and rooms are in the cache
+func (c *Rediscache) Size() (int, int) {
+	devices, err := scan(c.devices, devicePrefix+"*")
+	if err != nil {
+		slog.Warn("Couldn't count devices", "cache", c.name, "error", err)
+	}
+
+	rooms, err := scan(c.rooms, roomPrefix+"*")
+	if err != nil {
+		slog.Warn("Couldn't count rooms", "cache", c.name, "error", err)
+	}
+
+	return len(devices), len(rooms)
+}
+
+// StoreAndForwardEvent .
+func (c *Rediscache) StoreAndForwardEvent(v events.Event) (bool, error) {
+	return shared.ForwardAndStoreEvent(v, c)
+}
+
+// StoreDeviceEvent takes an event (key value) and stores the value in the field defined as key on a device.
+func (c *Rediscache) StoreDeviceEvent(toSave sd.State) (bool, sd.StaticDevice, error) {
+	if len(toSave.ID) < 1 {
+		return false, sd.StaticDevice{}, errors.New("State must include device ID")
+	}
+
+	var changes bool
+	var device sd.StaticDevice
+
+	err := update(c.devices, devicePrefix+toSave.ID, func(cur []byte) ([]byte, error) {
+		base, err := decodeDevice(cur, toSave.ID, shared.GetNewDevice)
+		if err != nil {
+			return nil, err
+		}
+
+		device, changes, err = shared.EditDeviceFromEvent(toSave, base)
+		if err != nil {
+			return nil, err
+		}
+
+		return json.Marshal(device)
+	})
+	if err != nil {
+		return false, sd.StaticDevice{}, fmt.Errorf("couldn't store event: %w", err)
+	}
+
+	return changes, device, nil
+}
+
+/*
+CheckAndStoreDevice takes a device, will check to see if there are deltas compared to the values in redis, and store any changes.
+
+Bool returned denotes if there were any changes. True indicates that there were updates
+*/
+func (c *Rediscache) CheckAndStoreDevice(device sd.StaticDevice) (bool, sd.StaticDevice, error) {
+	if len(device.DeviceID) == 0 {
+		return false, sd.StaticDevice{}, errors.New("Static Device must have an ID field to be loaded into the databaset")
+	}
+
+	changes, merged, err := c.mergeDevice(device, shared.GetNewDevice)
+	if err != nil {
+		return false, sd.StaticDevice{}, fmt.Errorf("couldn't store device: %w", err)
+	}
+
+	shared.ForwardDevice(merged, changes, c)
+
+	return changes, merged, nil
+}
+
+// mergeDevice merges device into the stored device, or the one newDevice builds if there isn't one
+func (c *Rediscache) mergeDevice(device sd.StaticDevice, newDevice func(string) (sd.StaticDevice, error)) (bool, sd.StaticDevice, error) {
+	var changes bool
+	var merged sd.StaticDevice
+
+	err := update(c.devices, devicePrefix+device.DeviceID, func(cur []byte) ([]byte, error) {
+		base, err := decodeDevice(cur, device.DeviceID, newDevice)
+		if err != nil {
+			return nil, err
+		}
+
+		_, merged, changes, err = sd.CompareDevices(base, device)
+		if err != nil {
+			return nil, err
+		}
+
+		// a new device is always stored
+		changes = changes || cur == nil
+		if !changes {
+			merged = base
+			return nil, nil
+		}
+
+		return json.Marshal(merged)
+	})
+
+	return changes, merged, err
+}
+
+// GetDeviceRecord returns a device with the corresponding ID, if any is found in the cache
+func (c *Rediscache) GetDeviceRecord(deviceID string) (sd.StaticDevice, error) {
+	b, err := c.devices.Get(context.Background(), devicePrefix+deviceID).Bytes()
+	switch {
+	case errors.Is(err, redis.Nil):
+		return sd.StaticDevice{}, nil
+	case err != nil:
+		return sd.StaticDevice{}, fmt.Errorf("couldn't get device %v: %w", deviceID, err)
+	}
+
+	return decodeDevice(b, deviceID, nil)
+}
+
+/*
+CheckAndStoreRoom takes a room, will check to see if there are deltas compared to the values in redis, and store any changes.
+
+Bool returned denotes if there were any changes. True indicates that there were updates
+*/
+func (c *Rediscache) CheckAndStoreRoom(room sd.StaticRoom) (bool, sd.StaticRoom, error) {
+	if len(room.RoomID) == 0 {
+		return false, sd.StaticRoom{}, errors.New("Static room must have a roomID to be compared and stored")
+	}
+
+	changes, merged, err := c.mergeRoom(room, newRoom)
+	if err != nil {
+		return false, sd.StaticRoom{}, fmt.Errorf("couldn't store room: %w", err)
+	}
+
+	shared.ForwardRoom(merged, changes, c)
+
+	return changes, merged, nil
+}
+
+// mergeRoom merges room into the stored room, or the one newRoom builds if there isn't one
+func (c *Rediscache) mergeRoom(room sd.StaticRoom, newRoom func(string) sd.StaticRoom) (bool, sd.StaticRoom, error) {
+	var changes bool
+	var merged sd.StaticRoom
+
+	err := update(c.rooms, roomPrefix+room.RoomID, func(cur []byte) ([]byte, error) {
+		base := newRoom(room.RoomID)
+		if cur != nil {
+			var err error
+			if base, err = decodeRoom(cur); err != nil {
+				return nil, err
+			}
+		}
+
+		var err error
+		_, merged, changes, err = sd.CompareRooms(base, room)
+		if err != nil {
+			return nil, err
+		}
+
+		// a new room is always stored
+		changes = changes || cur == nil
+		if !changes {
+			merged = base
+			return nil, nil
+		}
+
+		return json.Marshal(merged)
+	})
+
+	return changes, merged, err
+}
+
+// GetRoomRecord returns a room
+func (c *Rediscache) GetRoomRecord(roomID string) (sd.StaticRoom, error) {
+	b, err := c.rooms.Get(context.Background(), roomPrefix+roomID).Bytes()
+	switch {
+	case errors.Is(err, redis.Nil):
+		return sd.StaticRoom{}, nil
+	case err != nil:
+		return sd.StaticRoom{}, fmt.Errorf("couldn't get room %v: %w", roomID, err)
+	}
+
+	return decodeRoom(b)
+}
+
+// PushAllDevices .
+func (c *Rediscache) PushAllDevices() {
+	shared.PushAllDevices(c)
+}
+
+// ExpireMaintenance takes rooms whose maintenance mode has ended out of it
+func (c *Rediscache) ExpireMaintenance() {
+	if _, err := shared.ExpireMaintenance(c, time.Now()); err != nil {
+		slog.Warn("Couldn't expire maintenance mode", "error", err)
+	}
+}
+
+// GetRoomDeviceRecords returns the devices in a room
+func (c *Rediscache) GetRoomDeviceRecords(roomID string) ([]sd.StaticDevice, error) {
+	return c.getDevices(devicePrefix + roomID + "-*")
+}
+
+// GetAllDeviceRecords .
+func (c *Rediscache) GetAllDeviceRecords() ([]sd.StaticDevice, error) {
+	return c.getDevices(devicePrefix + "*")
+}
+
+func (c *Rediscache) getDevices(match string) ([]sd.StaticDevice, error) {
+	vals, err := getAll(c.devices, match)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get devices: %w", err)
+	}
+
+	toReturn := make([]sd.StaticDevice, 0, len(vals))
+	for i := range vals {
+		dev, err := decodeDevice(vals[i], "", nil)
+		if err != nil {
+			slog.Warn("Skipping device that couldn't be read", "cache", c.name, "error", err)
+			continue
+		}
+		toReturn = append(toReturn, dev)
+	}
+
+	return toReturn, nil
+}
+
+// GetAllRoomRecords .
+func (c *Rediscache) GetAllRoomRecords() ([]sd.StaticRoom, error) {
+	vals, err := getAll(c.rooms, roomPrefix+"*")
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get rooms: %w", err)
+	}
+
+	toReturn := make([]sd.StaticRoom, 0, len(vals))
+	for i := range vals {
+		room, err := decodeRoom(vals[i])
+		if err != nil {
+			slog.Warn("Skipping room that couldn't be read", "cache", c.name, "error", err)
+			continue
+		}
+		toReturn = append(toReturn, room)
+	}
+
+	return toReturn, nil
+}
+
+// RemoveDevice .
+func (c *Rediscache) RemoveDevice(id string) error {
+	if err := c.devices.Del(context.Background(), devicePrefix+id).Err(); err != nil {
+		return fmt.Errorf("couldn't remove device %v: %w", id, err)
+	}
+	return nil
+}
+
+// RemoveRoom .
+func (c *Rediscache) RemoveRoom(id string) error {
+	if err := c.rooms.Del(context.Background(), roomPrefix+id).Err(); err != nil {
+		return fmt.Errorf("couldn't remove room %v: %w", id, err)
+	}
+	return nil
+}
+
+// NukeRoom .
+func (c *Rediscache) NukeRoom(id string) ([]string, error) {
+	if err := c.RemoveRoom(id); err != nil {
+		return []string{}, fmt.Errorf("couldn't nuke room: %w", err)
+	}
+
+	keys, err := scan(c.devices, devicePrefix+id+"-*")
+	if err != nil {
+		return []string{}, fmt.Errorf("couldn't nuke room: %w", err)
+	}
+
+	toDelete := make([]string, 0, len(keys))
+	for i := range keys {
+		toDelete = append(toDelete, strings.TrimPrefix(keys[i], devicePrefix))
+	}
+
+	for i := range toDelete {
+		if err := c.RemoveDevice(toDelete[i]); err != nil {
+			return []string{}, fmt.Errorf("couldn't nuke room: %w", err)
+		}
+	}
+
+	return toDelete, nil
+}
+
+/*
+update atomically changes the value stored at key. fn gets what's stored (nil if nothing is) and returns what to store in its place, or nil to leave it as is.
+
+If key is changed by someone else before the new value is written fn is called again with the new value.
+*/
+func update(client *redis.Client, key string, fn func(cur []byte) ([]byte, error)) error {
+	ctx := context.Background()
+
+	txf := func(tx *redis.Tx) error {
+		cur, err := tx.Get(ctx, key).Bytes()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+
+		next, err := fn(cur)
+		if err != nil || next == nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, next, 0)
+			return nil
+		})
+		return err
+	}
+
+	for i := 0; i < maxRetries; i++ {
+		err := client.Watch(ctx, txf, key)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+
+	return fmt.Errorf("%v changed %v times while it was being updated", key, maxRetries)
+}
+
+// scan returns the keys that match the pattern
+func scan(client *redis.Client, match string) ([]string, error) {
+	ctx := context.Background()
+
+	keys := []string{}
+	iter := client.Scan(ctx, 0, match, batchSize).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+
+	return keys, iter.Err()
+}
+
+// getAll returns the values of the keys that match the pattern
+func getAll(client *redis.Client, match string) ([][]byte, error) {
+	keys, err := scan(client, match)
+	if err != nil {
+		return nil, err
+	}
+
+	toReturn := make([][]byte, 0, len(keys))
+	for start := 0; start < len(keys); start += batchSize {
+		end := min(start+batchSize, len(keys))
+
+		vals, err := client.MGet(context.Background(), keys[start:end]...).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, v := range vals {
+			// deleted since the scan
+			s, ok := v.(string)
+			if !ok {
+				continue
+			}
+			toReturn = append(toReturn, []byte(s))
+		}
+	}
+
+	return toReturn, nil
+}
+
+// decodeDevice unmarshals a stored device. If nothing is stored newDevice builds the device instead.
+func decodeDevice(b []byte, id string, newDevice func(string) (sd.StaticDevice, error)) (sd.StaticDevice, error) {
+	if b == nil && newDevice != nil {
+		return newDevice(id)
+	}
+
+	var device sd.StaticDevice
+	if err := json.Unmarshal(b, &device); err != nil {
+		return sd.StaticDevice{}, fmt.Errorf("couldn't unmarshal device %v: %w", id, err)
+	}
+
+	if device.UpdateTimes == nil {
+		device.UpdateTimes = make(map[string]time.Time)
+	}
+	return device, nil
+}
+
+func decodeRoom(b []byte) (sd.StaticRoom, error) {
+	var room sd.StaticRoom
+	if err := json.Unmarshal(b, &room); err != nil {
+		return sd.StaticRoom{}, fmt.Errorf("couldn't unmarshal room: %w", err)
+	}
+
+	if room.UpdateTimes == nil {
+		room.UpdateTimes = make(map[string]time.Time)
+	}
+	return room, nil
+}
+
+// newRoom is the room a room starts out as the first time it's stored
+func newRoom(id string) sd.StaticRoom {
+	F := false
+
+	room := sd.StaticRoom{
+		RoomID:          id,
+		UpdateTimes:     make(map[string]time.Time),
+		MaintenenceMode: &F,
+	}
+
+	// rooms are named BLDG-ROOM
+	if split := strings.Split(id, "-"); len(split) == 2 {
+		room.BuildingID = split[0]
+	}
+	return room
+}
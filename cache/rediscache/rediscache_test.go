@@ -0,0 +1,236 @@
+package rediscache
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/byuoitav/event-forwarding-microservice/cache/shared"
+	"github.com/byuoitav/event-forwarding-microservice/config"
+	"github.com/byuoitav/event-forwarding-microservice/events"
+	sd "github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testCache(t *testing.T, s *miniredis.Miniredis, devices []sd.StaticDevice, rooms []sd.StaticRoom) *Rediscache {
+	c, err := MakeRedisCache(devices, rooms, "0 0 0 * * *", config.Cache{
+		Name:      "test",
+		CacheType: config.REDIS,
+		RedisInfo: config.RedisCache{
+			URL:          s.Addr(),
+			DevDatabase:  0,
+			RoomDatabase: 1,
+		},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestMakeRedisCache(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	addr := s.Addr()
+
+	c, err := MakeRedisCache(nil, nil, "0 0 0 * * *", config.Cache{Name: "test", RedisInfo: config.RedisCache{URL: "redis://" + addr + "/0"}})
+	require.NoError(t, err)
+	require.NoError(t, c.Close())
+
+	s.Close()
+	_, err = MakeRedisCache(nil, nil, "0 0 0 * * *", config.Cache{Name: "test", RedisInfo: config.RedisCache{URL: addr}})
+	assert.Error(t, err)
+}
+
+func TestStoreDeviceEvent(t *testing.T) {
+	s := miniredis.RunT(t)
+	c := testCache(t, s, nil, nil)
+
+	now := time.Now()
+	changes, dev, err := c.StoreDeviceEvent(sd.State{ID: "ITB-1101-D1", Key: "power", Value: "on", Time: now})
+	require.NoError(t, err)
+	assert.True(t, changes)
+	assert.Equal(t, "on", dev.Power)
+	assert.Equal(t, "ITB-1101", dev.Room)
+
+	// same value, no changes
+	changes, _, err = c.StoreDeviceEvent(sd.State{ID: "ITB-1101-D1", Key: "power", Value: "on", Time: now.Add(time.Second)})
+	require.NoError(t, err)
+	assert.False(t, changes)
+
+	_, err = c.StoreAndForwardEvent(events.Event{
+		Timestamp:    now,
+		EventTags:    []string{events.CoreState},
+		TargetDevice: events.GenerateBasicDeviceInfo("ITB-1101-D2"),
+		AffectedRoom: events.GenerateBasicRoomInfo("ITB-1101"),
+		Key:          "input",
+		Value:        "hdmi1",
+	})
+	require.NoError(t, err)
+
+	stored, err := c.GetDeviceRecord("ITB-1101-D2")
+	require.NoError(t, err)
+	assert.Equal(t, "hdmi1", stored.Input)
+
+	room, err := c.GetRoomRecord("ITB-1101")
+	require.NoError(t, err)
+	require.NotNil(t, room.DeviceCount)
+	assert.Equal(t, 2, *room.DeviceCount)
+
+	missing, err := c.GetDeviceRecord("ITB-1101-D3")
+	require.NoError(t, err)
+	assert.Empty(t, missing.DeviceID)
+}
+
+func TestCheckAndStoreDevice(t *testing.T) {
+	s := miniredis.RunT(t)
+	c := testCache(t, s, nil, nil)
+
+	now := time.Now()
+	base, err := shared.GetNewDevice("ITB-1101-D1")
+	require.NoError(t, err)
+	base.Power = "on"
+	base.Input = "hdmi1"
+	base.UpdateTimes["power"] = now
+	base.UpdateTimes["input"] = now
+
+	changes, _, err := c.CheckAndStoreDevice(base)
+	require.NoError(t, err)
+	assert.True(t, changes)
+
+	// only fields updated after what's stored are merged, the same as CompareDevices
+	update := sd.StaticDevice{
+		DeviceID: "ITB-1101-D1",
+		Power:    "standby",
+		Input:    "hdmi2",
+		UpdateTimes: map[string]time.Time{
+			"power": now.Add(time.Minute),
+			"input": now.Add(-time.Minute),
+		},
+	}
+
+	changes, merged, err := c.CheckAndStoreDevice(update)
+	require.NoError(t, err)
+	assert.True(t, changes)
+
+	_, expected, _, err := sd.CompareDevices(base, update)
+	require.NoError(t, err)
+	assert.Equal(t, expected.Power, merged.Power)
+	assert.Equal(t, "standby", merged.Power)
+	assert.Equal(t, "hdmi1", merged.Input)
+
+	changes, _, err = c.CheckAndStoreDevice(update)
+	require.NoError(t, err)
+	assert.False(t, changes)
+
+	_, _, err = c.CheckAndStoreDevice(sd.StaticDevice{})
+	assert.Error(t, err)
+}
+
+func TestConcurrentUpdates(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	// two instances sharing the same redis
+	a := testCache(t, s, nil, nil)
+	b := testCache(t, s, nil, nil)
+
+	now := time.Now()
+	fields := []string{"power", "input", "blanked", "muted", "volume"}
+	values := []interface{}{"on", "hdmi1", true, false, 30}
+
+	var wg sync.WaitGroup
+	for i := range fields {
+		c := a
+		if i%2 == 1 {
+			c = b
+		}
+
+		wg.Add(1)
+		go func(c *Rediscache, key string, value interface{}) {
+			defer wg.Done()
+			_, _, err := c.StoreDeviceEvent(sd.State{ID: "ITB-1101-D1", Key: key, Value: value, Time: now})
+			assert.NoError(t, err)
+		}(c, fields[i], values[i])
+	}
+	wg.Wait()
+
+	dev, err := a.GetDeviceRecord("ITB-1101-D1")
+	require.NoError(t, err)
+	assert.Equal(t, "on", dev.Power)
+	assert.Equal(t, "hdmi1", dev.Input)
+	require.NotNil(t, dev.Blanked)
+	assert.True(t, *dev.Blanked)
+	require.NotNil(t, dev.Muted)
+	assert.False(t, *dev.Muted)
+	require.NotNil(t, dev.Volume)
+	assert.Equal(t, 30, *dev.Volume)
+}
+
+func TestRestart(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	room, err := shared.GetNewRoom("ITB-1101")
+	require.NoError(t, err)
+	room.Designation = sd.Production
+
+	display, err := shared.GetNewDevice("ITB-1101-D1")
+	require.NoError(t, err)
+	display.Power = "on"
+
+	c := testCache(t, s, []sd.StaticDevice{display}, []sd.StaticRoom{room})
+	_, _, err = c.StoreDeviceEvent(sd.State{ID: "ITB-1101-CP1", Key: "power", Value: "on", Time: time.Now()})
+	require.NoError(t, err)
+	require.NoError(t, c.Close())
+
+	// what was loaded doesn't overwrite what's stored
+	display.Power = "standby"
+	c = testCache(t, s, []sd.StaticDevice{display}, nil)
+
+	devs, err := c.GetAllDeviceRecords()
+	require.NoError(t, err)
+	assert.Len(t, devs, 2)
+
+	stored, err := c.GetDeviceRecord("ITB-1101-D1")
+	require.NoError(t, err)
+	assert.Equal(t, "on", stored.Power)
+
+	rooms, err := c.GetAllRoomRecords()
+	require.NoError(t, err)
+	require.Len(t, rooms, 1)
+	assert.Equal(t, sd.Production, rooms[0].Designation)
+
+	devices, rms := c.Size()
+	assert.Equal(t, 2, devices)
+	assert.Equal(t, 1, rms)
+}
+
+func TestNukeRoom(t *testing.T) {
+	s := miniredis.RunT(t)
+	c := testCache(t, s, nil, nil)
+
+	for _, id := range []string{"ITB-1101-D1", "ITB-1101-CP1", "ITB-11010-D1"} {
+		_, _, err := c.StoreDeviceEvent(sd.State{ID: id, Key: "power", Value: "on", Time: time.Now()})
+		require.NoError(t, err)
+	}
+
+	_, _, err := c.CheckAndStoreRoom(sd.StaticRoom{RoomID: "ITB-1101"})
+	require.NoError(t, err)
+
+	devs, err := c.GetRoomDeviceRecords("ITB-1101")
+	require.NoError(t, err)
+	assert.Len(t, devs, 2)
+
+	removed, err := c.NukeRoom("ITB-1101")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"ITB-1101-D1", "ITB-1101-CP1"}, removed)
+
+	room, err := c.GetRoomRecord("ITB-1101")
+	require.NoError(t, err)
+	assert.Empty(t, room.RoomID)
+
+	devs, err = c.GetAllDeviceRecords()
+	require.NoError(t, err)
+	require.Len(t, devs, 1)
+	assert.Equal(t, "ITB-11010-D1", devs[0].DeviceID)
+}
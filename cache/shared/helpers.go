@@ -13,6 +13,7 @@ import (
 	"github.com/byuoitav/event-forwarding-microservice/config"
 	"github.com/byuoitav/event-forwarding-microservice/events"
 	"github.com/byuoitav/event-forwarding-microservice/forwarding"
+	"github.com/byuoitav/event-forwarding-microservice/metrics"
 	sd "github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
 )
 
@@ -85,6 +86,14 @@ func updateHeartbeat(v events.Event, c Cache) {
 
 // ForwardAndStoreEvent .
 func ForwardAndStoreEvent(v events.Event, c Cache) (bool, error) {
+	//once the device has been stored, update the room it's in
+	added := false
+	defer func() {
+		if _, err := StoreRoomFromEvent(v, c, added); err != nil {
+			slog.Debug("unable to store room from event", "error", err)
+		}
+	}()
+
 	if len(v.GeneratingSystem) > 0 && !events.ContainsAnyTags(v, events.Heartbeat) {
 		// Try if we can
 		updateHeartbeat(v, c)
@@ -102,6 +111,11 @@ func ForwardAndStoreEvent(v events.Event, c Cache) (bool, error) {
 		return false, nil
 	}
 
+	//a device that isn't cached yet changes its room's device count
+	if existing, err := c.GetDeviceRecord(v.TargetDevice.DeviceID); err == nil && len(existing.DeviceID) == 0 {
+		added = true
+	}
+
 	//Cache
 	changes, newDev, err := c.StoreDeviceEvent(sd.State{
 		ID:    v.TargetDevice.DeviceID,
@@ -115,6 +129,10 @@ func ForwardAndStoreEvent(v events.Event, c Cache) (bool, error) {
 		return false, fmt.Errorf("Couldn't store and forward device event: %w", err)
 	}
 
+	if changes {
+		metrics.StateChanged(c.GetCacheName(), v.Key)
+	}
+
 	list := forwarding.GetManagersForType(config.DEVICE, config.ALL)
 	for i := range list {
 		list[i].Send(newDev)
@@ -207,6 +225,20 @@ func SetDeviceField(key string, value interface{}, updateTime time.Time, t sd.St
 		s := strings.Split(key, ".")
 
 		t.Alerts[s[1]] = v
+
+		// the device is alerting while any of its alerts are
+		alerting := false
+		for _, a := range t.Alerts {
+			alerting = alerting || a.Alerting
+		}
+		t.Alerting = &alerting
+
+		if t.UpdateTimes == nil {
+			t.UpdateTimes = make(map[string]time.Time)
+		}
+		t.UpdateTimes[key] = updateTime
+		t.UpdateTimes["alerting"] = updateTime
+
 		return true, t, nil
 	}
 
@@ -0,0 +1,100 @@
+package shared
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	sd "github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
+)
+
+// MaintenanceWindow is a change to a room's maintenance mode
+type MaintenanceWindow struct {
+	// Until is when maintenance mode ends, the zero time keeps it on until it's turned off
+	Until time.Time `json:"until"`
+
+	// AlertsToSuppress replaces the room's suppressed alerts if it isn't nil
+	AlertsToSuppress []string `json:"alerts-to-suppress"`
+}
+
+// SetMaintenance puts a room in maintenance mode until w.Until, so alerts on its devices are masked. It returns the updated room.
+func SetMaintenance(c Cache, roomID string, w MaintenanceWindow, now time.Time) (sd.StaticRoom, error) {
+	if !w.Until.IsZero() && !w.Until.After(now) {
+		return sd.StaticRoom{}, errors.New("maintenance mode must end in the future")
+	}
+
+	on, off := true, false
+	room := sd.StaticRoom{
+		RoomID:                 roomID,
+		MaintenenceMode:        &on,
+		MaintenenceModeEndTime: w.Until,
+		Monitoring:             &off,
+		UpdateTimes: map[string]time.Time{
+			"maintenence-mode":       now,
+			"maintenence-mode-until": now,
+			"monitoring":             now,
+		},
+	}
+
+	if w.AlertsToSuppress != nil {
+		room.AlertsToSupress = w.AlertsToSuppress
+		room.UpdateTimes["alerts-to-supress"] = now
+	}
+
+	_, updated, err := c.CheckAndStoreRoom(room)
+	if err != nil {
+		return sd.StaticRoom{}, fmt.Errorf("couldn't set maintenance mode on %v: %w", roomID, err)
+	}
+
+	return updated, nil
+}
+
+// EndMaintenance takes a room out of maintenance mode and back to monitoring. It returns the updated room.
+func EndMaintenance(c Cache, roomID string, now time.Time) (sd.StaticRoom, error) {
+	on, off := true, false
+	room := sd.StaticRoom{
+		RoomID:          roomID,
+		MaintenenceMode: &off,
+		Monitoring:      &on,
+		UpdateTimes: map[string]time.Time{
+			"maintenence-mode": now,
+			"monitoring":       now,
+		},
+	}
+
+	_, updated, err := c.CheckAndStoreRoom(room)
+	if err != nil {
+		return sd.StaticRoom{}, fmt.Errorf("couldn't end maintenance mode on %v: %w", roomID, err)
+	}
+
+	return updated, nil
+}
+
+// ExpireMaintenance ends maintenance mode on every room in c whose end time has passed.
+// The room changes are forwarded to the room delta forwarders. It returns the IDs of the rooms that were changed.
+func ExpireMaintenance(c Cache, now time.Time) ([]string, error) {
+	rooms, err := c.GetAllRoomRecords()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't expire maintenance mode: %w", err)
+	}
+
+	expired := []string{}
+	var errs []error
+
+	for i := range rooms {
+		if !rooms[i].MaintenanceExpired(now) {
+			continue
+		}
+
+		if _, err := EndMaintenance(c, rooms[i].RoomID, now); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		slog.Info("Maintenance mode expired", "roomID", rooms[i].RoomID, "until", rooms[i].MaintenenceModeEndTime)
+		expired = append(expired, rooms[i].RoomID)
+	}
+
+	return expired, errors.Join(errs...)
+}
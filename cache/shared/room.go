@@ -5,6 +5,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/byuoitav/event-forwarding-microservice/events"
 	sd "github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
 )
 
@@ -22,3 +23,187 @@ func GetNewRoom(id string) (sd.StaticRoom, error) {
 	}
 	return room, nil
 }
+
+// systemTypes maps the device types that make up a system to the room's system type
+var systemTypes = map[string]string{
+	"control-processor": sd.Pi,
+	"dmps":              sd.DMPS,
+	"scheduling-panel":  sd.Scheduling,
+	"timeclock":         sd.Timeclock,
+}
+
+// RoomDeviceGetter is implemented by caches that can look up the devices in a room without reading every device
+type RoomDeviceGetter interface {
+	GetRoomDeviceRecords(roomID string) ([]sd.StaticDevice, error)
+}
+
+// getRoomDevices returns the devices whose IDs start with the room ID
+func getRoomDevices(c Cache, roomID string) ([]sd.StaticDevice, error) {
+	if g, ok := c.(RoomDeviceGetter); ok {
+		return g.GetRoomDeviceRecords(roomID)
+	}
+
+	devs, err := c.GetAllDeviceRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	toReturn := []sd.StaticDevice{}
+	for i := range devs {
+		if strings.HasPrefix(devs[i].DeviceID, roomID+"-") {
+			toReturn = append(toReturn, devs[i])
+		}
+	}
+	return toReturn, nil
+}
+
+// getSystemType returns the room system type a device is a part of, if any
+func getSystemType(deviceID string) string {
+	if len(strings.Split(deviceID, "-")) != 3 {
+		return ""
+	}
+	return systemTypes[GetDeviceTypeByID(deviceID)]
+}
+
+/*
+StoreRoomFromEvent creates the room an event affects if it isn't in the cache yet, and updates the fields derived from events:
+the system types seen in the room, when the last (non heartbeat) event happened, how many devices it has, and if any of them are alerting.
+
+Counting the room's devices means reading all of them, so it's only done when the room hasn't been counted yet or added is true,
+i.e. the event added a device to the cache. Alerting changes and removed devices go through RefreshRoom instead.
+
+The room is only stored, and forwarded, if one of those fields changed.
+*/
+func StoreRoomFromEvent(v events.Event, c Cache, added bool) (bool, error) {
+	roomID := v.AffectedRoom.RoomID
+	if len(roomID) == 0 {
+		roomID = v.TargetDevice.RoomID
+	}
+	if len(roomID) == 0 {
+		return false, nil
+	}
+
+	now := time.Now()
+	update, err := GetNewRoom(roomID)
+	if err != nil {
+		return false, fmt.Errorf("couldn't store room from event: %w", err)
+	}
+
+	room, err := c.GetRoomRecord(roomID)
+	if err != nil {
+		return false, fmt.Errorf("couldn't store room from event: %w", err)
+	}
+
+	changes := false
+	if len(room.RoomID) == 0 {
+		update.UpdateTimes["building"] = now
+		update.UpdateTimes["room"] = now
+		changes = true
+	}
+
+	//last activity
+	if !events.ContainsAnyTags(v, events.Heartbeat) && v.Key != "auto-heartbeat" {
+		ts := v.Timestamp
+		if ts.IsZero() {
+			ts = now
+		}
+
+		if ts.After(room.LastActivity) {
+			update.LastActivity = ts
+			update.UpdateTimes["last-activity"] = ts
+			changes = true
+		}
+	}
+
+	//system types
+	types := append([]string{}, room.SystemType...)
+	for _, id := range []string{v.GeneratingSystem, v.TargetDevice.DeviceID} {
+		t := getSystemType(id)
+		if len(t) > 0 && !HasTag(t, types) {
+			types = append(types, t)
+		}
+	}
+	if len(types) != len(room.SystemType) {
+		update.SystemType = types
+		update.UpdateTimes["system-type"] = now
+		changes = true
+	}
+
+	devChanges := false
+	if added || room.DeviceCount == nil {
+		devChanges, err = deriveDeviceFields(c, room, &update, now)
+		if err != nil {
+			return false, fmt.Errorf("couldn't store room from event: %w", err)
+		}
+	}
+
+	if !changes && !devChanges {
+		return false, nil
+	}
+
+	changes, _, err = c.CheckAndStoreRoom(update)
+	if err != nil {
+		return false, fmt.Errorf("couldn't store room from event: %w", err)
+	}
+	return changes, nil
+}
+
+// RefreshRoom recomputes the fields a room derives from its devices, e.g. after one of the devices starts or stops alerting or is removed
+func RefreshRoom(c Cache, roomID string, now time.Time) (bool, error) {
+	room, err := c.GetRoomRecord(roomID)
+	if err != nil {
+		return false, fmt.Errorf("couldn't refresh room %v: %w", roomID, err)
+	}
+	if len(room.RoomID) == 0 {
+		return false, nil
+	}
+
+	update := sd.StaticRoom{
+		RoomID:      roomID,
+		UpdateTimes: make(map[string]time.Time),
+	}
+
+	changes, err := deriveDeviceFields(c, room, &update, now)
+	if err != nil {
+		return false, fmt.Errorf("couldn't refresh room %v: %w", roomID, err)
+	}
+	if !changes {
+		return false, nil
+	}
+
+	changes, _, err = c.CheckAndStoreRoom(update)
+	if err != nil {
+		return false, fmt.Errorf("couldn't refresh room %v: %w", roomID, err)
+	}
+	return changes, nil
+}
+
+// deriveDeviceFields sets the device count and alerting fields on update if they differ from those on room
+func deriveDeviceFields(c Cache, room sd.StaticRoom, update *sd.StaticRoom, now time.Time) (bool, error) {
+	devs, err := getRoomDevices(c, update.RoomID)
+	if err != nil {
+		return false, err
+	}
+
+	count := len(devs)
+	alerting := false
+	for i := range devs {
+		if devs[i].Alerting != nil && *devs[i].Alerting {
+			alerting = true
+			break
+		}
+	}
+
+	changes := false
+	if room.DeviceCount == nil || *room.DeviceCount != count {
+		update.DeviceCount = &count
+		update.UpdateTimes["device-count"] = now
+		changes = true
+	}
+	if room.Alerting == nil || *room.Alerting != alerting {
+		update.Alerting = &alerting
+		update.UpdateTimes["alerting"] = now
+		changes = true
+	}
+	return changes, nil
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/byuoitav/event-forwarding-microservice/cache"
+	"github.com/byuoitav/event-forwarding-microservice/config"
+	"github.com/byuoitav/event-forwarding-microservice/events"
+	"github.com/byuoitav/event-forwarding-microservice/forwarding"
+	"github.com/byuoitav/event-forwarding-microservice/helpers"
+	"github.com/byuoitav/event-forwarding-microservice/replay"
+)
+
+// replayOptions are the replay subcommand's flags
+type replayOptions struct {
+	from, to  string
+	rate      float64
+	forwarder string
+	dryRun    bool
+	cacheName string
+
+	// how long to spend flushing forwarders when it's done
+	shutdownTimeout time.Duration
+}
+
+// replayReport is what the replay subcommand prints when it's done
+type replayReport struct {
+	replay.Report
+
+	// for a dry run
+	Changes []replay.DeviceChange `json:"changes,omitempty"`
+
+	// for everything else
+	Shutdown *helpers.ShutdownReport `json:"shutdown,omitempty"`
+}
+
+/*
+runReplay replays the events in the files at paths. By default they go through the event stream, so they're stored in the cache
+and forwarded as if they had just come from the hub. They can go straight to a single forwarder instead, or be checked against the cache
+in a dry run that prints what would change without changing or forwarding anything. A dry run works on a memory cache loaded from the
+cache's storage, so it doesn't touch the real cache. It returns the exit code for the process.
+*/
+func runReplay(location string, paths []string, o replayOptions) int {
+	if len(paths) == 0 {
+		fmt.Fprintf(os.Stderr, "nothing to replay, give a file (or - for stdin)\n")
+		return 2
+	}
+
+	opts := replay.Options{Rate: o.rate}
+	var err error
+	if opts.From, err = parseReplayTime(o.from); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid --from: %v\n", err)
+		return 2
+	}
+	if opts.To, err = parseReplayTime(o.to); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid --to: %v\n", err)
+		return 2
+	}
+	if o.dryRun && len(o.forwarder) > 0 {
+		fmt.Fprintf(os.Stderr, "--dry-run and --forwarder can't be used together\n")
+		return 2
+	}
+
+	config.SetLocation(location)
+	c, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+
+	c, err = replayConfig(c, o)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+
+	var sources []io.Reader
+	for _, path := range paths {
+		source, err := replay.Open(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 2
+		}
+		defer source.Close()
+
+		sources = append(sources, source)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// forwarders first, so anything the caches push while they're loading goes to them
+	forwarding.ApplyConfig(c)
+
+	var send func(events.Event) error
+	var dryRun *replay.DryRun
+	switch {
+	case o.dryRun:
+		i, ok := findCache(c, o.cacheName)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "cache %q doesn't exist\n", o.cacheName)
+			return 2
+		}
+
+		// a copy of what's in storage, so a dry run never writes to the real cache
+		ch, err := cache.LoadMemoryCache(i)
+		if ch == nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 2
+		}
+		defer ch.Close()
+
+		if err != nil {
+			slog.Warn("Couldn't load all of the cache from storage, the dry run is against what could be loaded", "cache", i.Name, "error", err)
+		}
+
+		dryRun = replay.NewDryRun(ch)
+		send = dryRun.Send
+	case len(o.forwarder) > 0:
+		m, ok := forwarding.GetManager(o.forwarder)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "forwarder %q couldn't be started\n", o.forwarder)
+			return 2
+		}
+
+		send = func(event events.Event) error {
+			return m.Send(event)
+		}
+	default:
+		// the service the events are replayed into already runs the caches' crons
+		cache.DisableCrons()
+		cache.ApplyConfig(c)
+
+		fm := helpers.GetForwardManager()
+		fm.EventCache = o.cacheName
+		go fm.Start(context.Background())
+
+		send = func(event events.Event) error {
+			select {
+			case fm.EventStream <- event:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+
+	var report replayReport
+	var errs []error
+
+	report.Report, err = replay.Run(ctx, sources, opts, send)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("replay stopped early: %w", err))
+	}
+	stop()
+
+	// flush what was replayed
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), o.shutdownTimeout)
+	defer cancel()
+
+	switch {
+	case dryRun != nil:
+		report.Changes = dryRun.Changes()
+		if _, err := forwarding.Close(shutdownCtx); err != nil {
+			errs = append(errs, err)
+		}
+	case len(o.forwarder) > 0:
+		results, err := forwarding.Close(shutdownCtx)
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		shutdown := helpers.ShutdownReport{Forwarders: results}
+		for _, result := range results {
+			shutdown.Flushed += result.Flushed
+			shutdown.Abandoned += result.Abandoned
+		}
+		report.Shutdown = &shutdown
+	default:
+		shutdown, err := helpers.Shutdown(shutdownCtx)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		report.Shutdown = &shutdown
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
+
+	if err := errors.Join(errs...); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if report.Failed > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+/*
+replayConfig trims c down to what a replay needs. Write ahead logs are turned off, since they belong to the running service.
+A dry run doesn't have any forwarders, and a replay to a single forwarder only has that one.
+*/
+func replayConfig(c config.Config, o replayOptions) (config.Config, error) {
+	var forwarders []config.Forwarder
+	for _, f := range c.Forwarders {
+		if o.dryRun || (len(o.forwarder) > 0 && f.Name != o.forwarder) {
+			continue
+		}
+
+		f.WAL = config.WALConfig{}
+		forwarders = append(forwarders, f)
+	}
+
+	if len(o.forwarder) > 0 && len(forwarders) == 0 {
+		return c, fmt.Errorf("forwarder %q isn't in the config", o.forwarder)
+	}
+
+	c.Forwarders = forwarders
+	return c, nil
+}
+
+// findCache returns the config for the cache called name
+func findCache(c config.Config, name string) (config.Cache, bool) {
+	for _, i := range c.Caches {
+		if i.Name == name {
+			return i, true
+		}
+	}
+
+	return config.Cache{}, false
+}
+
+// parseReplayTime parses an RFC 3339 time or a date, an empty string is the zero time
+func parseReplayTime(s string) (time.Time, error) {
+	if len(s) == 0 {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	return time.ParseInLocation("2006-01-02", s, time.Local)
+}
+
+// replayLogger logs to stderr, so stdout is just the report
+func replayLogger(level string) *slog.Logger {
+	lvl, err := stringToLogLevel(level)
+	if err != nil {
+		lvl = slog.LevelInfo
+	}
+
+	return slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: lvl}))
+}
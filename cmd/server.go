@@ -2,29 +2,76 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"log/slog"
 
 	"github.com/byuoitav/central-event-system/hub/base"
 	"github.com/byuoitav/central-event-system/messenger"
 
+	"github.com/byuoitav/event-forwarding-microservice/alerts"
+	"github.com/byuoitav/event-forwarding-microservice/api"
+	"github.com/byuoitav/event-forwarding-microservice/config"
 	"github.com/byuoitav/event-forwarding-microservice/events"
 	"github.com/byuoitav/event-forwarding-microservice/helpers"
+	"github.com/byuoitav/event-forwarding-microservice/metrics"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/pflag"
 )
 
 var logger *slog.Logger
 
 func main() {
-	var port, logLev string
+	var port, logLev, configLocation, adminToken string
+	var configRefresh, shutdownTimeout, maxHubDowntime time.Duration
+	var maxForwarderFailures int
 	pflag.StringVarP(&port, "port", "p", "8333", "port for microservice to av-api communication")
 	pflag.StringVarP(&logLev, "log", "l", "Info", "Initial log level")
+	pflag.StringVarP(&configLocation, "config", "c", os.Getenv("SERVICE_CONFIG_LOCATION"), "location of the service config: a file path, http(s)://, s3://bucket/key, or couch://database/id. Defaults to service-config.json in AWS_BUCKET_NAME")
+	pflag.DurationVar(&configRefresh, "config-refresh", 0, "how often to reload the service config, 0 disables periodic reloads")
+	pflag.DurationVar(&shutdownTimeout, "shutdown-timeout", 25*time.Second, "how long to spend flushing forwarders on shutdown before abandoning what's left")
+	pflag.IntVar(&maxForwarderFailures, "max-forwarder-failures", 5, "how many sends in a row a forwarder can fail before /readyz reports it")
+	pflag.DurationVar(&maxHubDowntime, "max-hub-downtime", 5*time.Minute, "how long the hub can be disconnected before /healthz reports it")
+	pflag.StringVar(&adminToken, "admin-token", os.Getenv("ADMIN_TOKEN"), "bearer token required by the admin endpoints, they're disabled if it's empty")
+
+	var replayOpts replayOptions
+	pflag.StringVar(&replayOpts.from, "from", "", "replay: only replay events at or after this time (RFC 3339 or YYYY-MM-DD)")
+	pflag.StringVar(&replayOpts.to, "to", "", "replay: only replay events before this time (RFC 3339 or YYYY-MM-DD)")
+	pflag.Float64Var(&replayOpts.rate, "rate", 0, "replay: most events to replay a second, 0 is unlimited")
+	pflag.StringVar(&replayOpts.forwarder, "forwarder", "", "replay: send events straight to this forwarder instead of through the cache")
+	pflag.BoolVar(&replayOpts.dryRun, "dry-run", false, "replay: report what would change in the cache without changing it or forwarding anything")
+	pflag.StringVar(&replayOpts.cacheName, "cache", "default", "replay: the cache events are stored in, or checked against in a dry run")
+
+	pflag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %v [flags]\n       %v validate [location]\n       %v replay [flags] file...\n\nFlags:\n", os.Args[0], os.Args[0], os.Args[0])
+		pflag.PrintDefaults()
+	}
 	pflag.Parse()
 
+	switch pflag.Arg(0) {
+	case "":
+	case "validate":
+		if pflag.NArg() > 1 {
+			configLocation = pflag.Arg(1)
+		}
+		os.Exit(validate(configLocation))
+	case "replay":
+		slog.SetDefault(replayLogger(logLev))
+		replayOpts.shutdownTimeout = shutdownTimeout
+		os.Exit(runReplay(configLocation, pflag.Args()[1:], replayOpts))
+	default:
+		pflag.Usage()
+		os.Exit(2)
+	}
+
 	port = ":" + port
 	logLevel := new(slog.LevelVar)
 
@@ -32,8 +79,20 @@ func main() {
 	slog.SetDefault(logger)
 
 	setLogLevel(logLev, logLevel)
+	config.SetLocation(configLocation)
+
+	if _, err := config.Load(); err != nil {
+		logger.Error("failed to load config", "error", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go helpers.GetForwardManager().Start(context.Background())
+	go watchConfig(configRefresh)
+	go alerts.Run(ctx)
 
-	go helpers.GetForwardManager().Start(context.TODO())
 	// connect to the hub
 	messenger, err := messenger.BuildMessenger(os.Getenv("HUB_ADDRESS"), base.Messenger, 5000)
 	if err != nil {
@@ -42,12 +101,27 @@ func main() {
 	}
 
 	// get events from the hub
+	received := make(chan events.Event)
 	go func() {
 		messenger.SubscribeToRooms("*")
 
 		for {
 			// the messenger comes from the central-event-system, which is dependent on /common/v2/events
-			processEvent(events.ConvertV2ToCommon(messenger.ReceiveEvent()))
+			received <- events.ConvertV2ToCommon(messenger.ReceiveEvent())
+		}
+	}()
+
+	intakeDone := make(chan struct{})
+	go func() {
+		defer close(intakeDone)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-received:
+				processEvent(event)
+			}
 		}
 	}()
 
@@ -64,6 +138,50 @@ func main() {
 		})
 	})
 
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+	thresholds := helpers.HealthThresholds{
+		MaxForwarderFailures: maxForwarderFailures,
+		MaxHubDowntime:       maxHubDowntime,
+	}
+
+	hubState := func() string {
+		state, _ := messenger.GetState().(map[string]interface{})
+		s, _ := state["state"].(string)
+		return s
+	}
+
+	router.GET("/healthz", func(c *gin.Context) {
+		respondHealth(c, helpers.CheckLiveness(hubState(), thresholds))
+	})
+
+	router.GET("/readyz", func(c *gin.Context) {
+		respondHealth(c, helpers.CheckReadiness(hubState(), thresholds))
+	})
+
+	router.GET("/cache/:name/devices", api.GetDevices)
+	router.GET("/cache/:name/devices/:id", api.GetDevice)
+	router.GET("/cache/:name/rooms", api.GetRooms)
+	router.GET("/cache/:name/rooms/:id", api.GetRoom)
+	router.GET("/cache/:name/rooms/:id/devices", api.GetRoomDevices)
+
+	admin := router.Group("", api.RequireToken(adminToken))
+	admin.POST("/config/reload", func(c *gin.Context) {
+		if err := helpers.ReloadConfig(); err != nil {
+			logger.Error("can not reload config", "error", err)
+			c.JSON(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "config reloaded",
+		})
+	})
+	admin.DELETE("/cache/:name/devices/:id", api.DeleteDevice)
+	admin.DELETE("/cache/:name/rooms/:id", api.NukeRoom)
+	admin.PUT("/cache/:name/rooms/:id/maintenance", api.SetMaintenance)
+	admin.DELETE("/cache/:name/rooms/:id/maintenance", api.EndMaintenance)
+
 	router.GET("/logLevel/:level", func(context *gin.Context) {
 		err := setLogLevel(context.Param("level"), logLevel)
 		if err != nil {
@@ -82,13 +200,85 @@ func main() {
 		})
 	})
 
-	router.Run(port)
+	server := &http.Server{
+		Addr:    port,
+		Handler: router,
+	}
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("failed to start server", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	logger.Info("Shutting down", "timeout", shutdownTimeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// stop taking events from the hub, then flush everything we have
+	messenger.Kill()
+	<-intakeDone
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("failed to shut down server", "error", err)
+	}
+
+	report, shutdownErr := helpers.Shutdown(shutdownCtx)
+	if shutdownErr != nil {
+		logger.Error("failed to flush everything before shutting down", "error", shutdownErr)
+	}
+
+	logger.Info("Shut down", "flushed", report.Flushed, "abandoned", report.Abandoned, "eventsAbandoned", report.EventsAbandoned)
+	if shutdownErr != nil {
+		os.Exit(1)
+	}
+}
+
+// respondHealth writes a health report, with a 503 if something is degraded
+func respondHealth(c *gin.Context, report helpers.HealthReport) {
+	if len(report.Problems) > 0 {
+		c.JSON(http.StatusServiceUnavailable, report)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
 }
 
 func processEvent(event events.Event) {
+	metrics.EventReceived(event)
 	helpers.GetForwardManager().EventStream <- event
 }
 
+// watchConfig reloads the config on SIGHUP, and every interval if interval is greater than 0
+func watchConfig(interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-hup:
+			logger.Info("Received SIGHUP, reloading config")
+		case <-tick:
+			logger.Debug("Reloading config on interval")
+		}
+
+		if err := helpers.ReloadConfig(); err != nil {
+			logger.Error("can not reload config", "error", err)
+		}
+	}
+}
+
 func setLogLevel(level string, logLevel *slog.LevelVar) error {
 	lvl, err := stringToLogLevel(level)
 	if err != nil {
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/byuoitav/event-forwarding-microservice/config"
+)
+
+// validate checks the config at location without starting the service, printing each problem found.
+// It returns the exit code for the process.
+func validate(location string) int {
+	source, err := config.GetSource(location)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+
+	b, err := source.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+
+	c, err := config.Parse(b)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v: %v\n", source.String(), err)
+		return 1
+	}
+
+	err = config.Validate(c)
+	if err == nil {
+		fmt.Printf("%v is valid\n", source.String())
+		return 0
+	}
+
+	var joined interface{ Unwrap() []error }
+	if errors.As(err, &joined) {
+		for _, e := range joined.Unwrap() {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", source.String(), e)
+		}
+	} else {
+		fmt.Fprintf(os.Stderr, "%v: %v\n", source.String(), err)
+	}
+
+	return 1
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// CONST
+const (
+	//Alert Rule Types
+
+	ALERTSTALE  = "stale"
+	ALERTABOVE  = "above"
+	ALERTBELOW  = "below"
+	ALERTDURING = "during"
+)
+
+// AlertsConfig is the rules the alert engine checks each device in a cache against
+type AlertsConfig struct {
+	//Cache to check, defaults to the first cache
+	CacheName string `json:"cache-name"`
+
+	//Interval in seconds between checks, the engine is off if this is 0
+	Interval int `json:"interval"`
+
+	Rules []AlertRule `json:"rules"`
+}
+
+// AlertRule raises the alert Name on a device while its condition is true, and clears it once it isn't.
+// Devices that don't have Field set are skipped.
+type AlertRule struct {
+	//The alert is stored on the device as alerts.<name>
+	Name string `json:"name"`
+
+	//Supported Values:
+	//stale - Field, a time, is more than Minutes old
+	//above, below - Field, a number, is above or below Threshold
+	//during - Field is Value between Start and End
+	Type string `json:"type"`
+
+	//Field in the device to check, defaults to last-heartbeat for stale
+	Field string `json:"field"`
+
+	Minutes   int     `json:"minutes"`
+	Threshold float64 `json:"threshold"`
+	Value     string  `json:"value"`
+
+	//Local times of day, e.g. 22:00 and 06:00. The window wraps past midnight if End is before Start
+	Start string `json:"start"`
+	End   string `json:"end"`
+
+	//Device types the rule applies to, all of them if this is empty
+	DeviceTypes []string `json:"device-types"`
+
+	//Message on the alert, defaults to a description of the condition
+	Message string `json:"message"`
+
+	//Severity of the alert in room issues
+	//Supported Values:
+	//Critical, Warning (default), Low
+	Severity string `json:"severity"`
+}
+
+// ParseTimeOfDay parses a time of day like 22:00 into how long after midnight it is
+func ParseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a time of day, must be like 22:00", s)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
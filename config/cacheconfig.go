@@ -1,13 +1,26 @@
 package config
 
+// CONST
+const (
+	//Cache Types
+
+	MEMORY = "memory"
+	REDIS  = "redis"
+)
+
 //Cache .
 type Cache struct {
 	Name string `json:"name"`
 
-	//Persistence type
+	//Persistence type, where the cache is loaded from when it starts
+	//Supported Values:
+	//elk: the device-index and room-index in elk-cache
+	//couch: the devices and rooms in the database in couch-cache
 	StorageType string `json:"storage-type"`
 
-	//Legacy or Defautl
+	//Supported Values:
+	//memory: each instance keeps its own cache
+	//redis: the cache is kept in redis, so it can be shared between instances and survives restarts
 	CacheType string `json:"cache-type"`
 
 	CouchInfo CouchCache `json:"couch-cache"`
@@ -26,6 +39,15 @@ type ElkCache struct {
 	DeviceIndex string `json:"device-index"`
 	RoomIndex   string `json:"room-index"`
 	URL         string `json:"url"`
+
+	//How many records to load at a time, defaults to 1000
+	PageSize int `json:"page-size"`
+
+	//Seconds to wait for each page, defaults to 30
+	Timeout int `json:"timeout"`
+
+	//How failed pages are retried
+	Retry RetryConfig `json:"retry"`
 }
 
 //RedisCache .
@@ -33,5 +55,5 @@ type RedisCache struct {
 	DevDatabase  int    `json:"device-database"`
 	RoomDatabase int    `json:"room-database"`
 	Password     string `json:"password"`
-	URL          string `json:"url"`
+	URL          string `json:"url"` //host:port, or a redis:// URL
 }
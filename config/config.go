@@ -1,22 +1,17 @@
 package config
 
 import (
-	"encoding/json"
-	"io/ioutil"
+	"fmt"
 	"log/slog"
 	"os"
 	"strings"
 	"sync"
-
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
 )
 
 var once sync.Once
 
-var c Config
+// location is where the config is loaded from, see GetSource
+var location = os.Getenv("SERVICE_CONFIG_LOCATION")
 
 const (
 	//Couch .
@@ -37,79 +32,85 @@ const (
 
 // Config .
 type Config struct {
-	Forwarders []Forwarder `json:"forwarders"`
-	Caches     []Cache     `json:"caches"`
+	Forwarders []Forwarder  `json:"forwarders"`
+	Caches     []Cache      `json:"caches"`
+	Alerts     AlertsConfig `json:"alerts"`
 }
 
 var config Config
+var configLock sync.RWMutex
 
 // GetConfig .
 func GetConfig() Config {
 	once.Do(func() {
-		getConfigFile()
+		c, err := loadConfig()
+		if err != nil {
+			slog.Error("Couldn't load config", "error", err)
+			return
+		}
+
+		if err := Validate(c); err != nil {
+			slog.Error("Invalid config", "error", err)
+		}
+
+		configLock.Lock()
+		config = c
+		configLock.Unlock()
 	})
+
+	configLock.RLock()
+	defer configLock.RUnlock()
 	return config
 }
 
-// Retrieves the config file from AWS S3
-func getConfigFile() {
-	awsAccessKey := os.Getenv("AWS_ACCESS_KEY")
-	awsSecretKey := os.Getenv("AWS_SECRET_KEY")
-	if len(awsAccessKey) == 0 {
-		slog.Error("ERROR: AWS_ACCESS_KEY not set")
-	}
-	if len(awsSecretKey) == 0 {
-		slog.Error("ERROR: AWS_SECRET_KEY not set")
-	}
-	awsRegion := "us-west-2"
+// Load reads and validates the config from its location and makes it the current config.
+// If the config can't be loaded or isn't valid the current config is kept and an error is returned.
+func Load() (Config, error) {
+	// make sure the lazy initial load in GetConfig doesn't overwrite this one
+	once.Do(func() {})
 
-	creds := credentials.NewStaticCredentials(awsAccessKey, awsSecretKey, "")
-	awsConfig := &aws.Config{
-		Region:      aws.String(awsRegion),
-		Credentials: creds,
+	c, err := loadConfig()
+	if err != nil {
+		return Config{}, err
 	}
 
-	sess, err := session.NewSession(awsConfig)
-	if err != nil {
-		slog.Error("Error creating AWS session:", "error", err)
-		return
+	if err := Validate(c); err != nil {
+		return Config{}, fmt.Errorf("invalid config: %w", err)
 	}
 
-	// Create S3 service client
-	svc := s3.New(sess)
+	configLock.Lock()
+	config = c
+	configLock.Unlock()
 
-	bucketName := os.Getenv("AWS_BUCKET_NAME") // "av-microservices-configs" in the dev environment
-	if len(bucketName) == 0 {
-		slog.Error("ERROR: AWS_BUCKET_NAME not set")
-	}
-	objectPath := "service-config.json"
+	slog.Info("Config loaded", "forwarders", len(c.Forwarders), "caches", len(c.Caches))
+	return c, nil
+}
 
-	params := &s3.GetObjectInput{
-		Bucket: aws.String(bucketName),
-		Key:    aws.String(objectPath),
-	}
+// SetLocation sets where the config file is loaded from, overriding SERVICE_CONFIG_LOCATION. See GetSource for supported locations.
+func SetLocation(l string) {
+	location = l
+}
 
-	resp, err := svc.GetObject(params)
+// loadConfig loads the config file from the configured location
+func loadConfig() (Config, error) {
+	source, err := GetSource(location)
 	if err != nil {
-		slog.Error("Error getting object from bucket:", "objectPath", objectPath, "bucketName", bucketName, "error", err)
-		return
+		return Config{}, fmt.Errorf("couldn't get config source %q: %w", location, err)
 	}
-	defer resp.Body.Close()
 
-	// Read config file
-	b, err := ioutil.ReadAll(resp.Body)
+	slog.Info("Loading config", "source", source.String())
+
+	b, err := source.Load()
 	if err != nil {
-		slog.Error("Error reading object from bucket:", "objectPath", objectPath, "bucketName", bucketName, "error", err)
-		return
+		return Config{}, fmt.Errorf("couldn't load config from %v: %w", source.String(), err)
 	}
 
-	// Unmarshal config file
-	err = json.Unmarshal(b, &config)
+	c, err := Parse(b)
 	if err != nil {
-		slog.Error("Error unmarshalling object from bucket:", "objectPath", objectPath, "bucketName", bucketName, "error", err)
-		return
+		return Config{}, fmt.Errorf("couldn't parse config from %v: %w", source.String(), err)
 	}
 
+	return c, nil
 }
 
 // Contains .
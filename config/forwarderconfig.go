@@ -1,5 +1,10 @@
 package config
 
+import (
+	"encoding/json"
+	"text/template"
+)
+
 // CONST
 const (
 	//Event Types
@@ -12,6 +17,7 @@ const (
 	DEVICE = "device"
 	ROOM   = "room"
 	EVENT  = "event"
+	ISSUE  = "issue"
 
 	//Cache Types
 
@@ -25,6 +31,10 @@ const (
 	COUCH         = "couch"
 	WEBSOCKET     = "websocket"
 	HUMIO         = "humio"
+	WEBHOOK       = "webhook"
+	SPLUNK        = "splunk"
+	LOKI          = "loki"
+	FILE          = "file"
 
 	//Rotation Intervals
 
@@ -33,6 +43,39 @@ const (
 	MONTHLY  = "monthly"
 	YEARLY   = "yearly"
 	NOROTATE = "norotate"
+
+	//Dead Letter Types
+
+	DEADLETTERLOG  = "log"
+	DEADLETTERFILE = "file"
+	DEADLETTERELK  = "elk"
+
+	//Write Ahead Log Full Policies
+
+	WALDROPOLDEST = "drop-oldest"
+	WALDROPNEWEST = "drop-newest"
+
+	//Write Ahead Log Sync Policies
+
+	WALSYNCBATCH    = "batch"
+	WALSYNCALWAYS   = "always"
+	WALSYNCINTERVAL = "interval"
+
+	//Transform Types
+
+	TRANSFORMDROP        = "drop"
+	TRANSFORMRENAME      = "rename"
+	TRANSFORMREDACT      = "redact"
+	TRANSFORMFLATTEN     = "flatten"
+	TRANSFORMADD         = "add"
+	TRANSFORMDERIVE      = "derive"
+	TRANSFORMELKSANITIZE = "elk-sanitize"
+
+	//Derive Functions
+
+	DERIVEDEVICETYPE = "device-type"
+	DERIVEBUILDING   = "building"
+	DERIVEROOM       = "room"
 )
 
 //Forwarder .
@@ -40,7 +83,7 @@ type Forwarder struct {
 	Name string `json:"name"`
 
 	//SupportedValues:
-	//elkstatic, elktimeseries, couch, humio
+	//elkstatic, elktimeseries, couch, humio, webhook, splunk, loki, file
 	Type string `json:"type"`
 
 	//Supported Values:
@@ -51,16 +94,100 @@ type Forwarder struct {
 	Interval int `json:"interval"`
 
 	//Supported Values:
-	//device, event
+	//device, room, event, issue
 	DataType string `json:"data-type"`
 
 	//Supported Values;
 	//legacy, default
 	CacheName string `json:"cache-name"`
 
-	Couch CouchForwarder `json:"couch"`
-	Elk   ElkForwarder   `json:"elk"`
-	Humio HumioForwarder `json:"humio"`
+	Couch   CouchForwarder   `json:"couch"`
+	Elk     ElkForwarder     `json:"elk"`
+	Humio   HumioForwarder   `json:"humio"`
+	Webhook WebhookForwarder `json:"webhook"`
+	Splunk  SplunkForwarder  `json:"splunk"`
+	Loki    LokiForwarder    `json:"loki"`
+	File    FileForwarder    `json:"file"`
+
+	WAL WALConfig `json:"wal"`
+
+	Filter FilterConfig `json:"filter"`
+
+	//Applied in order to each document before it's sent
+	Transforms []TransformConfig `json:"transforms"`
+}
+
+// TransformConfig is a step in a forwarder's transform chain. Fields are paths into the document, e.g. target-device.deviceID
+type TransformConfig struct {
+	//Supported Values:
+	//drop, rename, redact, flatten, add, derive, elk-sanitize
+	Type string `json:"type"`
+
+	//for drop, redact (defaults to user), and flatten
+	Fields []string `json:"fields"`
+
+	//for rename, old field to new field
+	Rename map[string]string `json:"rename"`
+
+	//for redact, what to replace the value with (defaults to REDACTED), or a hash of the value if Hash is set
+	Value string `json:"value"`
+	Hash  bool   `json:"hash"`
+
+	//for flatten, put between the field name and its keys (defaults to _)
+	Separator string `json:"separator"`
+
+	//for add, fields to set
+	Values map[string]interface{} `json:"values"`
+
+	//for derive, set Field to the result of Function on the value of From
+	//Supported Functions:
+	//device-type, building, room
+	Field    string `json:"field"`
+	From     string `json:"from"`
+	Function string `json:"function"`
+}
+
+// FilterConfig limits what is sent to a forwarder. Something is sent if it matches everything in Include,
+// nothing in Exclude, and Expression. Leaving them all empty sends everything.
+type FilterConfig struct {
+	Include FilterMatch `json:"include"`
+	Exclude FilterMatch `json:"exclude"`
+
+	//A boolean expression, e.g. tags == "user-generated" && designation == "production"
+	Expression string `json:"expression"`
+}
+
+// FilterMatch is a set of conditions. Lists match if any of their values match.
+type FilterMatch struct {
+	Tags              []string `json:"tags"`
+	Buildings         []string `json:"buildings"`
+	Rooms             []string `json:"rooms"`
+	DeviceTypes       []string `json:"device-types"`
+	Key               string   `json:"key"` //a regular expression
+	GeneratingSystems []string `json:"generating-systems"`
+	Designations      []string `json:"designations"`
+}
+
+// WALConfig keeps what a forwarder has buffered in a log on disk until it's sent, so it's replayed after a restart
+type WALConfig struct {
+	//Directory to keep the log in, one per forwarder. The log is off if this is empty
+	Directory string `json:"directory"`
+
+	//Max size of the log in megabytes, 0 is unlimited
+	MaxSize int `json:"max-size"`
+
+	//What to do when the log reaches MaxSize
+	//Supported Values:
+	//drop-oldest (default), drop-newest
+	FullPolicy string `json:"full-policy"`
+
+	//When the log is synced to disk
+	//Supported Values:
+	//batch (default) each time the buffer is sent, always after every item, interval every SyncInterval seconds
+	Sync string `json:"sync"`
+
+	//Seconds between syncs when Sync is interval, defaults to 1
+	SyncInterval int `json:"sync-interval"`
 }
 
 //CouchForwader .
@@ -78,6 +205,34 @@ type ElkForwarder struct {
 	//Supported Values:
 	//daily, weekly, monthly, yearly
 	IndexRotationInterval string `json:"index-rotation-interval"`
+
+	Retry      RetryConfig      `json:"retry"`
+	DeadLetter DeadLetterConfig `json:"dead-letter"`
+}
+
+// RetryConfig controls how failed bulk requests are retried, unset values use the defaults
+type RetryConfig struct {
+	//Number of times to retry a failed item, -1 disables retries
+	MaxRetries int `json:"max-retries"`
+
+	//Seconds to wait before the first retry, doubles every retry up to MaxBackoff
+	InitialBackoff int `json:"initial-backoff"`
+	MaxBackoff     int `json:"max-backoff"`
+}
+
+// DeadLetterConfig is where items that can't be sent end up
+type DeadLetterConfig struct {
+	//Supported Values:
+	//log (default), file, elk
+	Type string `json:"type"`
+
+	//for the file type, the file to append failed items to
+	Path string `json:"path"`
+
+	//for the elk type, the index to put failed items in. Defaults to the forwarder's url
+	URL                   string `json:"url"`
+	IndexPattern          string `json:"index-pattern"`
+	IndexRotationInterval string `json:"index-rotation-interval"`
 }
 
 type HumioForwarder struct {
@@ -85,3 +240,91 @@ type HumioForwarder struct {
 	BufferSize  int    `json:"buffer-size"`
 	IngestToken string `json:"ingest-token"`
 }
+
+// WebhookForwarder POSTs items to a URL. Header values, the bearer token, the password, and the hmac secret can be read from the environment with ENV <name>
+type WebhookForwarder struct {
+	URL string `json:"url"`
+
+	//Most items to send in one request, as a JSON array. 0 sends each item in its own request
+	BatchSize int `json:"batch-size"`
+
+	Headers map[string]string `json:"headers"`
+
+	//Auth, either a bearer token or basic auth
+	BearerToken string `json:"bearer-token"`
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+
+	//A go template for the body, executed with .DataType, .Items, and .Item (the first item). Defaults to the item, or items, as JSON
+	Template string `json:"template"`
+
+	//If set, the body is signed with HMAC-SHA256 and the hex signature sent in SignatureHeader (defaults to X-Signature) as sha256=<signature>
+	HMACSecret      string `json:"hmac-secret"`
+	SignatureHeader string `json:"signature-header"`
+
+	//Seconds to wait for a response, defaults to 10
+	Timeout int `json:"timeout"`
+
+	//How failed requests are retried
+	Retry RetryConfig `json:"retry"`
+}
+
+// SplunkForwarder sends to a splunk HTTP Event Collector. The token can be read from the environment with ENV <name>
+type SplunkForwarder struct {
+	//The collector's base URL, e.g. https://splunk.byu.edu:8088
+	URL   string `json:"url"`
+	Token string `json:"token"`
+
+	//Optional, the token's defaults are used if they're empty
+	Index  string `json:"index"`
+	Source string `json:"source"`
+	Host   string `json:"host"`
+
+	//Max amount of items that can be stored in a buffer before it is sent early
+	BufferSize int `json:"buffer-size"`
+}
+
+// LokiForwarder pushes events to grafana loki. The password can be read from the environment with ENV <name>
+type LokiForwarder struct {
+	//Loki's base URL, e.g. http://loki.byu.edu:3100
+	URL string `json:"url"`
+
+	//Optional, sent as X-Scope-OrgID
+	TenantID string `json:"tenant-id"`
+
+	//Optional, basic auth
+	Username string `json:"username"`
+	Password string `json:"password"`
+
+	//Added to every stream along with building, device_type, and tags. Defaults to job: event-forwarder
+	Labels map[string]string `json:"labels"`
+
+	//Max amount of events that can be stored in a buffer before it is sent early
+	BufferSize int `json:"buffer-size"`
+}
+
+// FileForwarder writes newline delimited json files to a directory, named <file-pattern>-<date>.jsonl
+type FileForwarder struct {
+	Directory   string `json:"directory"`
+	FilePattern string `json:"file-pattern"`
+
+	//Supported Values:
+	//daily, weekly, monthly, yearly, norotate
+	RotationInterval string `json:"rotation-interval"`
+
+	//Gzip files once they've been rotated
+	Compress bool `json:"compress"`
+
+	//How many files to keep, including the one being written to. 0 keeps all of them
+	Retention int `json:"retention"`
+}
+
+// ParseWebhookTemplate parses a webhook's body template. Besides the usual template functions, json marshals a value to a string
+func ParseWebhookTemplate(s string) (*template.Template, error) {
+	return template.New("webhook").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(s)
+}
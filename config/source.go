@@ -0,0 +1,215 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/byuoitav/event-forwarding-microservice/couch"
+)
+
+// DefaultObjectPath is the name of the config file in the s3 bucket
+const DefaultObjectPath = "service-config.json"
+
+// Source is somewhere the service config can be loaded from
+type Source interface {
+	Load() ([]byte, error)
+	String() string
+}
+
+// GetSource returns the source for the given location. Supported locations are:
+//
+//	/path/to/service-config.json or file:///path/to/service-config.json
+//	http(s)://host/path/to/service-config.json
+//	s3://bucket/path/to/service-config.json
+//	couch://database/document-id (uses DB_ADDRESS, DB_USERNAME, and DB_PASSWORD)
+//
+// If location is empty, the config is pulled from AWS_BUCKET_NAME in s3.
+func GetSource(location string) (Source, error) {
+	if len(location) == 0 {
+		bucketName := os.Getenv("AWS_BUCKET_NAME") // "av-microservices-configs" in the dev environment
+		if len(bucketName) == 0 {
+			return nil, fmt.Errorf("no config location given and AWS_BUCKET_NAME not set")
+		}
+
+		return &S3Source{Bucket: bucketName, Key: DefaultObjectPath}, nil
+	}
+
+	u, err := url.Parse(location)
+	if err != nil || len(u.Scheme) <= 1 { // a one letter scheme is a windows drive
+		return &FileSource{Path: location}, nil
+	}
+
+	switch u.Scheme {
+	case "file":
+		return &FileSource{Path: u.Path}, nil
+	case "http", "https":
+		return &HTTPSource{URL: location}, nil
+	case "s3":
+		key := strings.TrimPrefix(u.Path, "/")
+		if len(key) == 0 {
+			key = DefaultObjectPath
+		}
+
+		return &S3Source{Bucket: u.Host, Key: key}, nil
+	case "couch":
+		id := strings.Trim(u.Path, "/")
+		if len(u.Host) == 0 || len(id) == 0 {
+			return nil, fmt.Errorf("invalid couch config location %q: must be couch://database/document-id", location)
+		}
+
+		return &CouchSource{Database: u.Host, ID: id}, nil
+	default:
+		return nil, fmt.Errorf("unsupported config location scheme %q", u.Scheme)
+	}
+}
+
+// FileSource reads the config from a local file
+type FileSource struct {
+	Path string
+}
+
+// Load .
+func (f *FileSource) Load() ([]byte, error) {
+	b, err := os.ReadFile(f.Path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read config file %v: %w", f.Path, err)
+	}
+
+	return b, nil
+}
+
+func (f *FileSource) String() string {
+	return "file://" + f.Path
+}
+
+// HTTPSource gets the config with a GET request to the URL
+type HTTPSource struct {
+	URL string
+}
+
+// Load .
+func (h *HTTPSource) Load() ([]byte, error) {
+	client := http.Client{
+		Timeout: 10 * time.Second,
+	}
+
+	resp, err := client.Get(h.URL)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get config from %v: %w", h.URL, err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read config from %v: %w", h.URL, err)
+	}
+
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("non 200 response code received getting config from %v. code: %v, body: %s", h.URL, resp.StatusCode, b)
+	}
+
+	return b, nil
+}
+
+func (h *HTTPSource) String() string {
+	return h.URL
+}
+
+// S3Source pulls the config from an s3 bucket using AWS_ACCESS_KEY and AWS_SECRET_KEY
+type S3Source struct {
+	Bucket string
+	Key    string
+}
+
+// Load .
+func (s *S3Source) Load() ([]byte, error) {
+	awsAccessKey := os.Getenv("AWS_ACCESS_KEY")
+	awsSecretKey := os.Getenv("AWS_SECRET_KEY")
+	if len(awsAccessKey) == 0 || len(awsSecretKey) == 0 {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY or AWS_SECRET_KEY not set")
+	}
+	awsRegion := "us-west-2"
+
+	creds := credentials.NewStaticCredentials(awsAccessKey, awsSecretKey, "")
+	awsConfig := &aws.Config{
+		Region:      aws.String(awsRegion),
+		Credentials: creds,
+	}
+
+	sess, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create AWS session: %w", err)
+	}
+
+	// Create S3 service client
+	svc := s3.New(sess)
+
+	params := &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(s.Key),
+	}
+
+	resp, err := svc.GetObject(params)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get %v from bucket %v: %w", s.Key, s.Bucket, err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read %v from bucket %v: %w", s.Key, s.Bucket, err)
+	}
+
+	return b, nil
+}
+
+func (s *S3Source) String() string {
+	return fmt.Sprintf("s3://%v/%v", s.Bucket, s.Key)
+}
+
+// CouchSource reads the config from a document in couch
+type CouchSource struct {
+	Database string
+	ID       string
+}
+
+// Load .
+func (c *CouchSource) Load() ([]byte, error) {
+	addr := os.Getenv("DB_ADDRESS")
+	if len(addr) == 0 {
+		return nil, fmt.Errorf("DB_ADDRESS is not set")
+	}
+
+	b, err := couch.MakeRequest(fmt.Sprintf("%v/%v/%v", strings.Trim(addr, "/"), c.Database, url.PathEscape(c.ID)), http.MethodGet, []byte{})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get config document %v from %v: %w", c.ID, c.Database, err)
+	}
+
+	// strip couch's own fields (_id, _rev, etc.) so the document parses as a config
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("couldn't unmarshal config document %v from %v: %w", c.ID, c.Database, err)
+	}
+
+	for k := range doc {
+		if strings.HasPrefix(k, "_") {
+			delete(doc, k)
+		}
+	}
+
+	return json.Marshal(doc)
+}
+
+func (c *CouchSource) String() string {
+	return fmt.Sprintf("couch://%v/%v", c.Database, c.ID)
+}
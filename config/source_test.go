@@ -0,0 +1,155 @@
+package config
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetSource(t *testing.T) {
+	tests := []struct {
+		location string
+		source   Source
+	}{
+		{"/etc/service-config.json", &FileSource{Path: "/etc/service-config.json"}},
+		{"service-config.json", &FileSource{Path: "service-config.json"}},
+		{`C:\config\service-config.json`, &FileSource{Path: `C:\config\service-config.json`}},
+		{"file:///etc/service-config.json", &FileSource{Path: "/etc/service-config.json"}},
+		{"https://example.com/service-config.json", &HTTPSource{URL: "https://example.com/service-config.json"}},
+		{"s3://av-configs/event-forwarder/config.json", &S3Source{Bucket: "av-configs", Key: "event-forwarder/config.json"}},
+		{"s3://av-configs", &S3Source{Bucket: "av-configs", Key: DefaultObjectPath}},
+		{"couch://configs/event-forwarder", &CouchSource{Database: "configs", ID: "event-forwarder"}},
+	}
+
+	for _, tt := range tests {
+		source, err := GetSource(tt.location)
+		if assert.NoError(t, err, tt.location) {
+			assert.Equal(t, tt.source, source, tt.location)
+		}
+	}
+
+	_, err := GetSource("couch://configs")
+	assert.Error(t, err)
+	_, err = GetSource("ftp://example.com/service-config.json")
+	assert.Error(t, err)
+
+	t.Setenv("AWS_BUCKET_NAME", "")
+	_, err = GetSource("")
+	assert.Error(t, err)
+
+	t.Setenv("AWS_BUCKET_NAME", "av-microservices-configs")
+	source, err := GetSource("")
+	require.NoError(t, err)
+	assert.Equal(t, &S3Source{Bucket: "av-microservices-configs", Key: DefaultObjectPath}, source)
+	assert.Equal(t, "s3://av-microservices-configs/service-config.json", source.String())
+}
+
+func TestFileSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "service-config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"caches": []}`), 0644))
+
+	b, err := (&FileSource{Path: path}).Load()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"caches": []}`, string(b))
+
+	_, err = (&FileSource{Path: path + ".missing"}).Load()
+	assert.Error(t, err)
+}
+
+func TestHTTPSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/service-config.json" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Write([]byte(`{"caches": []}`))
+	}))
+	defer server.Close()
+
+	b, err := (&HTTPSource{URL: server.URL + "/service-config.json"}).Load()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"caches": []}`, string(b))
+
+	_, err = (&HTTPSource{URL: server.URL + "/missing.json"}).Load()
+	assert.Error(t, err)
+}
+
+func TestS3SourceCredentials(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY", "")
+	t.Setenv("AWS_SECRET_KEY", "")
+
+	_, err := (&S3Source{Bucket: "av-configs", Key: DefaultObjectPath}).Load()
+	assert.ErrorContains(t, err, "AWS_ACCESS_KEY")
+}
+
+func TestCouchSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/configs/event-forwarder" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Write([]byte(`{"_id": "event-forwarder", "_rev": "1-abc", "caches": [{"name": "default", "cache-type": "memory"}]}`))
+	}))
+	defer server.Close()
+
+	t.Setenv("DB_ADDRESS", server.URL+"/")
+
+	b, err := (&CouchSource{Database: "configs", ID: "event-forwarder"}).Load()
+	require.NoError(t, err)
+
+	// couch's own fields are stripped, so it parses strictly
+	c, err := Parse(b)
+	require.NoError(t, err)
+	require.Len(t, c.Caches, 1)
+	assert.Equal(t, "default", c.Caches[0].Name)
+
+	_, err = (&CouchSource{Database: "configs", ID: "missing"}).Load()
+	assert.Error(t, err)
+
+	t.Setenv("DB_ADDRESS", "")
+	_, err = (&CouchSource{Database: "configs", ID: "event-forwarder"}).Load()
+	assert.Error(t, err)
+}
+
+func TestLoad(t *testing.T) {
+	prev := location
+	defer SetLocation(prev)
+
+	dir := t.TempDir()
+	write := func(name string, c interface{}) string {
+		b, err := json.Marshal(c)
+		require.NoError(t, err)
+
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, b, 0644))
+		return path
+	}
+
+	SetLocation(write("valid.json", validConfig()))
+	c, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, validConfig(), c)
+	assert.Equal(t, validConfig(), GetConfig())
+
+	// an invalid config doesn't replace the current one
+	invalid := validConfig()
+	invalid.Forwarders[0].Type = "elktimseries"
+	SetLocation(write("invalid.json", invalid))
+	_, err = Load()
+	assert.Error(t, err)
+	assert.Equal(t, validConfig(), GetConfig())
+
+	// neither does one that can't be loaded
+	SetLocation(filepath.Join(dir, "missing.json"))
+	_, err = Load()
+	assert.Error(t, err)
+	assert.Equal(t, validConfig(), GetConfig())
+}
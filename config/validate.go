@@ -0,0 +1,438 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/byuoitav/event-forwarding-microservice/filter"
+)
+
+var (
+	validCacheTypes   = []string{MEMORY, REDIS}
+	validStorageTypes = []string{"", Elk, Couch}
+	validEventTypes   = []string{ALL, DELTA}
+	validRotations    = []string{DAILY, WEEKLY, MONTHLY, YEARLY, NOROTATE}
+
+	validDeadLetters = []string{"", DEADLETTERLOG, DEADLETTERFILE, DEADLETTERELK}
+
+	validForwarderTypes = []string{ELKSTATIC, ELKTIMESERIES, COUCH, WEBSOCKET, HUMIO, WEBHOOK, SPLUNK, LOKI, FILE}
+
+	validWALPolicies = []string{"", WALDROPOLDEST, WALDROPNEWEST}
+	validWALSyncs    = []string{"", WALSYNCBATCH, WALSYNCALWAYS, WALSYNCINTERVAL}
+
+	validAlertRules = []string{ALERTSTALE, ALERTABOVE, ALERTBELOW, ALERTDURING}
+	validSeverities = []string{"", "Critical", "Warning", "Low"}
+
+	// walForwarderTypes is the forwarder types that can keep a write ahead log
+	walForwarderTypes = []string{ELKSTATIC, ELKTIMESERIES, COUCH, HUMIO, WEBHOOK, SPLUNK, LOKI}
+
+	validTransforms      = []string{TRANSFORMDROP, TRANSFORMRENAME, TRANSFORMREDACT, TRANSFORMFLATTEN, TRANSFORMADD, TRANSFORMDERIVE, TRANSFORMELKSANITIZE}
+	validDeriveFunctions = []string{DERIVEDEVICETYPE, DERIVEBUILDING, DERIVEROOM}
+
+	// transformForwarderTypes is the forwarder types that can transform what they send
+	transformForwarderTypes = []string{ELKSTATIC, ELKTIMESERIES, WEBSOCKET, HUMIO, WEBHOOK, SPLUNK, LOKI, FILE}
+
+	// validDataTypes is the data types each forwarder type can handle
+	validDataTypes = map[string][]string{
+		ELKSTATIC:     {DEVICE, ROOM, ISSUE},
+		ELKTIMESERIES: {EVENT},
+		COUCH:         {DEVICE},
+		WEBSOCKET:     {DEVICE, ROOM, EVENT, ISSUE},
+		HUMIO:         {DEVICE, ROOM, EVENT, ISSUE},
+		WEBHOOK:       {DEVICE, ROOM, EVENT, ISSUE},
+		SPLUNK:        {DEVICE, EVENT},
+		LOKI:          {EVENT},
+		FILE:          {DEVICE, ROOM, EVENT},
+	}
+
+	// lokiLabelName is what loki allows label names to look like
+	lokiLabelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// ValidationError is a single problem found in a config
+type ValidationError struct {
+	Path    string
+	Message string
+}
+
+func (v ValidationError) Error() string {
+	return fmt.Sprintf("%v: %v", v.Path, v.Message)
+}
+
+// Parse strictly unmarshals a config, unknown fields are an error
+func Parse(b []byte) (Config, error) {
+	var c Config
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&c); err != nil {
+		return Config{}, fmt.Errorf("couldn't parse config: %w", err)
+	}
+
+	return c, nil
+}
+
+// Validate checks the config, returning an error that joins a ValidationError for each problem found
+func Validate(c Config) error {
+	var errs []error
+	add := func(path, format string, a ...interface{}) {
+		errs = append(errs, ValidationError{Path: path, Message: fmt.Sprintf(format, a...)})
+	}
+
+	caches := make(map[string]bool)
+	for i, cache := range c.Caches {
+		path := fmt.Sprintf("caches[%d]", i)
+
+		switch {
+		case len(cache.Name) == 0:
+			add(path+".name", "is required")
+		case caches[cache.Name]:
+			add(path+".name", "duplicate cache name %q", cache.Name)
+		}
+		caches[cache.Name] = true
+
+		if !Contains(validCacheTypes, cache.CacheType) {
+			add(path+".cache-type", "unknown value %q, must be one of %v", cache.CacheType, quoted(validCacheTypes))
+		}
+
+		if !Contains(validStorageTypes, cache.StorageType) {
+			add(path+".storage-type", "unknown value %q, must be one of %v", cache.StorageType, quoted(validStorageTypes))
+		}
+
+		if cache.CacheType == REDIS && len(cache.RedisInfo.URL) == 0 {
+			add(path+".redis-cache.url", "is required")
+		}
+
+		if cache.StorageType == Elk {
+			checkURL(add, path+".elk-cache.url", cache.ELKinfo.URL)
+			if len(cache.ELKinfo.DeviceIndex) == 0 {
+				add(path+".elk-cache.device-index", "is required")
+			}
+			if cache.ELKinfo.PageSize < 0 || cache.ELKinfo.PageSize > 10000 {
+				add(path+".elk-cache.page-size", "must be between 1 and 10000")
+			}
+			if cache.ELKinfo.Timeout < 0 {
+				add(path+".elk-cache.timeout", "can't be negative")
+			}
+		}
+
+		if cache.StorageType == Couch {
+			checkURL(add, path+".couch-cache.url", cache.CouchInfo.URL)
+			if len(cache.CouchInfo.DatabaseName) == 0 {
+				add(path+".couch-cache.database-name", "is required")
+			}
+		}
+	}
+
+	forwarders := make(map[string]bool)
+	walDirs := make(map[string]bool)
+	for i, f := range c.Forwarders {
+		path := fmt.Sprintf("forwarders[%d]", i)
+
+		switch {
+		case len(f.Name) == 0:
+			add(path+".name", "is required")
+		case forwarders[f.Name]:
+			add(path+".name", "duplicate forwarder name %q", f.Name)
+		}
+		forwarders[f.Name] = true
+
+		dataTypes, ok := validDataTypes[f.Type]
+		if !ok {
+			add(path+".type", "unknown value %q, must be one of %v", f.Type, quoted(validForwarderTypes))
+		} else if !Contains(dataTypes, f.DataType) {
+			add(path+".data-type", "unknown value %q for a %v forwarder, must be one of %v", f.DataType, f.Type, quoted(dataTypes))
+		}
+
+		if !Contains(validEventTypes, f.EventType) {
+			add(path+".event-type", "unknown value %q, must be one of %v", f.EventType, quoted(validEventTypes))
+		}
+
+		if len(f.CacheName) > 0 && !caches[f.CacheName] {
+			add(path+".cache-name", "cache %q is not defined", f.CacheName)
+		}
+
+		switch f.Type {
+		case ELKSTATIC, ELKTIMESERIES:
+			checkInterval(add, path+".interval", f.Interval)
+			checkURL(add, path+".elk.url", f.Elk.URL)
+			if len(f.Elk.IndexPattern) == 0 {
+				add(path+".elk.index-pattern", "is required")
+			}
+			if !Contains(validRotations, f.Elk.IndexRotationInterval) {
+				add(path+".elk.index-rotation-interval", "unknown value %q, must be one of %v", f.Elk.IndexRotationInterval, quoted(validRotations))
+			}
+			checkRetry(add, path+".elk.retry", f.Elk.Retry)
+
+			switch f.Elk.DeadLetter.Type {
+			case DEADLETTERFILE:
+				if len(f.Elk.DeadLetter.Path) == 0 {
+					add(path+".elk.dead-letter.path", "is required")
+				}
+			case DEADLETTERELK:
+				if len(f.Elk.DeadLetter.URL) > 0 {
+					checkURL(add, path+".elk.dead-letter.url", f.Elk.DeadLetter.URL)
+				}
+				if len(f.Elk.DeadLetter.IndexPattern) == 0 {
+					add(path+".elk.dead-letter.index-pattern", "is required")
+				}
+				if !Contains(validRotations, f.Elk.DeadLetter.IndexRotationInterval) {
+					add(path+".elk.dead-letter.index-rotation-interval", "unknown value %q, must be one of %v", f.Elk.DeadLetter.IndexRotationInterval, quoted(validRotations))
+				}
+			default:
+				if !Contains(validDeadLetters, f.Elk.DeadLetter.Type) {
+					add(path+".elk.dead-letter.type", "unknown value %q, must be one of %v", f.Elk.DeadLetter.Type, quoted(validDeadLetters))
+				}
+			}
+		case COUCH:
+			checkInterval(add, path+".interval", f.Interval)
+			checkURL(add, path+".couch.url", f.Couch.URL)
+			if len(f.Couch.DatabaseName) == 0 {
+				add(path+".couch.database-name", "is required")
+			}
+		case HUMIO:
+			if f.Humio.Interval <= 0 {
+				checkInterval(add, path+".interval", f.Interval)
+			}
+			if len(f.Humio.IngestToken) == 0 {
+				add(path+".humio.ingest-token", "is required")
+			}
+		case WEBHOOK:
+			checkInterval(add, path+".interval", f.Interval)
+			checkURL(add, path+".webhook.url", f.Webhook.URL)
+			if f.Webhook.BatchSize < 0 {
+				add(path+".webhook.batch-size", "can't be negative")
+			}
+			if f.Webhook.Timeout < 0 {
+				add(path+".webhook.timeout", "can't be negative")
+			}
+			checkRetry(add, path+".webhook.retry", f.Webhook.Retry)
+			if len(f.Webhook.BearerToken) > 0 && len(f.Webhook.Username) > 0 {
+				add(path+".webhook", "can't use both a bearer-token and basic auth")
+			}
+			if _, err := ParseWebhookTemplate(f.Webhook.Template); err != nil {
+				add(path+".webhook.template", "%v", err)
+			}
+		case SPLUNK:
+			checkInterval(add, path+".interval", f.Interval)
+			checkURL(add, path+".splunk.url", f.Splunk.URL)
+			if len(f.Splunk.Token) == 0 {
+				add(path+".splunk.token", "is required")
+			}
+			if f.Splunk.BufferSize < 0 {
+				add(path+".splunk.buffer-size", "can't be negative")
+			}
+		case FILE:
+			checkInterval(add, path+".interval", f.Interval)
+			if len(f.File.Directory) == 0 {
+				add(path+".file.directory", "is required")
+			}
+			if len(f.File.FilePattern) == 0 {
+				add(path+".file.file-pattern", "is required")
+			} else if strings.ContainsAny(f.File.FilePattern, `/\`) {
+				add(path+".file.file-pattern", "can't contain a path separator")
+			}
+			if !Contains(validRotations, f.File.RotationInterval) {
+				add(path+".file.rotation-interval", "unknown value %q, must be one of %v", f.File.RotationInterval, quoted(validRotations))
+			}
+			if f.File.Retention < 0 {
+				add(path+".file.retention", "can't be negative")
+			}
+		case LOKI:
+			checkInterval(add, path+".interval", f.Interval)
+			checkURL(add, path+".loki.url", f.Loki.URL)
+			if f.Loki.BufferSize < 0 {
+				add(path+".loki.buffer-size", "can't be negative")
+			}
+			names := make([]string, 0, len(f.Loki.Labels))
+			for name := range f.Loki.Labels {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			for _, name := range names {
+				if !lokiLabelName.MatchString(name) {
+					add(path+".loki.labels", "%q isn't a valid label name, must match %v", name, lokiLabelName)
+				}
+			}
+		}
+
+		if len(f.WAL.Directory) > 0 {
+			dir := filepath.Clean(f.WAL.Directory)
+			switch {
+			case !Contains(walForwarderTypes, f.Type):
+				add(path+".wal", "a %v forwarder can't have a write ahead log, must be one of %v", f.Type, quoted(walForwarderTypes))
+			case walDirs[dir]:
+				add(path+".wal.directory", "%q is already used by another forwarder", f.WAL.Directory)
+			}
+			walDirs[dir] = true
+
+			if f.WAL.MaxSize < 0 {
+				add(path+".wal.max-size", "can't be negative")
+			}
+			if !Contains(validWALPolicies, f.WAL.FullPolicy) {
+				add(path+".wal.full-policy", "unknown value %q, must be one of %v", f.WAL.FullPolicy, quoted(validWALPolicies))
+			}
+			if !Contains(validWALSyncs, f.WAL.Sync) {
+				add(path+".wal.sync", "unknown value %q, must be one of %v", f.WAL.Sync, quoted(validWALSyncs))
+			}
+			if f.WAL.SyncInterval < 0 {
+				add(path+".wal.sync-interval", "can't be negative")
+			}
+		}
+
+		if _, err := regexp.Compile(f.Filter.Include.Key); err != nil {
+			add(path+".filter.include.key", "invalid regex: %v", err)
+		}
+		if _, err := regexp.Compile(f.Filter.Exclude.Key); err != nil {
+			add(path+".filter.exclude.key", "invalid regex: %v", err)
+		}
+		if len(f.Filter.Expression) > 0 {
+			if _, err := filter.Parse(f.Filter.Expression); err != nil {
+				add(path+".filter.expression", "%v", errors.Unwrap(err))
+			}
+		}
+
+		if len(f.Transforms) > 0 && !Contains(transformForwarderTypes, f.Type) {
+			add(path+".transforms", "a %v forwarder can't have transforms, must be one of %v", f.Type, quoted(transformForwarderTypes))
+		}
+		for j, t := range f.Transforms {
+			validateTransform(add, fmt.Sprintf("%v.transforms[%d]", path, j), t)
+		}
+	}
+
+	validateAlerts(add, c.Alerts, caches)
+
+	return errors.Join(errs...)
+}
+
+func validateAlerts(add func(string, string, ...interface{}), a AlertsConfig, caches map[string]bool) {
+	if a.Interval < 0 {
+		add("alerts.interval", "can't be negative")
+	}
+	if len(a.CacheName) > 0 && !caches[a.CacheName] {
+		add("alerts.cache-name", "cache %q is not defined", a.CacheName)
+	}
+
+	names := make(map[string]bool)
+	for i, r := range a.Rules {
+		path := fmt.Sprintf("alerts.rules[%d]", i)
+
+		switch {
+		case len(r.Name) == 0:
+			add(path+".name", "is required")
+		case strings.Contains(r.Name, "."):
+			add(path+".name", "%q can't contain a '.'", r.Name)
+		case names[r.Name]:
+			add(path+".name", "duplicate alert name %q", r.Name)
+		}
+		names[r.Name] = true
+
+		switch r.Type {
+		case ALERTSTALE:
+			if r.Minutes <= 0 {
+				add(path+".minutes", "must be greater than 0")
+			}
+		case ALERTABOVE, ALERTBELOW:
+			if len(r.Field) == 0 {
+				add(path+".field", "is required")
+			}
+		case ALERTDURING:
+			if len(r.Field) == 0 {
+				add(path+".field", "is required")
+			}
+			if _, err := ParseTimeOfDay(r.Start); err != nil {
+				add(path+".start", "%v", err)
+			}
+			if _, err := ParseTimeOfDay(r.End); err != nil {
+				add(path+".end", "%v", err)
+			}
+		default:
+			add(path+".type", "unknown value %q, must be one of %v", r.Type, quoted(validAlertRules))
+		}
+
+		if !Contains(validSeverities, r.Severity) {
+			add(path+".severity", "unknown value %q, must be one of %v", r.Severity, quoted(validSeverities))
+		}
+	}
+}
+
+func validateTransform(add func(string, string, ...interface{}), path string, t TransformConfig) {
+	switch t.Type {
+	case TRANSFORMDROP, TRANSFORMFLATTEN:
+		if len(t.Fields) == 0 {
+			add(path+".fields", "is required")
+		}
+	case TRANSFORMRENAME:
+		if len(t.Rename) == 0 {
+			add(path+".rename", "is required")
+		}
+		for from, to := range t.Rename {
+			if len(from) == 0 || len(to) == 0 {
+				add(path+".rename", "field names can't be empty")
+				break
+			}
+		}
+	case TRANSFORMADD:
+		if len(t.Values) == 0 {
+			add(path+".values", "is required")
+		}
+	case TRANSFORMDERIVE:
+		if len(t.Field) == 0 {
+			add(path+".field", "is required")
+		}
+		if len(t.From) == 0 {
+			add(path+".from", "is required")
+		}
+		if !Contains(validDeriveFunctions, t.Function) {
+			add(path+".function", "unknown value %q, must be one of %v", t.Function, quoted(validDeriveFunctions))
+		}
+	case TRANSFORMREDACT, TRANSFORMELKSANITIZE:
+	default:
+		add(path+".type", "unknown value %q, must be one of %v", t.Type, quoted(validTransforms))
+	}
+}
+
+func checkURL(add func(string, string, ...interface{}), path, u string) {
+	if len(u) == 0 {
+		add(path, "is required")
+		return
+	}
+
+	parsed, err := url.Parse(u)
+	if err != nil || len(parsed.Scheme) == 0 || len(parsed.Host) == 0 {
+		add(path, "%q is not a valid URL", u)
+	}
+}
+
+func checkInterval(add func(string, string, ...interface{}), path string, interval int) {
+	if interval <= 0 {
+		add(path, "must be greater than 0")
+	}
+}
+
+func checkRetry(add func(string, string, ...interface{}), path string, r RetryConfig) {
+	if r.MaxRetries < -1 {
+		add(path+".max-retries", "must be -1 or greater")
+	}
+	if r.InitialBackoff < 0 || r.MaxBackoff < 0 {
+		add(path, "backoffs can't be negative")
+	}
+}
+
+func quoted(vals []string) string {
+	q := make([]string, len(vals))
+	for i := range vals {
+		q[i] = fmt.Sprintf("%q", vals[i])
+	}
+
+	return strings.Join(q, ", ")
+}
@@ -0,0 +1,229 @@
+package config
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func validConfig() Config {
+	return Config{
+		Caches: []Cache{
+			{
+				Name:        "default",
+				CacheType:   "memory",
+				StorageType: Elk,
+				ELKinfo: ElkCache{
+					DeviceIndex: "oit-static-av-devices-v3",
+					URL:         "http://localhost:9200",
+				},
+			},
+		},
+		Forwarders: []Forwarder{
+			{
+				Name:      "ElkDeltaEvents",
+				Type:      ELKTIMESERIES,
+				EventType: DELTA,
+				DataType:  EVENT,
+				Interval:  10,
+				CacheName: "default",
+				Elk: ElkForwarder{
+					URL:                   "http://localhost:9200",
+					IndexPattern:          "av-delta-events",
+					IndexRotationInterval: MONTHLY,
+				},
+			},
+		},
+	}
+}
+
+func validationPaths(err error) []string {
+	var paths []string
+	var joined interface{ Unwrap() []error }
+	if !errors.As(err, &joined) {
+		return paths
+	}
+
+	for _, e := range joined.Unwrap() {
+		var v ValidationError
+		if errors.As(e, &v) {
+			paths = append(paths, v.Path)
+		}
+	}
+	return paths
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate(validConfig()))
+
+	c := validConfig()
+	c.Forwarders[0].Type = "elktimseries"
+	assert.Equal(t, []string{"forwarders[0].type"}, validationPaths(Validate(c)))
+
+	c = validConfig()
+	c.Forwarders[0].DataType = DEVICE
+	c.Forwarders[0].EventType = "deltas"
+	c.Forwarders[0].Elk.IndexRotationInterval = "hourly"
+	assert.Equal(t, []string{"forwarders[0].data-type", "forwarders[0].event-type", "forwarders[0].elk.index-rotation-interval"}, validationPaths(Validate(c)))
+
+	c = validConfig()
+	c.Forwarders[0].Elk.URL = "localhost"
+	c.Forwarders[0].CacheName = "legacy"
+	assert.Equal(t, []string{"forwarders[0].cache-name", "forwarders[0].elk.url"}, validationPaths(Validate(c)))
+
+	c = validConfig()
+	c.Caches[0].CacheType = REDIS
+	assert.Equal(t, []string{"caches[0].redis-cache.url"}, validationPaths(Validate(c)))
+
+	c.Caches[0].RedisInfo.URL = "localhost:6379"
+	assert.NoError(t, Validate(c))
+
+	c = validConfig()
+	c.Caches[0].ELKinfo.PageSize = 20000
+	c.Caches[0].ELKinfo.Timeout = -1
+	assert.Equal(t, []string{"caches[0].elk-cache.page-size", "caches[0].elk-cache.timeout"}, validationPaths(Validate(c)))
+
+	c = validConfig()
+	c.Caches[0].StorageType = Couch
+	assert.Equal(t, []string{"caches[0].couch-cache.url", "caches[0].couch-cache.database-name"}, validationPaths(Validate(c)))
+
+	c = validConfig()
+	c.Forwarders = append(c.Forwarders, c.Forwarders[0])
+	c.Caches = append(c.Caches, c.Caches[0])
+	assert.Equal(t, []string{"caches[1].name", "forwarders[1].name"}, validationPaths(Validate(c)))
+
+	c = validConfig()
+	c.Forwarders[0].WAL = WALConfig{Directory: "/var/lib/forwarder/events", FullPolicy: "drop-all"}
+	c.Forwarders = append(c.Forwarders, c.Forwarders[0])
+	c.Forwarders[1].Name = "ElkDeltaEventsCopy"
+	c.Forwarders[1].WAL.Directory = "/var/lib/forwarder/events/"
+	c.Forwarders[1].WAL.FullPolicy = WALDROPNEWEST
+	assert.Equal(t, []string{"forwarders[0].wal.full-policy", "forwarders[1].wal.directory"}, validationPaths(Validate(c)))
+
+	c = validConfig()
+	c.Forwarders[0].WAL = WALConfig{Directory: "/var/lib/forwarder/events", Sync: "sometimes", SyncInterval: -1}
+	assert.Equal(t, []string{"forwarders[0].wal.sync", "forwarders[0].wal.sync-interval"}, validationPaths(Validate(c)))
+
+	c = validConfig()
+	c.Forwarders[0].Filter = FilterConfig{
+		Include:    FilterMatch{Key: "^(power"},
+		Expression: `tags == "user-generated" && designation = "production"`,
+	}
+	assert.Equal(t, []string{"forwarders[0].filter.include.key", "forwarders[0].filter.expression"}, validationPaths(Validate(c)))
+
+	c.Forwarders[0].Filter.Include.Key = "^power$"
+	c.Forwarders[0].Filter.Expression = `tags == "user-generated" && designation == "production"`
+	assert.NoError(t, Validate(c))
+
+	c = validConfig()
+	c.Forwarders[0].Transforms = []TransformConfig{
+		{Type: TRANSFORMDROP, Fields: []string{"data"}},
+		{Type: TRANSFORMREDACT},
+		{Type: TRANSFORMDERIVE, Field: "device-type", From: "target-device.deviceID", Function: "type"},
+		{Type: "uppercase"},
+	}
+	assert.Equal(t, []string{"forwarders[0].transforms[2].function", "forwarders[0].transforms[3].type"}, validationPaths(Validate(c)))
+
+	c = validConfig()
+	c.Forwarders[0] = Forwarder{
+		Name:       "CouchDevices",
+		Type:       COUCH,
+		EventType:  ALL,
+		DataType:   DEVICE,
+		Interval:   10,
+		Couch:      CouchForwarder{URL: "http://localhost:5984", DatabaseName: "devices"},
+		Transforms: []TransformConfig{{Type: TRANSFORMELKSANITIZE}},
+	}
+	assert.Equal(t, []string{"forwarders[0].transforms"}, validationPaths(Validate(c)))
+
+	c = validConfig()
+	c.Forwarders[0] = Forwarder{
+		Name:      "WebhookIssues",
+		Type:      WEBHOOK,
+		EventType: ALL,
+		DataType:  ISSUE,
+		Interval:  10,
+		Webhook: WebhookForwarder{
+			URL:         "hooks.example.com",
+			BatchSize:   -1,
+			BearerToken: "ENV HOOK_TOKEN",
+			Username:    "forwarder",
+			Template:    `{"text": "{{.Item.roomID}"}`,
+			Retry:       RetryConfig{MaxRetries: -2},
+		},
+	}
+	assert.Equal(t, []string{"forwarders[0].webhook.url", "forwarders[0].webhook.batch-size", "forwarders[0].webhook.retry.max-retries", "forwarders[0].webhook", "forwarders[0].webhook.template"}, validationPaths(Validate(c)))
+
+	c.Forwarders[0].Webhook = WebhookForwarder{URL: "https://hooks.example.com/alerts", Template: `{"text": {{json .Item.roomID}}}`}
+	assert.NoError(t, Validate(c))
+
+	c = validConfig()
+	c.Forwarders[0] = Forwarder{
+		Name:      "SplunkRooms",
+		Type:      SPLUNK,
+		EventType: ALL,
+		DataType:  ROOM,
+		Interval:  10,
+		Splunk:    SplunkForwarder{URL: "https://splunk.byu.edu:8088"},
+	}
+	assert.Equal(t, []string{"forwarders[0].data-type", "forwarders[0].splunk.token"}, validationPaths(Validate(c)))
+
+	c.Forwarders[0].DataType = DEVICE
+	c.Forwarders[0].Splunk.Token = "ENV SPLUNK_HEC_TOKEN"
+	assert.NoError(t, Validate(c))
+
+	c = validConfig()
+	c.Forwarders[0] = Forwarder{
+		Name:      "LokiEvents",
+		Type:      LOKI,
+		EventType: ALL,
+		DataType:  EVENT,
+		Interval:  10,
+		Loki: LokiForwarder{
+			URL:    "http://localhost:3100",
+			Labels: map[string]string{"job": "av", "device-type": "display", "1env": "prd"},
+		},
+	}
+	assert.Equal(t, []string{"forwarders[0].loki.labels", "forwarders[0].loki.labels"}, validationPaths(Validate(c)))
+
+	c.Forwarders[0].Loki.Labels = map[string]string{"job": "av", "env": "prd"}
+	assert.NoError(t, Validate(c))
+
+	c = validConfig()
+	c.Forwarders[0] = Forwarder{
+		Name:      "FileEvents",
+		Type:      FILE,
+		EventType: ALL,
+		DataType:  EVENT,
+		Interval:  10,
+		File:      FileForwarder{Directory: "/data/archive", FilePattern: "events/av", RotationInterval: "hourly", Retention: -1},
+		WAL:       WALConfig{Directory: "/data/wal/file"},
+	}
+	assert.Equal(t, []string{"forwarders[0].file.file-pattern", "forwarders[0].file.rotation-interval", "forwarders[0].file.retention", "forwarders[0].wal"}, validationPaths(Validate(c)))
+
+	c.Forwarders[0].File = FileForwarder{Directory: "/data/archive", FilePattern: "av-events", RotationInterval: DAILY, Compress: true, Retention: 30}
+	c.Forwarders[0].WAL = WALConfig{}
+	assert.NoError(t, Validate(c))
+
+	c = validConfig()
+	c.Alerts = AlertsConfig{
+		CacheName: "legacy",
+		Interval:  60,
+		Rules: []AlertRule{
+			{Name: "lost-heartbeat", Type: ALERTSTALE, Minutes: 10, Severity: "High"},
+			{Name: "lost-heartbeat", Type: ALERTABOVE},
+			{Name: "power-overnight", Type: ALERTDURING, Field: "power", Value: "on", Start: "22:00", End: "6am"},
+		},
+	}
+	assert.Equal(t, []string{"alerts.cache-name", "alerts.rules[0].severity", "alerts.rules[1].name", "alerts.rules[1].field", "alerts.rules[2].end"}, validationPaths(Validate(c)))
+}
+
+func TestParse(t *testing.T) {
+	_, err := Parse([]byte(`{"forwarders": [{"name": "a", "data_type": "event"}]}`))
+	assert.Error(t, err)
+
+	c, err := Parse([]byte(`{"forwarders": [{"name": "a", "data-type": "event"}]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, EVENT, c.Forwarders[0].DataType)
+}
@@ -0,0 +1,131 @@
+package elk
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// DeadLetterSink stores items that couldn't be sent to ELK
+type DeadLetterSink interface {
+	Write(caller string, items []FailedItem) error
+}
+
+// DeadLetter is the record written to a dead letter sink for each failed item
+type DeadLetter struct {
+	FailedAt time.Time   `json:"failed-at"`
+	Caller   string      `json:"caller"`
+	Status   int         `json:"status,omitempty"`
+	Reason   string      `json:"reason"`
+	Index    string      `json:"index"`
+	ID       string      `json:"id,omitempty"`
+	Delete   bool        `json:"delete,omitempty"`
+	Document interface{} `json:"document,omitempty"`
+}
+
+func toDeadLetters(caller string, items []FailedItem) []DeadLetter {
+	now := time.Now()
+
+	toReturn := make([]DeadLetter, len(items))
+	for i := range items {
+		dl := DeadLetter{
+			FailedAt: now,
+			Caller:   caller,
+			Status:   items[i].Status,
+			Reason:   items[i].Reason,
+			Index:    items[i].Item.Index.Header.Index,
+			ID:       items[i].Item.Index.Header.ID,
+			Document: items[i].Item.Doc,
+		}
+
+		if len(items[i].Item.Delete.Header.Index) > 0 {
+			dl.Index = items[i].Item.Delete.Header.Index
+			dl.ID = items[i].Item.Delete.Header.ID
+			dl.Delete = true
+		}
+
+		toReturn[i] = dl
+	}
+
+	return toReturn
+}
+
+// LogDeadLetterSink logs failed items and drops them
+type LogDeadLetterSink struct{}
+
+// Write .
+func (LogDeadLetterSink) Write(caller string, items []FailedItem) error {
+	for _, dl := range toDeadLetters(caller, items) {
+		slog.Error("Dropping item that couldn't be sent to ELK", "caller", caller, "index", dl.Index, "id", dl.ID, "status", dl.Status, "reason", dl.Reason)
+	}
+
+	return nil
+}
+
+// FileDeadLetterSink appends failed items to a file as newline delimited json
+type FileDeadLetterSink struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// Write .
+func (f *FileDeadLetterSink) Write(caller string, items []FailedItem) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.OpenFile(f.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("couldn't open dead letter file %v: %w", f.Path, err)
+	}
+	defer file.Close()
+
+	enc := json.NewEncoder(file)
+	for _, dl := range toDeadLetters(caller, items) {
+		if err := enc.Encode(dl); err != nil {
+			return fmt.Errorf("couldn't write to dead letter file %v: %w", f.Path, err)
+		}
+	}
+
+	slog.Warn("Wrote items that couldn't be sent to ELK to dead letter file", "caller", caller, "path", f.Path, "items", len(items))
+	return nil
+}
+
+// IndexDeadLetterSink indexes failed items into an ELK index. Documents are stored as strings so they can't cause mapping errors.
+type IndexDeadLetterSink struct {
+	URL   string
+	Index func() string
+}
+
+// Write .
+func (d *IndexDeadLetterSink) Write(caller string, items []FailedItem) error {
+	var toSend []ElkBulkUpdateItem
+	for _, dl := range toDeadLetters(caller, items) {
+		if dl.Document != nil {
+			b, err := json.Marshal(dl.Document)
+			if err != nil {
+				return fmt.Errorf("couldn't marshal dead letter document: %w", err)
+			}
+			dl.Document = string(b)
+		}
+
+		toSend = append(toSend, ElkBulkUpdateItem{
+			Index: ElkUpdateHeader{Header: HeaderIndex{Index: d.Index()}},
+			Doc:   dl,
+		})
+	}
+
+	retry, rejected, err := BulkForward(caller+"-dead-letter", d.URL, "", "", toSend)
+	if err != nil {
+		return fmt.Errorf("couldn't write to dead letter index: %w", err)
+	}
+
+	if len(retry)+len(rejected) > 0 {
+		return fmt.Errorf("couldn't write %v items to dead letter index", len(retry)+len(rejected))
+	}
+
+	return nil
+}
@@ -50,14 +50,39 @@ type HeaderIndex struct {
 	ID    string `json:"_id,omitempty"`
 }
 
-// BulkUpdateResponse there are other types, but we don't worry about them,
-// since we don't really do any smart parsing at this time.
+// BulkUpdateResponse is the response to a bulk request
 type BulkUpdateResponse struct {
 	Errors bool `json:"errors"`
+
+	// Items has one entry per action in the request, keyed by the action (index, delete, etc.)
+	Items []map[string]BulkItemResult `json:"items"`
+}
+
+// BulkItemResult is the result of a single action in a bulk request
+type BulkItemResult struct {
+	Index  string          `json:"_index"`
+	ID     string          `json:"_id"`
+	Status int             `json:"status"`
+	Error  json.RawMessage `json:"error,omitempty"`
 }
 
+// FailedItem is an item that couldn't be sent to ELK
+type FailedItem struct {
+	Item   ElkBulkUpdateItem
+	Status int
+	Reason string
+}
+
+// DefaultTimeout is how long MakeGenericELKRequest waits for a response
+const DefaultTimeout = 3 * time.Second
+
 // MakeGenericELKRequest .
 func MakeGenericELKRequest(addr, method string, body interface{}, user, pass string) ([]byte, error) {
+	return MakeGenericELKRequestWithTimeout(addr, method, body, user, pass, DefaultTimeout)
+}
+
+// MakeGenericELKRequestWithTimeout is MakeGenericELKRequest for requests that need longer than DefaultTimeout, e.g. reading large pages of an index
+func MakeGenericELKRequestWithTimeout(addr, method string, body interface{}, user, pass string, timeout time.Duration) ([]byte, error) {
 	slog.Debug("Making ELK request", "addr", addr)
 
 	if len(user) == 0 || len(pass) == 0 {
@@ -100,7 +125,7 @@ func MakeGenericELKRequest(addr, method string, body interface{}, user, pass str
 	}
 
 	client := http.Client{
-		Timeout: 3 * time.Second,
+		Timeout: timeout,
 	}
 
 	resp, err := client.Do(req)
@@ -135,73 +160,31 @@ func MakeELKRequest(method, endpoint string, body interface{}) ([]byte, error) {
 	return MakeGenericELKRequest(addr, method, body, "", "")
 }
 
-func BulkForward(caller, url, user, pass string, toSend []ElkBulkUpdateItem) {
+// BulkForward sends the items to ELK in a single bulk request. It returns the items that failed and should be retried,
+// and the items ELK rejected outright. If the request itself failed, every item that was sent is returned to be retried.
+// Documents are sent as is, forwarders clean them up with the elk-sanitize transform.
+func BulkForward(caller, url, user, pass string, toSend []ElkBulkUpdateItem) ([]ElkBulkUpdateItem, []FailedItem, error) {
 	if len(toSend) == 0 {
-		return
+		return nil, nil, nil
 	}
 	slog.Info("Sending bulk upsert", "caller", caller, "items", len(toSend))
 
 	slog.Debug("Building payload", "caller", caller)
 	// build our payload
 	payload := []byte{}
+	var rejected []FailedItem
+
+	// sent holds the items in the order they were added to the payload, which is the order of the response items
+	var sent []ElkBulkUpdateItem
 	for i := range toSend {
 		var headerbytes []byte
 		var err error
 
-		// Validate document to prevent empty field names and bad "data" fields
-		if toSend[i].Doc != nil {
-			docJSON, err := json.Marshal(toSend[i].Doc)
-			if err != nil {
-				slog.Error("Couldn't marshal document for elk event bulk update", "caller", caller, "item", toSend[i])
-				continue
-			}
-
-			var docMap map[string]interface{}
-			if err := json.Unmarshal(docJSON, &docMap); err != nil {
-				slog.Error("Couldn't unmarshal document for elk event bulk update", "caller", caller, "item", toSend[i])
-				continue
-			}
-
-			// Fix 'data' field if necessary
-			if dataField, ok := docMap["data"]; ok {
-				switch dataField.(type) {
-				case []interface{}:
-					slog.Warn("Wrapping array-type 'data' field into an object", "caller", caller, "item", toSend[i])
-					docMap["data"] = map[string]interface{}{
-						"values": dataField,
-					}
-				case nil:
-					docMap["data"] = map[string]interface{}{}
-				}
-			}
-
-			// Marshal again to check for empty keys
-			docJSON, err = json.Marshal(docMap)
-			if err != nil {
-				slog.Error("Couldn't marshal fixed document for elk event bulk update", "caller", caller, "item", toSend[i])
-				continue
-			}
-
-			// Check and replace empty field names
-			if bytes.Contains(docJSON, []byte(`"":`)) || bytes.Contains(docJSON, []byte(`"": `)) {
-				slog.Warn("Auto-generating key for empty field names", "caller", caller, "item", toSend[i])
-				docJSON = bytes.Replace(docJSON, []byte(`"":`), []byte(`"AutoGenerated":`), -1)
-				docJSON = bytes.Replace(docJSON, []byte(`"": `), []byte(`"AutoGenerated": `), -1)
-			}
-
-			// Update the document back
-			var fixedDoc interface{}
-			if err := json.Unmarshal(docJSON, &fixedDoc); err != nil {
-				slog.Error("Couldn't unmarshal final fixed document", "caller", caller, "item", toSend[i])
-				continue
-			}
-			toSend[i].Doc = fixedDoc
-		}
-
 		if len(toSend[i].Delete.Header.Index) > 0 { // it's a delete
 			headerbytes, err = json.Marshal(toSend[i].Delete)
 			if err != nil {
 				slog.Error("Couldn't marshal delete header for elk event bulk update", "caller", caller, "item", toSend[i])
+				rejected = append(rejected, FailedItem{Item: toSend[i], Reason: err.Error()})
 				continue
 			}
 			payload = append(payload, headerbytes...)
@@ -210,12 +193,14 @@ func BulkForward(caller, url, user, pass string, toSend []ElkBulkUpdateItem) {
 			headerbytes, err = json.Marshal(toSend[i].Index)
 			if err != nil {
 				slog.Error("Couldn't marshal index header for elk event bulk update", "caller", caller, "item", toSend[i])
+				rejected = append(rejected, FailedItem{Item: toSend[i], Reason: err.Error()})
 				continue
 			}
 
 			bodybytes, err := json.Marshal(toSend[i].Doc)
 			if err != nil {
 				slog.Error("Couldn't marshal document body for elk event bulk update", "caller", caller, "item", toSend[i])
+				rejected = append(rejected, FailedItem{Item: toSend[i], Reason: err.Error()})
 				continue
 			}
 			payload = append(payload, headerbytes...)
@@ -223,6 +208,12 @@ func BulkForward(caller, url, user, pass string, toSend []ElkBulkUpdateItem) {
 			payload = append(payload, bodybytes...)
 			payload = append(payload, '\n')
 		}
+
+		sent = append(sent, toSend[i])
+	}
+
+	if len(sent) == 0 {
+		return nil, rejected, nil
 	}
 
 	payload = append(payload, '\n') // Ensure the final newline
@@ -236,21 +227,47 @@ func BulkForward(caller, url, user, pass string, toSend []ElkBulkUpdateItem) {
 
 	resp, err := MakeGenericELKRequest(addr, "POST", payload, user, pass)
 	if err != nil {
-		slog.Error("Couldn't send bulk update", "caller", caller, "error", err.Error())
-		return
+		return sent, rejected, fmt.Errorf("couldn't send bulk update: %w", err)
 	}
 
 	elkresp := BulkUpdateResponse{}
 	err = json.Unmarshal(resp, &elkresp)
 	if err != nil {
-		slog.Error("Unknown response received from ELK in response to bulk update", "caller", caller, "response", string(resp))
-		return
+		return sent, rejected, fmt.Errorf("unknown response received from ELK in response to bulk update: %s", resp)
+	}
+
+	if !elkresp.Errors {
+		slog.Debug("Successfully sent bulk ELK updates", "caller", caller)
+		return nil, rejected, nil
 	}
 
-	if elkresp.Errors {
-		slog.Error("Errors received from ELK during bulk update", "caller", caller, "response", string(resp))
-		return
+	if len(elkresp.Items) != len(sent) {
+		return sent, rejected, fmt.Errorf("errors received from ELK during bulk update, but got %v response items for %v requests: %s", len(elkresp.Items), len(sent), resp)
 	}
 
-	slog.Debug("Successfully sent bulk ELK updates", "caller", caller)
+	// figure out which items failed, and if they're worth retrying
+	var retry []ElkBulkUpdateItem
+	for i := range elkresp.Items {
+		for _, result := range elkresp.Items[i] {
+			if result.Status/100 == 2 || (result.Status == 404 && len(sent[i].Delete.Header.Index) > 0) {
+				// a delete of something that isn't there isn't a failure
+				continue
+			}
+
+			if retryable(result.Status) {
+				retry = append(retry, sent[i])
+				continue
+			}
+
+			rejected = append(rejected, FailedItem{Item: sent[i], Status: result.Status, Reason: string(result.Error)})
+		}
+	}
+
+	slog.Warn("Errors received from ELK during bulk update", "caller", caller, "retry", len(retry), "rejected", len(rejected))
+	return retry, rejected, nil
+}
+
+// retryable returns true if a bulk item with the given status might succeed if sent again
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
 }
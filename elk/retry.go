@@ -0,0 +1,102 @@
+package elk
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// RetryPolicy controls how failed requests are retried
+type RetryPolicy struct {
+	MaxRetries     int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultRetryPolicy is used for any values left unset in a RetryPolicy
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries:     3,
+	InitialBackoff: 1 * time.Second,
+	MaxBackoff:     30 * time.Second,
+}
+
+// Backoff returns how long to wait before the given retry attempt (starting at 1)
+func (r RetryPolicy) Backoff(attempt int) time.Duration {
+	d := r.InitialBackoff
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if d >= r.MaxBackoff {
+			return r.MaxBackoff
+		}
+	}
+
+	return d
+}
+
+// BulkForwardWithRetry sends the items to ELK, retrying items that fail with exponential backoff.
+// Items that are rejected, still fail after every retry, or are pending when ctx is done are written to deadLetter.
+// It returns the number of items that couldn't be sent.
+func BulkForwardWithRetry(ctx context.Context, caller, url, user, pass string, toSend []ElkBulkUpdateItem, policy RetryPolicy, deadLetter DeadLetterSink) (int, error) {
+	failed := 0
+	pending := toSend
+
+	for attempt := 0; len(pending) > 0; attempt++ {
+		if attempt > 0 {
+			wait := policy.Backoff(attempt)
+			slog.Info("Retrying bulk update", "caller", caller, "attempt", attempt, "items", len(pending), "backoff", wait)
+
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				failed += deadLetterItems(caller, deadLetter, pending, fmt.Sprintf("gave up retrying: %v", ctx.Err()))
+				return failed, fmt.Errorf("couldn't send %v items to ELK: %w", failed, ctx.Err())
+			}
+		}
+
+		retry, rejected, err := BulkForward(caller, url, user, pass, pending)
+		if err != nil {
+			slog.Error("Couldn't send bulk update", "caller", caller, "attempt", attempt, "error", err.Error())
+		}
+
+		if len(rejected) > 0 {
+			failed += len(rejected)
+			if er := deadLetter.Write(caller, rejected); er != nil {
+				slog.Error("Couldn't write rejected items to dead letter sink", "caller", caller, "items", len(rejected), "error", er)
+			}
+		}
+
+		if len(retry) > 0 && attempt >= policy.MaxRetries {
+			reason := "retries exhausted"
+			if err != nil {
+				reason = err.Error()
+			}
+
+			failed += deadLetterItems(caller, deadLetter, retry, reason)
+			break
+		}
+
+		pending = retry
+	}
+
+	if failed > 0 {
+		return failed, fmt.Errorf("couldn't send %v of %v items to ELK", failed, len(toSend))
+	}
+
+	return 0, nil
+}
+
+func deadLetterItems(caller string, deadLetter DeadLetterSink, items []ElkBulkUpdateItem, reason string) int {
+	failed := make([]FailedItem, len(items))
+	for i := range items {
+		failed[i] = FailedItem{Item: items[i], Reason: reason}
+	}
+
+	if err := deadLetter.Write(caller, failed); err != nil {
+		slog.Error("Couldn't write failed items to dead letter sink", "caller", caller, "items", len(failed), "error", err)
+	}
+
+	return len(failed)
+}
@@ -0,0 +1,103 @@
+package elk
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryDeadLetterSink struct {
+	mu    sync.Mutex
+	items []FailedItem
+}
+
+func (m *memoryDeadLetterSink) Write(caller string, items []FailedItem) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.items = append(m.items, items...)
+	return nil
+}
+
+func TestBulkForwardWithRetry(t *testing.T) {
+	username, password = "user", "pass"
+
+	// "retry" fails with a 429 the first time it's sent, "bad" is always rejected with a 400
+	var mu sync.Mutex
+	attempts := make(map[string]int)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		resp := BulkUpdateResponse{}
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			if len(scanner.Bytes()) == 0 {
+				continue
+			}
+
+			var header ElkUpdateHeader
+			json.Unmarshal(scanner.Bytes(), &header)
+			scanner.Scan()
+
+			id := header.Header.ID
+			attempts[id]++
+
+			status := http.StatusCreated
+			switch {
+			case id == "bad":
+				status = http.StatusBadRequest
+			case id == "retry" && attempts[id] == 1:
+				status = http.StatusTooManyRequests
+			}
+
+			if status/100 != 2 {
+				resp.Errors = true
+			}
+			resp.Items = append(resp.Items, map[string]BulkItemResult{"index": {ID: id, Status: status, Error: json.RawMessage(fmt.Sprintf(`{"status":%d}`, status))}})
+		}
+
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	var toSend []ElkBulkUpdateItem
+	for _, id := range []string{"ok", "retry", "bad"} {
+		toSend = append(toSend, ElkBulkUpdateItem{
+			Index: ElkUpdateHeader{Header: HeaderIndex{Index: "test", ID: id}},
+			Doc:   map[string]string{"id": id},
+		})
+	}
+
+	dlq := &memoryDeadLetterSink{}
+	policy := RetryPolicy{MaxRetries: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	failed, err := BulkForwardWithRetry(context.Background(), "test", server.URL, "", "", toSend, policy, dlq)
+	assert.Error(t, err)
+	assert.Equal(t, 1, failed)
+
+	assert.Equal(t, 1, attempts["ok"])
+	assert.Equal(t, 2, attempts["retry"])
+	assert.Equal(t, 1, attempts["bad"])
+
+	if assert.Len(t, dlq.items, 1) {
+		assert.Equal(t, "bad", dlq.items[0].Item.Index.Header.ID)
+		assert.Equal(t, http.StatusBadRequest, dlq.items[0].Status)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	assert.Equal(t, time.Second, policy.Backoff(1))
+	assert.Equal(t, 2*time.Second, policy.Backoff(2))
+	assert.Equal(t, 4*time.Second, policy.Backoff(3))
+	assert.Equal(t, 5*time.Second, policy.Backoff(4))
+}
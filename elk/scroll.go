@@ -0,0 +1,218 @@
+package elk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ScrollOptions controls how Scroll pages through an index
+type ScrollOptions struct {
+	// how many documents to get at a time
+	PageSize int
+
+	// how long to wait for each page
+	Timeout time.Duration
+
+	// how long elk keeps the scroll open between pages
+	KeepAlive time.Duration
+
+	// how failed pages are retried
+	Retry RetryPolicy
+
+	User string
+	Pass string
+}
+
+// DefaultScrollOptions is used for any values left unset in a ScrollOptions
+var DefaultScrollOptions = ScrollOptions{
+	PageSize:  1000,
+	Timeout:   30 * time.Second,
+	KeepAlive: 5 * time.Minute,
+	Retry:     DefaultRetryPolicy,
+}
+
+// ScrollHit is a document returned by Scroll
+type ScrollHit struct {
+	ID     string          `json:"_id"`
+	Source json.RawMessage `json:"_source"`
+}
+
+type scrollResponse struct {
+	ScrollID string `json:"_scroll_id"`
+	Hits     struct {
+		// an object in elk 7+, a number before that
+		Total json.RawMessage `json:"total"`
+		Hits  []ScrollHit     `json:"hits"`
+	} `json:"hits"`
+}
+
+// total returns how many documents matched, or -1 if it isn't known
+func (s scrollResponse) total() int {
+	var total struct {
+		Value int `json:"value"`
+	}
+	if err := json.Unmarshal(s.Hits.Total, &total); err == nil {
+		return total.Value
+	}
+
+	var n int
+	if err := json.Unmarshal(s.Hits.Total, &n); err == nil {
+		return n
+	}
+
+	return -1
+}
+
+// errScrollInterrupted is returned when a page after the first can't be read
+var errScrollInterrupted = errors.New("scroll was interrupted")
+
+/*
+Scroll pages through every document in index, calling fn with each page. The first page is retried according to opts.Retry if the request fails.
+Later pages aren't, since elk may have already moved the scroll past a page that timed out, so the whole scroll is restarted instead
+(up to opts.Retry.MaxRetries times), and fn sees the documents before the failed page again.
+
+Scroll stops at the first page that can't be read or that fn returns an error for, and returns an error if fewer documents were read than matched.
+*/
+func Scroll(ctx context.Context, url, index string, opts ScrollOptions, fn func(hits []ScrollHit) error) error {
+	opts = opts.withDefaults()
+	url = strings.TrimRight(url, "/")
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			wait := opts.Retry.Backoff(attempt)
+			slog.Info("Restarting scroll", "index", index, "attempt", attempt, "backoff", wait)
+
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			}
+		}
+
+		err := scroll(ctx, url, index, opts, fn)
+		if !errors.Is(err, errScrollInterrupted) || attempt >= opts.Retry.MaxRetries {
+			return err
+		}
+		slog.Warn("Scroll was interrupted", "index", index, "attempt", attempt, "error", err)
+	}
+}
+
+// scroll pages through index once, from the start
+func scroll(ctx context.Context, url, index string, opts ScrollOptions, fn func(hits []ScrollHit) error) error {
+	keepAlive := fmt.Sprintf("%ds", int(opts.KeepAlive.Seconds()))
+
+	resp, err := scrollPage(ctx, index, opts.Retry, opts, fmt.Sprintf("%v/%v/_search?scroll=%v", url, index, keepAlive), map[string]interface{}{
+		"size": opts.PageSize,
+		"sort": []string{"_doc"},
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't start scrolling %v: %w", index, err)
+	}
+
+	total := resp.total()
+	scrollID := resp.ScrollID
+	defer func() { clearScroll(url, scrollID, opts) }()
+
+	loaded := 0
+	for page := 1; len(resp.Hits.Hits) > 0; page++ {
+		if err := fn(resp.Hits.Hits); err != nil {
+			return err
+		}
+
+		loaded += len(resp.Hits.Hits)
+		slog.Info("Loaded page from ELK", "index", index, "page", page, "loaded", loaded, "total", total)
+
+		// retrying here could skip a page, so a failure restarts the scroll
+		resp, err = scrollPage(ctx, index, RetryPolicy{}, opts, fmt.Sprintf("%v/_search/scroll", url), map[string]interface{}{
+			"scroll":    keepAlive,
+			"scroll_id": scrollID,
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't get page %v of %v: %w: %w", page+1, index, errScrollInterrupted, err)
+		}
+
+		if len(resp.ScrollID) > 0 {
+			scrollID = resp.ScrollID
+		}
+	}
+
+	if total >= 0 && loaded < total {
+		return fmt.Errorf("scroll of %v ended early, only loaded %v of %v documents", index, loaded, total)
+	}
+
+	return nil
+}
+
+// scrollPage gets a page, retrying with backoff until it succeeds, the retries run out, or ctx is done
+func scrollPage(ctx context.Context, index string, retry RetryPolicy, opts ScrollOptions, addr string, body interface{}) (scrollResponse, error) {
+	var resp scrollResponse
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			wait := retry.Backoff(attempt)
+			slog.Info("Retrying page", "index", index, "attempt", attempt, "backoff", wait)
+
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return resp, ctx.Err()
+			}
+		}
+
+		b, err := MakeGenericELKRequestWithTimeout(addr, http.MethodGet, body, opts.User, opts.Pass, opts.Timeout)
+		if err == nil {
+			err = json.Unmarshal(b, &resp)
+			if err == nil {
+				return resp, nil
+			}
+		}
+
+		if attempt >= retry.MaxRetries {
+			return resp, err
+		}
+		slog.Warn("Couldn't get page", "index", index, "attempt", attempt, "error", err)
+	}
+}
+
+// clearScroll lets elk free a scroll we're done with
+func clearScroll(url, scrollID string, opts ScrollOptions) {
+	if len(scrollID) == 0 {
+		return
+	}
+
+	_, err := MakeGenericELKRequestWithTimeout(fmt.Sprintf("%v/_search/scroll", url), http.MethodDelete, map[string]interface{}{
+		"scroll_id": scrollID,
+	}, opts.User, opts.Pass, opts.Timeout)
+	if err != nil {
+		slog.Debug("Couldn't clear scroll", "error", err)
+	}
+}
+
+func (s ScrollOptions) withDefaults() ScrollOptions {
+	if s.PageSize <= 0 {
+		s.PageSize = DefaultScrollOptions.PageSize
+	}
+	if s.Timeout <= 0 {
+		s.Timeout = DefaultScrollOptions.Timeout
+	}
+	if s.KeepAlive <= 0 {
+		s.KeepAlive = DefaultScrollOptions.KeepAlive
+	}
+	if s.Retry.InitialBackoff <= 0 {
+		s.Retry.InitialBackoff = DefaultScrollOptions.Retry.InitialBackoff
+	}
+	if s.Retry.MaxBackoff <= 0 {
+		s.Retry.MaxBackoff = DefaultScrollOptions.Retry.MaxBackoff
+	}
+	return s
+}
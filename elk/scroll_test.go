@@ -0,0 +1,141 @@
+package elk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scrollServer serves total documents a page at a time, failing the requests in fail the first time they're made
+func scrollServer(t *testing.T, total int, fail map[int]bool) (*httptest.Server, *[]string) {
+	var mu sync.Mutex
+	var requests []string
+	pageSize := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if fail[len(requests)] {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+
+		start := 0
+		switch {
+		case r.Method == http.MethodDelete:
+			assert.Equal(t, "/_search/scroll", r.URL.Path)
+			return
+		case r.URL.Path == "/devices/_search":
+			assert.Equal(t, "300s", r.URL.Query().Get("scroll"))
+			pageSize = int(body["size"].(float64))
+		default:
+			assert.Equal(t, "/_search/scroll", r.URL.Path)
+			start, _ = strconv.Atoi(body["scroll_id"].(string))
+		}
+
+		resp := scrollResponse{ScrollID: strconv.Itoa(min(start+pageSize, total))}
+		resp.Hits.Total = json.RawMessage(fmt.Sprintf(`{"value": %d, "relation": "eq"}`, total))
+		for i := start; i < min(start+pageSize, total); i++ {
+			resp.Hits.Hits = append(resp.Hits.Hits, ScrollHit{
+				ID:     fmt.Sprintf("ITB-%d-D1", i),
+				Source: json.RawMessage(fmt.Sprintf(`{"deviceID": "ITB-%d-D1"}`, i)),
+			})
+		}
+
+		json.NewEncoder(w).Encode(resp)
+	}))
+
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestScroll(t *testing.T) {
+	username, password = "user", "pass"
+
+	// the second page fails once, which restarts the scroll
+	server, requests := scrollServer(t, 25, map[int]bool{2: true})
+
+	seen := make(map[string]int)
+	err := Scroll(context.Background(), server.URL+"/", "devices", ScrollOptions{
+		PageSize: 10,
+		Retry:    RetryPolicy{MaxRetries: 1, InitialBackoff: time.Millisecond},
+	}, func(hits []ScrollHit) error {
+		for _, hit := range hits {
+			seen[hit.ID]++
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.Len(t, seen, 25)
+	assert.Equal(t, 2, seen["ITB-0-D1"])
+	assert.Equal(t, 1, seen["ITB-24-D1"])
+
+	assert.Equal(t, []string{
+		"GET /devices/_search",
+		"GET /_search/scroll", // failed
+		"DELETE /_search/scroll",
+		"GET /devices/_search",
+		"GET /_search/scroll",
+		"GET /_search/scroll",
+		"GET /_search/scroll", // empty
+		"DELETE /_search/scroll",
+	}, *requests)
+}
+
+func TestScrollErrors(t *testing.T) {
+	username, password = "user", "pass"
+
+	// out of retries
+	server, _ := scrollServer(t, 25, map[int]bool{1: true, 2: true})
+	err := Scroll(context.Background(), server.URL, "devices", ScrollOptions{
+		PageSize: 10,
+		Retry:    RetryPolicy{MaxRetries: 1, InitialBackoff: time.Millisecond},
+	}, func(hits []ScrollHit) error { return nil })
+	assert.Error(t, err)
+
+	// fn failing stops the scroll
+	server, requests := scrollServer(t, 25, nil)
+	err = Scroll(context.Background(), server.URL, "devices", ScrollOptions{PageSize: 10}, func(hits []ScrollHit) error {
+		return fmt.Errorf("bad page")
+	})
+	assert.EqualError(t, err, "bad page")
+	assert.Equal(t, []string{"GET /devices/_search", "DELETE /_search/scroll"}, *requests)
+
+	// a page after the first is never retried on its own
+	server, requests = scrollServer(t, 25, map[int]bool{2: true})
+	err = Scroll(context.Background(), server.URL, "devices", ScrollOptions{
+		PageSize: 10,
+		Retry:    RetryPolicy{MaxRetries: 0, InitialBackoff: time.Millisecond},
+	}, func(hits []ScrollHit) error { return nil })
+	assert.ErrorIs(t, err, errScrollInterrupted)
+	assert.Equal(t, []string{"GET /devices/_search", "GET /_search/scroll", "DELETE /_search/scroll"}, *requests)
+
+	// fewer documents than matched
+	short := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := scrollResponse{ScrollID: "1"}
+		resp.Hits.Total = json.RawMessage(`{"value": 5, "relation": "eq"}`)
+		if r.URL.Path == "/devices/_search" {
+			resp.Hits.Hits = []ScrollHit{{ID: "ITB-1101-D1", Source: json.RawMessage(`{}`)}}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(short.Close)
+
+	err = Scroll(context.Background(), short.URL, "devices", ScrollOptions{}, func(hits []ScrollHit) error { return nil })
+	assert.EqualError(t, err, "scroll of devices ended early, only loaded 1 of 5 documents")
+}
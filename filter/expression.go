@@ -0,0 +1,360 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+/*
+Expr is a parsed filter expression. The grammar is:
+
+	expr       = and { "||" and }
+	and        = unary { "&&" unary }
+	unary      = "!" unary | "(" expr ")" | comparison
+	comparison = field [ ( "==" | "!=" | "=~" | "!~" ) string | "in" "[" string { "," string } "]" ]
+
+Fields can have more than one value (e.g. tags), so "==", "=~", and "in" are true if any value matches and
+"!=" and "!~" are true if no value matches. A field on its own is true if it has any value. Strings are double quoted.
+
+	tags == "user-generated" && designation == "production"
+	key =~ "^(power|input)$" || !(building in ["ITB", "JFSB"])
+*/
+type Expr interface {
+	Eval(i *Item) bool
+}
+
+type orExpr []Expr
+
+func (o orExpr) Eval(i *Item) bool {
+	for _, e := range o {
+		if e.Eval(i) {
+			return true
+		}
+	}
+	return false
+}
+
+type andExpr []Expr
+
+func (a andExpr) Eval(i *Item) bool {
+	for _, e := range a {
+		if !e.Eval(i) {
+			return false
+		}
+	}
+	return true
+}
+
+type notExpr struct {
+	expr Expr
+}
+
+func (n notExpr) Eval(i *Item) bool {
+	return !n.expr.Eval(i)
+}
+
+type compareExpr struct {
+	field  string
+	op     string
+	values []string
+	re     *regexp.Regexp
+}
+
+func (c compareExpr) Eval(i *Item) bool {
+	vals := i.Values(c.field)
+
+	switch c.op {
+	case "":
+		return len(vals) > 0
+	case "==", "in":
+		return anyEqual(vals, c.values)
+	case "!=":
+		return !anyEqual(vals, c.values)
+	case "=~":
+		return anyMatch(vals, c.re)
+	case "!~":
+		return !anyMatch(vals, c.re)
+	}
+
+	return false
+}
+
+// Parse parses a filter expression
+func Parse(expr string) (Expr, error) {
+	tokens, err := lex(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter expression %q: %w", expr, err)
+	}
+
+	p := &parser{tokens: tokens}
+
+	e, err := p.parseOr()
+	if err == nil && p.peek().kind != tokenEOF {
+		err = p.errorf("unexpected %v", p.peek())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter expression %q: %w", expr, err)
+	}
+
+	return e, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenOp
+)
+
+type token struct {
+	kind tokenKind
+	val  string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of expression"
+	case tokenString:
+		return strconv.Quote(t.val)
+	}
+
+	return fmt.Sprintf("%q", t.val)
+}
+
+var operators = []string{"==", "!=", "=~", "!~", "&&", "||", "!", "(", ")", "[", "]", ","}
+
+func lex(s string) ([]token, error) {
+	var tokens []token
+
+	for pos := 0; pos < len(s); {
+		r := rune(s[pos])
+
+		switch {
+		case unicode.IsSpace(r):
+			pos++
+		case r == '"':
+			end := pos + 1
+			for ; end < len(s) && s[end] != '"'; end++ {
+				if s[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(s) {
+				return nil, fmt.Errorf("unterminated string at position %d", pos)
+			}
+
+			val, err := strconv.Unquote(s[pos : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at position %d: %w", pos, err)
+			}
+
+			tokens = append(tokens, token{kind: tokenString, val: val, pos: pos})
+			pos = end + 1
+		case unicode.IsLetter(r):
+			end := pos
+			for end < len(s) && (unicode.IsLetter(rune(s[end])) || unicode.IsDigit(rune(s[end])) || s[end] == '-' || s[end] == '_') {
+				end++
+			}
+
+			tokens = append(tokens, token{kind: tokenIdent, val: s[pos:end], pos: pos})
+			pos = end
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(s[pos:], o) {
+					op = o
+					break
+				}
+			}
+			if len(op) == 0 {
+				return nil, fmt.Errorf("unexpected %q at position %d", r, pos)
+			}
+
+			tokens = append(tokens, token{kind: tokenOp, val: op, pos: pos})
+			pos += len(op)
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, pos: len(s)}), nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isOp(op string) bool {
+	t := p.peek()
+	return t.kind == tokenOp && t.val == op
+}
+
+func (p *parser) expect(op string) error {
+	if !p.isOp(op) {
+		return p.errorf("expected %q, got %v", op, p.peek())
+	}
+
+	p.next()
+	return nil
+}
+
+func (p *parser) errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("%v at position %d", fmt.Sprintf(format, a...), p.peek().pos)
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	var or orExpr
+	for {
+		e, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		or = append(or, e)
+
+		if !p.isOp("||") {
+			break
+		}
+		p.next()
+	}
+
+	if len(or) == 1 {
+		return or[0], nil
+	}
+	return or, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	var and andExpr
+	for {
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		and = append(and, e)
+
+		if !p.isOp("&&") {
+			break
+		}
+		p.next()
+	}
+
+	if len(and) == 1 {
+		return and[0], nil
+	}
+	return and, nil
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	switch {
+	case p.isOp("!"):
+		p.next()
+
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{expr: e}, nil
+	case p.isOp("("):
+		p.next()
+
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return e, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (Expr, error) {
+	t := p.peek()
+	if t.kind != tokenIdent {
+		return nil, p.errorf("expected a field, got %v", t)
+	}
+
+	field := strings.ToLower(t.val)
+	if !contains(Fields, field) {
+		return nil, p.errorf("unknown field %q, must be one of %v", t.val, strings.Join(Fields, ", "))
+	}
+	p.next()
+
+	c := compareExpr{field: field}
+
+	t = p.peek()
+	switch {
+	case t.kind == tokenOp && (t.val == "==" || t.val == "!=" || t.val == "=~" || t.val == "!~"):
+		p.next()
+		c.op = t.val
+
+		val := p.peek()
+		if val.kind != tokenString {
+			return nil, p.errorf("expected a string, got %v", val)
+		}
+		p.next()
+		c.values = []string{val.val}
+
+		if c.op == "=~" || c.op == "!~" {
+			re, err := regexp.Compile(val.val)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regex at position %d: %w", val.pos, err)
+			}
+			c.re = re
+		}
+	case t.kind == tokenIdent && strings.ToLower(t.val) == "in":
+		p.next()
+		c.op = "in"
+
+		if err := p.expect("["); err != nil {
+			return nil, err
+		}
+		for {
+			val := p.peek()
+			if val.kind != tokenString {
+				return nil, p.errorf("expected a string, got %v", val)
+			}
+			p.next()
+			c.values = append(c.values, val.val)
+
+			if !p.isOp(",") {
+				break
+			}
+			p.next()
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+func contains(vals []string, s string) bool {
+	for _, v := range vals {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,368 @@
+// Package filter decides which events, devices, rooms, and room issues a forwarder is sent.
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/byuoitav/event-forwarding-microservice/events"
+	sd "github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
+	"github.com/byuoitav/event-forwarding-microservice/structs"
+)
+
+// Fields that can be matched on
+const (
+	FieldTags             = "tags"
+	FieldBuilding         = "building"
+	FieldRoom             = "room"
+	FieldDevice           = "device"
+	FieldDeviceType       = "device-type"
+	FieldKey              = "key"
+	FieldValue            = "value"
+	FieldGeneratingSystem = "generating-system"
+	FieldUser             = "user"
+	FieldDesignation      = "designation"
+)
+
+// Fields is every field that can be used in an expression
+var Fields = []string{FieldTags, FieldBuilding, FieldRoom, FieldDevice, FieldDeviceType, FieldKey, FieldValue, FieldGeneratingSystem, FieldUser, FieldDesignation}
+
+// Match is a set of conditions on an item. Lists match if any of their values match, and empty fields match everything.
+type Match struct {
+	Tags              []string
+	Buildings         []string
+	Rooms             []string
+	DeviceTypes       []string
+	Key               string // a regular expression
+	GeneratingSystems []string
+	Designations      []string
+}
+
+// Lookups get information about an item that isn't in the item itself
+type Lookups struct {
+	// Room returns the static room with the given ID
+	Room func(roomID string) (sd.StaticRoom, bool)
+
+	// DeviceType returns the type of the device with the given ID
+	DeviceType func(deviceID string) string
+}
+
+// Filter decides whether an item should be forwarded
+type Filter struct {
+	include    compiledMatch
+	exclude    compiledMatch
+	hasInclude bool
+	hasExclude bool
+	expr       Expr
+	lookups    Lookups
+}
+
+type compiledMatch struct {
+	Match
+	key *regexp.Regexp
+}
+
+// New builds a filter. An item passes if it matches every field set in include, doesn't match any field set in exclude, and expr is true.
+// expr may be empty.
+func New(include, exclude Match, expr string, lookups Lookups) (*Filter, error) {
+	f := &Filter{lookups: lookups}
+
+	var err error
+	if f.include, err = compile(include); err != nil {
+		return nil, fmt.Errorf("couldn't build include filter: %w", err)
+	}
+	if f.exclude, err = compile(exclude); err != nil {
+		return nil, fmt.Errorf("couldn't build exclude filter: %w", err)
+	}
+
+	f.hasInclude = !include.empty()
+	f.hasExclude = !exclude.empty()
+
+	if len(strings.TrimSpace(expr)) > 0 {
+		if f.expr, err = Parse(expr); err != nil {
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+func compile(m Match) (compiledMatch, error) {
+	c := compiledMatch{Match: m}
+	if len(m.Key) > 0 {
+		key, err := regexp.Compile(m.Key)
+		if err != nil {
+			return c, fmt.Errorf("invalid key regex: %w", err)
+		}
+		c.key = key
+	}
+
+	return c, nil
+}
+
+func (m Match) empty() bool {
+	return len(m.Tags) == 0 && len(m.Buildings) == 0 && len(m.Rooms) == 0 && len(m.DeviceTypes) == 0 &&
+		len(m.Key) == 0 && len(m.GeneratingSystems) == 0 && len(m.Designations) == 0
+}
+
+// Matches returns true if item (an event, static device, or static room) passes the filter
+func (f *Filter) Matches(item interface{}) bool {
+	i := newItem(item, f.lookups)
+
+	if f.hasInclude && !f.include.all(i) {
+		return false
+	}
+
+	if f.hasExclude && f.exclude.any(i) {
+		return false
+	}
+
+	if f.expr != nil && !f.expr.Eval(i) {
+		return false
+	}
+
+	return true
+}
+
+// all is true if i matches every field set in m
+func (m compiledMatch) all(i *Item) bool {
+	for _, c := range m.conditions() {
+		if c.set && !c.match(i) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// any is true if i matches any field set in m
+func (m compiledMatch) any(i *Item) bool {
+	for _, c := range m.conditions() {
+		if c.set && c.match(i) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type condition struct {
+	set   bool
+	match func(i *Item) bool
+}
+
+func (m compiledMatch) conditions() []condition {
+	in := func(field string, vals []string) condition {
+		return condition{
+			set: len(vals) > 0,
+			match: func(i *Item) bool {
+				return anyEqual(i.Values(field), vals)
+			},
+		}
+	}
+
+	return []condition{
+		in(FieldTags, m.Tags),
+		in(FieldBuilding, m.Buildings),
+		in(FieldRoom, m.Rooms),
+		in(FieldDeviceType, m.DeviceTypes),
+		{
+			set: m.key != nil,
+			match: func(i *Item) bool {
+				return anyMatch(i.Values(FieldKey), m.key)
+			},
+		},
+		in(FieldGeneratingSystem, m.GeneratingSystems),
+		in(FieldDesignation, m.Designations),
+	}
+}
+
+func anyEqual(vals, to []string) bool {
+	for _, v := range vals {
+		for _, t := range to {
+			if strings.EqualFold(v, t) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func anyMatch(vals []string, re *regexp.Regexp) bool {
+	for _, v := range vals {
+		if re.MatchString(v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Item is something being filtered, with its fields looked up as they're needed
+type Item struct {
+	event   *events.Event
+	device  *sd.StaticDevice
+	room    *sd.StaticRoom
+	issue   *structs.RoomIssue
+	lookups Lookups
+
+	designation *string
+}
+
+func newItem(item interface{}, lookups Lookups) *Item {
+	i := &Item{lookups: lookups}
+
+	switch v := item.(type) {
+	case events.Event:
+		i.event = &v
+	case *events.Event:
+		i.event = v
+	case sd.StaticDevice:
+		i.device = &v
+	case *sd.StaticDevice:
+		i.device = v
+	case sd.StaticRoom:
+		i.room = &v
+	case *sd.StaticRoom:
+		i.room = v
+	case structs.RoomIssue:
+		i.issue = &v
+	case *structs.RoomIssue:
+		i.issue = v
+	}
+
+	return i
+}
+
+// Values returns the values of field for the item, or nil if it doesn't have that field
+func (i *Item) Values(field string) []string {
+	switch field {
+	case FieldTags:
+		switch {
+		case i.event != nil:
+			return i.event.EventTags
+		case i.device != nil:
+			return i.device.Tags
+		case i.room != nil:
+			return i.room.Tags
+		case i.issue != nil:
+			return i.issue.RoomTags
+		}
+	case FieldBuilding:
+		switch {
+		case i.event != nil:
+			return nonEmpty(i.event.AffectedRoom.BuildingID, i.event.TargetDevice.BuildingID)
+		case i.device != nil:
+			return nonEmpty(i.device.Building)
+		case i.room != nil:
+			return nonEmpty(i.room.BuildingID)
+		case i.issue != nil:
+			return nonEmpty(i.issue.BuildingID)
+		}
+	case FieldRoom:
+		return nonEmpty(i.roomID())
+	case FieldDevice:
+		switch {
+		case i.event != nil:
+			return nonEmpty(i.event.TargetDevice.DeviceID)
+		case i.device != nil:
+			return nonEmpty(i.device.DeviceID)
+		}
+	case FieldDeviceType:
+		switch {
+		case i.device != nil && len(i.device.DeviceType) > 0:
+			return []string{i.device.DeviceType}
+		case i.device != nil:
+			return i.lookupDeviceType(i.device.DeviceID)
+		case i.event != nil:
+			return i.lookupDeviceType(i.event.TargetDevice.DeviceID)
+		}
+	case FieldKey:
+		if i.event != nil {
+			return []string{i.event.Key}
+		}
+	case FieldValue:
+		if i.event != nil {
+			return []string{i.event.Value}
+		}
+	case FieldGeneratingSystem:
+		if i.event != nil {
+			return nonEmpty(i.event.GeneratingSystem)
+		}
+	case FieldUser:
+		if i.event != nil {
+			return nonEmpty(i.event.User)
+		}
+	case FieldDesignation:
+		return nonEmpty(i.lookupDesignation())
+	}
+
+	return nil
+}
+
+func (i *Item) roomID() string {
+	switch {
+	case i.event != nil:
+		if len(i.event.AffectedRoom.RoomID) > 0 {
+			return i.event.AffectedRoom.RoomID
+		}
+		return i.event.TargetDevice.RoomID
+	case i.device != nil:
+		if strings.Contains(i.device.Room, "-") {
+			return i.device.Room
+		}
+
+		// devices are named BLDG-ROOM-TYPE#
+		split := strings.Split(i.device.DeviceID, "-")
+		if len(split) == 3 {
+			return split[0] + "-" + split[1]
+		}
+	case i.room != nil:
+		return i.room.RoomID
+	case i.issue != nil:
+		return i.issue.RoomID
+	}
+
+	return ""
+}
+
+func (i *Item) lookupDeviceType(id string) []string {
+	if len(id) == 0 || i.lookups.DeviceType == nil {
+		return nil
+	}
+
+	return nonEmpty(i.lookups.DeviceType(id))
+}
+
+func (i *Item) lookupDesignation() string {
+	if i.room != nil {
+		return i.room.Designation
+	}
+
+	if i.designation != nil {
+		return *i.designation
+	}
+
+	var designation string
+	if id := i.roomID(); len(id) > 0 && i.lookups.Room != nil {
+		if room, ok := i.lookups.Room(id); ok {
+			designation = room.Designation
+		}
+	}
+
+	i.designation = &designation
+	return designation
+}
+
+func nonEmpty(vals ...string) []string {
+	var toReturn []string
+	for _, v := range vals {
+		if len(v) > 0 {
+			toReturn = append(toReturn, v)
+		}
+	}
+
+	return toReturn
+}
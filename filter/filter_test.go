@@ -0,0 +1,109 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/byuoitav/event-forwarding-microservice/events"
+	sd "github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var lookups = Lookups{
+	Room: func(roomID string) (sd.StaticRoom, bool) {
+		switch roomID {
+		case "ITB-1101":
+			return sd.StaticRoom{RoomID: roomID, Designation: sd.Production}, true
+		case "ITB-1010":
+			return sd.StaticRoom{RoomID: roomID, Designation: sd.Stage}, true
+		}
+		return sd.StaticRoom{}, false
+	},
+	DeviceType: func(deviceID string) string {
+		if deviceID == "ITB-1101-D1" {
+			return "display"
+		}
+		return "control-processor"
+	},
+}
+
+func event(room, device, key string, tags ...string) events.Event {
+	return events.Event{
+		GeneratingSystem: room + "-CP1",
+		EventTags:        tags,
+		TargetDevice:     events.GenerateBasicDeviceInfo(device),
+		AffectedRoom:     events.GenerateBasicRoomInfo(room),
+		Key:              key,
+	}
+}
+
+func TestIncludeExclude(t *testing.T) {
+	f, err := New(Match{
+		Tags:         []string{events.UserGenerated},
+		Designations: []string{sd.Production},
+	}, Match{
+		Key: "^input$",
+	}, "", lookups)
+	require.NoError(t, err)
+
+	assert.True(t, f.Matches(event("ITB-1101", "ITB-1101-D1", "power", events.UserGenerated)))
+	assert.False(t, f.Matches(event("ITB-1101", "ITB-1101-D1", "input", events.UserGenerated)), "excluded key")
+	assert.False(t, f.Matches(event("ITB-1101", "ITB-1101-D1", "power", events.AutoGenerated)), "missing tag")
+	assert.False(t, f.Matches(event("ITB-1010", "ITB-1010-D1", "power", events.UserGenerated)), "stage room")
+	assert.False(t, f.Matches(event("JFSB-1", "JFSB-1-D1", "power", events.UserGenerated)), "unknown room")
+
+	assert.True(t, f.Matches(sd.StaticRoom{RoomID: "ITB-1101", Designation: sd.Production, Tags: []string{events.UserGenerated}}))
+
+	f, err = New(Match{}, Match{DeviceTypes: []string{"display"}, Buildings: []string{"JFSB"}}, "", lookups)
+	require.NoError(t, err)
+
+	assert.False(t, f.Matches(event("ITB-1101", "ITB-1101-D1", "power")))
+	assert.False(t, f.Matches(event("JFSB-1", "JFSB-1-CP1", "power")))
+	assert.True(t, f.Matches(event("ITB-1101", "ITB-1101-CP1", "power")))
+	assert.False(t, f.Matches(&sd.StaticDevice{DeviceID: "ITB-1101-D2", DeviceType: "display"}))
+
+	_, err = New(Match{Key: "("}, Match{}, "", lookups)
+	assert.Error(t, err)
+}
+
+func TestExpression(t *testing.T) {
+	tests := []struct {
+		expr    string
+		matches bool
+	}{
+		{`tags == "user-generated" && designation == "production"`, true},
+		{`tags == "error" || designation == "stage"`, false},
+		{`!(tags == "error")`, true},
+		{`key =~ "^(power|input)$" && building in ["ITB", "JFSB"]`, true},
+		{`key !~ "^pow" || device-type != "display"`, false},
+		{`user`, false},
+		{`generating-system == "itb-1101-cp1"`, true},
+		{`room in ["ITB-1010"] || (device-type == "display" && value == "on")`, true},
+	}
+
+	e := event("ITB-1101", "ITB-1101-D1", "power", events.UserGenerated)
+	e.Value = "on"
+
+	for _, tt := range tests {
+		f, err := New(Match{}, Match{}, tt.expr, lookups)
+		require.NoError(t, err, tt.expr)
+		assert.Equal(t, tt.matches, f.Matches(e), tt.expr)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		`tags ==`,
+		`tags == "a" &&`,
+		`tag == "a"`,
+		`(tags == "a"`,
+		`key =~ "("`,
+		`room in ["a",]`,
+		`tags == "a" tags`,
+		`tags == 'a'`,
+		`tags == "a`,
+	} {
+		_, err := Parse(expr)
+		assert.Error(t, err, expr)
+	}
+}
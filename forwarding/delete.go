@@ -0,0 +1,68 @@
+package forwarding
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/byuoitav/event-forwarding-microservice/config"
+)
+
+// ErrCantDelete is returned when deleting from a manager that doesn't support it
+var ErrCantDelete = errors.New("manager can't delete")
+
+// Deleter is implemented by managers that keep a record of each device or room, and can remove it
+type Deleter interface {
+	Delete(id string) error
+}
+
+// deleteTypes are the forwarder types that keep a record of each device or room
+var deleteTypes = map[string]bool{
+	config.ELKSTATIC: true,
+	config.COUCH:     true,
+}
+
+// DeleteDevice sends a delete for the device to every static device forwarder for the cache called cacheName.
+// It returns the names of the forwarders it was sent to.
+func DeleteDevice(cacheName, id string) ([]string, error) {
+	return deleteFrom(cacheName, config.DEVICE, id)
+}
+
+// DeleteRoom sends a delete for the room to every static room forwarder for the cache called cacheName.
+// It returns the names of the forwarders it was sent to.
+func DeleteRoom(cacheName, id string) ([]string, error) {
+	return deleteFrom(cacheName, config.ROOM, id)
+}
+
+func deleteFrom(cacheName, dataType, id string) ([]string, error) {
+	managerInit.Do(initManagers)
+
+	// a Delete waits for room in the forwarder's channel, so they're sent without holding managerLock
+	managerLock.RLock()
+	deleters := make(map[string]Deleter)
+	for name, f := range forwarders {
+		if f.config.DataType != dataType || !deleteTypes[f.config.Type] || getCacheName(f.config) != cacheName {
+			continue
+		}
+
+		if d, ok := f.manager.(Deleter); ok {
+			deleters[name] = d
+		}
+	}
+	managerLock.RUnlock()
+
+	sent := []string{}
+	var errs []error
+
+	for name, d := range deleters {
+		if err := d.Delete(id); err != nil {
+			errs = append(errs, fmt.Errorf("couldn't delete %v from %v: %w", id, name, err))
+			continue
+		}
+
+		sent = append(sent, name)
+	}
+
+	sort.Strings(sent)
+	return sent, errors.Join(errs...)
+}
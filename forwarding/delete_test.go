@@ -0,0 +1,61 @@
+package forwarding
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/byuoitav/event-forwarding-microservice/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteFrom(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"errors": false, "items": []}`))
+	}))
+	t.Cleanup(server.Close)
+
+	// the forwarders flush their deletes to server when they're closed
+	closeAll(t)
+
+	static := func(name, cacheName, dataType string) config.Forwarder {
+		return config.Forwarder{
+			Name:      name,
+			Type:      config.ELKSTATIC,
+			EventType: config.ALL,
+			DataType:  dataType,
+			CacheName: cacheName,
+			Interval:  3600,
+			Elk: config.ElkForwarder{
+				URL:                   server.URL,
+				IndexPattern:          "av-static",
+				IndexRotationInterval: config.NOROTATE,
+			},
+		}
+	}
+
+	ApplyConfig(config.Config{Forwarders: []config.Forwarder{
+		static("Devices", "", config.DEVICE),
+		static("LegacyDevices", "legacy", config.DEVICE),
+		static("Rooms", "default", config.ROOM),
+		fileForwarder(t, "Archive"),
+	}})
+
+	// deletes only go to the static forwarders for the cache they were deleted from
+	sent, err := DeleteDevice("default", "ITB-1101-D1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Devices"}, sent)
+
+	sent, err = DeleteDevice("legacy", "ITB-1101-D1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"LegacyDevices"}, sent)
+
+	sent, err = DeleteRoom("default", "ITB-1101")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Rooms"}, sent)
+
+	sent, err = DeleteRoom("legacy", "ITB-1101")
+	require.NoError(t, err)
+	assert.Empty(t, sent)
+}
@@ -0,0 +1,95 @@
+package forwarding
+
+import (
+	"reflect"
+
+	"github.com/byuoitav/event-forwarding-microservice/config"
+	"github.com/byuoitav/event-forwarding-microservice/filter"
+	sd "github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
+)
+
+// lookups are how filters find rooms and device types. forwarding can't import the caches, so they're set by whatever owns them.
+var (
+	roomLookup       func(cacheName, roomID string) (sd.StaticRoom, bool)
+	deviceTypeLookup func(deviceID string) string
+)
+
+// SetLookups sets how filters find the room with an ID in a cache, and the type of a device from its ID.
+// It should be called before any forwarders are created.
+func SetLookups(room func(cacheName, roomID string) (sd.StaticRoom, bool), deviceType func(deviceID string) string) {
+	roomLookup = room
+	deviceTypeLookup = deviceType
+}
+
+// getCacheName is the name of the cache a forwarder is for
+func getCacheName(i config.Forwarder) string {
+	if len(i.CacheName) == 0 {
+		return config.DEFAULT
+	}
+	return i.CacheName
+}
+
+// filteredManager only sends what passes its filter on to the manager it wraps
+type filteredManager struct {
+	BufferManager
+	filter *filter.Filter
+}
+
+// Send drops anything that doesn't pass the filter
+func (f *filteredManager) Send(toSend interface{}) error {
+	if !f.filter.Matches(toSend) {
+		return nil
+	}
+
+	return f.BufferManager.Send(toSend)
+}
+
+// Delete passes deletes straight through, whether or not what's being deleted would pass the filter
+func (f *filteredManager) Delete(id string) error {
+	d, ok := f.BufferManager.(Deleter)
+	if !ok {
+		return ErrCantDelete
+	}
+
+	return d.Delete(id)
+}
+
+// getFilter builds the filter from i, returns nil if i doesn't have one
+func getFilter(i config.Forwarder) (*filter.Filter, error) {
+	if reflect.DeepEqual(i.Filter, config.FilterConfig{}) {
+		return nil, nil
+	}
+
+	lookups := filter.Lookups{
+		DeviceType: deviceTypeLookup,
+	}
+	if roomLookup != nil {
+		cacheName := getCacheName(i)
+		lookups.Room = func(roomID string) (sd.StaticRoom, bool) {
+			return roomLookup(cacheName, roomID)
+		}
+	}
+
+	return filter.New(toMatch(i.Filter.Include), toMatch(i.Filter.Exclude), i.Filter.Expression, lookups)
+}
+
+// withFilter wraps m in f, if there is one
+func withFilter(m BufferManager, f *filter.Filter) BufferManager {
+	if f == nil {
+		return m
+	}
+
+	return &filteredManager{BufferManager: m, filter: f}
+}
+
+func toMatch(c config.FilterMatch) filter.Match {
+	return filter.Match{
+		Tags:              c.Tags,
+		Buildings:         c.Buildings,
+		Rooms:             c.Rooms,
+		DeviceTypes:       c.DeviceTypes,
+		Key:               c.Key,
+		GeneratingSystems: c.GeneratingSystems,
+		Designations:      c.Designations,
+	}
+}
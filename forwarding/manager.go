@@ -1,75 +1,512 @@
 package forwarding
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"path/filepath"
+	"reflect"
 	"sync"
+	"text/template"
 	"time"
 
 	"github.com/byuoitav/event-forwarding-microservice/config"
+	"github.com/byuoitav/event-forwarding-microservice/elk"
 	"github.com/byuoitav/event-forwarding-microservice/forwarding/managers"
+	"github.com/byuoitav/event-forwarding-microservice/loki"
+	"github.com/byuoitav/event-forwarding-microservice/metrics"
+	"github.com/byuoitav/event-forwarding-microservice/wal"
 )
 
 // BufferManager is meant to handle buffering events/updates to the eventual forever home of the information
 type BufferManager interface {
 	Send(toSend interface{}) error
+
+	// Close flushes anything buffered and stops the manager, giving up when ctx is done
+	Close(ctx context.Context) (FlushResult, error)
+}
+
+// FlushResult is how many buffered items a manager sent or gave up on when it was closed
+type FlushResult = managers.FlushResult
+
+// closeTimeout is how long a removed or replaced manager has to flush its buffer
+const closeTimeout = 30 * time.Second
+
+// forwarder is a running manager and the config it was built from
+type forwarder struct {
+	config  config.Forwarder
+	manager BufferManager
 }
 
 // Key is made up of the CacheName-DataType-EventType
 // e.g. default-device-all or legacy-event-all
 var managerMap map[string][]BufferManager
 var managerInit sync.Once
+var managerLock sync.RWMutex
+
+// applyLock keeps config from being applied by more than one caller at a time
+var applyLock sync.Mutex
+
+// forwarders holds the running managers by forwarder name
+var forwarders map[string]forwarder
+
+// logs holds the open write ahead logs by directory
+var logs = make(map[string]*wal.Log)
 
 func initManagers() {
 	slog.Info("Initializing buffer managers")
+	applyConfig(config.GetConfig())
+	slog.Info("Buffer managers initialized")
+}
+
+// ApplyConfig reconciles the running managers with the forwarders in c. Managers for new forwarders are started,
+// managers for removed forwarders are flushed and stopped, and managers for changed forwarders are replaced.
+// An old manager without a write ahead log flushes its buffer after the new one has taken its place. One with a
+// log is flushed and stopped first, and the new one replays whatever it couldn't send, so nothing is sent twice.
+// Events keep flowing to every other manager while that happens.
+func ApplyConfig(c config.Config) {
+	// the config being applied replaces the initial one
+	managerInit.Do(func() {})
+
+	slog.Info("Applying forwarder config")
+	applyConfig(c)
+	slog.Info("Forwarder config applied")
+}
+
+func applyConfig(c config.Config) {
+	applyLock.Lock()
+	defer applyLock.Unlock()
+
+	configs := make(map[string]config.Forwarder)
+	names := make([]string, len(c.Forwarders))
+	for idx, i := range c.Forwarders {
+		name := i.Name
+		for j := 1; ; j++ {
+			if _, ok := configs[name]; !ok {
+				break
+			}
+			name = fmt.Sprintf("%v-%v", i.Name, j)
+		}
+
+		configs[name] = i
+		names[idx] = name
+	}
+
+	managerLock.RLock()
+	running := forwarders
+	managerLock.RUnlock()
+
+	toClose := make(map[string]BufferManager)
+	var closedLogs []string
+	for name, cur := range running {
+		if i, ok := configs[name]; ok && reflect.DeepEqual(cur.config, i) {
+			continue
+		}
+
+		if _, ok := configs[name]; ok {
+			slog.Info("Replacing manager", "name", name)
+		} else {
+			slog.Info("Removing manager", "name", name)
+			metrics.RemoveForwarder(name)
+		}
+
+		if len(cur.config.WAL.Directory) == 0 {
+			toClose[name] = cur.manager
+			continue
+		}
+
+		// the old manager has to be done with its log before anything else opens it, otherwise acking what it sent could
+		// delete what the new manager has recorded. It's still sent to while it flushes, without holding managerLock, and
+		// whatever it records after its last checkpoint is replayed by the new manager.
+		closeManager(name, cur.manager)
+		closedLogs = append(closedLogs, cur.config.WAL.Directory)
+	}
+
+	managerLock.Lock()
+	for _, dir := range closedLogs {
+		closeLog(dir)
+	}
 
-	c := config.GetConfig()
+	next := make(map[string]forwarder)
+	for idx, i := range c.Forwarders {
+		name := names[idx]
 
+		cur, ok := forwarders[name]
+		if ok && reflect.DeepEqual(cur.config, i) {
+			next[name] = cur
+			continue
+		}
+
+		// a forwarder isn't started without its filter, so it's never sent anything the filter would drop
+		f, err := getFilter(i)
+		if err != nil {
+			slog.Error("Couldn't build filter, forwarder won't be started", "name", name, "error", err)
+			metrics.RemoveForwarder(name)
+			continue
+		}
+
+		m := newManager(i, getLog(i.WAL), metrics.NewForwarder(name))
+		if m == nil {
+			metrics.RemoveForwarder(name)
+			continue
+		}
+		next[name] = forwarder{config: i, manager: withFilter(m, f)}
+	}
+
+	forwarders = next
+	managerMap = make(map[string][]BufferManager)
+	for _, f := range forwarders {
+		curName := fmt.Sprintf("%v-%v", f.config.DataType, f.config.EventType)
+		managerMap[curName] = append(managerMap[curName], f.manager)
+	}
+
+	managerLock.Unlock()
+
+	for name, m := range toClose {
+		go func(name string, m BufferManager) {
+			closeManager(name, m)
+			closeUnusedLogs()
+		}(name, m)
+	}
+}
+
+// closeManager flushes and stops a removed or replaced manager, giving up after closeTimeout
+func closeManager(name string, m BufferManager) {
+	ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+
+	result, err := m.Close(ctx)
+	if err != nil {
+		slog.Error("Couldn't close manager", "name", name, "error", err)
+	}
+	slog.Info("Closed manager", "name", name, "flushed", result.Flushed, "abandoned", result.Abandoned)
+}
+
+// Close flushes and stops every manager, giving up on anything not sent when ctx is done.
+// It returns what happened to each manager's buffer by forwarder name.
+func Close(ctx context.Context) (map[string]FlushResult, error) {
+	managerLock.Lock()
+	toClose := forwarders
+	forwarders = nil
 	managerMap = make(map[string][]BufferManager)
-	for _, i := range c.Forwarders {
-		curName := fmt.Sprintf(fmt.Sprintf("%v-%v", i.DataType, i.EventType))
-		switch i.Type {
-		case config.ELKSTATIC:
-			switch i.DataType {
-			case config.ROOM:
-				slog.Info("Initializing manager", "name", curName)
-				managerMap[curName] = append(managerMap[curName], managers.GetDefaultElkStaticRoomForwarder(
-					i.Elk.URL,
-					GetIndexFunction(i.Elk.IndexPattern, i.Elk.IndexRotationInterval),
-					time.Duration(i.Interval)*time.Second,
-					i.Elk.Upsert,
-				))
-			case config.DEVICE:
-				slog.Info("Initializing manager", "name", curName)
-				managerMap[curName] = append(managerMap[curName], managers.GetDefaultElkStaticDeviceForwarder(
-					i.Elk.URL,
-					GetIndexFunction(i.Elk.IndexPattern, i.Elk.IndexRotationInterval),
-					time.Duration(i.Interval)*time.Second,
-					i.Elk.Upsert,
-				))
+	managerLock.Unlock()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var errs []error
+	results := make(map[string]FlushResult)
+
+	for name, f := range toClose {
+		wg.Add(1)
+		go func(name string, m BufferManager) {
+			defer wg.Done()
+
+			result, err := m.Close(ctx)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			results[name] = result
+			if err != nil {
+				errs = append(errs, fmt.Errorf("couldn't close %v: %w", name, err))
 			}
-		case config.ELKTIMESERIES:
+		}(name, f.manager)
+	}
+
+	wg.Wait()
+	closeUnusedLogs()
+
+	return results, errors.Join(errs...)
+}
+
+// getLog returns the write ahead log described by c, opening it if it isn't already. Returns nil if c doesn't turn on a log.
+// must hold managerLock
+func getLog(c config.WALConfig) *wal.Log {
+	if len(c.Directory) == 0 {
+		return nil
+	}
+
+	dir := filepath.Clean(c.Directory)
+	if l, ok := logs[dir]; ok {
+		return l
+	}
+
+	l, err := wal.Open(dir, int64(c.MaxSize)*1024*1024, c.FullPolicy)
+	if err != nil {
+		slog.Error("Couldn't open write ahead log, forwarder will only buffer in memory", "dir", dir, "error", err)
+		return nil
+	}
+
+	interval := c.SyncInterval
+	if interval <= 0 {
+		interval = 1
+	}
+
+	if err := l.SetSync(c.Sync, time.Duration(interval)*time.Second); err != nil {
+		slog.Error("Couldn't set write ahead log sync policy, it's synced each time the buffer is sent", "dir", dir, "error", err)
+	}
+
+	logs[dir] = l
+	return l
+}
+
+// closeUnusedLogs closes the write ahead logs that no forwarder is configured to use
+func closeUnusedLogs() {
+	managerLock.Lock()
+	defer managerLock.Unlock()
+
+	inUse := make(map[string]bool)
+	for _, f := range forwarders {
+		if len(f.config.WAL.Directory) > 0 {
+			inUse[filepath.Clean(f.config.WAL.Directory)] = true
+		}
+	}
+
+	for dir := range logs {
+		if !inUse[dir] {
+			closeLog(dir)
+		}
+	}
+}
+
+// closeLog closes the write ahead log in dir if it's open, the next getLog for dir opens it again.
+// must hold managerLock
+func closeLog(dir string) {
+	dir = filepath.Clean(dir)
+	l, ok := logs[dir]
+	if !ok {
+		return
+	}
+
+	if err := l.Close(); err != nil {
+		slog.Error("Couldn't close write ahead log", "dir", dir, "error", err)
+	}
+	delete(logs, dir)
+}
+
+// newManager starts the manager described by i, returns nil if i doesn't describe a manager.
+// log is the write ahead log for the manager to use, or nil. stats tracks what the manager buffers and sends.
+func newManager(i config.Forwarder, log *wal.Log, stats *metrics.Forwarder) BufferManager {
+	curName := fmt.Sprintf("%v-%v", i.DataType, i.EventType)
+	switch i.Type {
+	case config.ELKSTATIC:
+		switch i.DataType {
+		case config.ROOM:
 			slog.Info("Initializing manager", "name", curName)
-			managerMap[curName] = append(managerMap[curName], managers.GetDefaultElkTimeSeries(
+			return managers.GetDefaultElkStaticRoomForwarder(
 				i.Elk.URL,
 				GetIndexFunction(i.Elk.IndexPattern, i.Elk.IndexRotationInterval),
 				time.Duration(i.Interval)*time.Second,
-			))
-		case config.COUCH:
+				i.Elk.Upsert,
+				GetRetryPolicy(i.Elk.Retry),
+				getDeadLetterSink(i.Elk),
+				log,
+				getTransforms(i),
+				stats,
+			)
+		case config.DEVICE:
 			slog.Info("Initializing manager", "name", curName)
-			managerMap[curName] = append(managerMap[curName], managers.GetDefaultCouchDeviceBuffer(
-				i.Couch.URL,
-				i.Couch.DatabaseName,
+			return managers.GetDefaultElkStaticDeviceForwarder(
+				i.Elk.URL,
+				GetIndexFunction(i.Elk.IndexPattern, i.Elk.IndexRotationInterval),
+				time.Duration(i.Interval)*time.Second,
+				i.Elk.Upsert,
+				GetRetryPolicy(i.Elk.Retry),
+				getDeadLetterSink(i.Elk),
+				log,
+				getTransforms(i),
+				stats,
+			)
+		case config.ISSUE:
+			slog.Info("Initializing manager", "name", curName)
+			return managers.GetDefaultElkStaticIssueForwarder(
+				i.Elk.URL,
+				GetIndexFunction(i.Elk.IndexPattern, i.Elk.IndexRotationInterval),
 				time.Duration(i.Interval)*time.Second,
-			))
-		case config.WEBSOCKET:
-			slog.Info("Initializing Websocket manager", "name", curName)
-			managerMap[curName] = append(managerMap[curName], managers.GetDefaultWebsocketForwarder())
+				GetRetryPolicy(i.Elk.Retry),
+				getDeadLetterSink(i.Elk),
+				log,
+				getTransforms(i),
+				stats,
+			)
+		}
+	case config.ELKTIMESERIES:
+		slog.Info("Initializing manager", "name", curName)
+		return managers.GetDefaultElkTimeSeries(
+			i.Elk.URL,
+			GetIndexFunction(i.Elk.IndexPattern, i.Elk.IndexRotationInterval),
+			time.Duration(i.Interval)*time.Second,
+			GetRetryPolicy(i.Elk.Retry),
+			getDeadLetterSink(i.Elk),
+			log,
+			getTransforms(i),
+			stats,
+		)
+	case config.COUCH:
+		slog.Info("Initializing manager", "name", curName)
+		return managers.GetDefaultCouchDeviceBuffer(
+			i.Couch.URL,
+			i.Couch.DatabaseName,
+			time.Duration(i.Interval)*time.Second,
+			log,
+			stats,
+		)
+	case config.WEBSOCKET:
+		slog.Info("Initializing Websocket manager", "name", curName)
+		return managers.GetDefaultWebsocketForwarder(getTransforms(i))
+	case config.HUMIO:
+		interval := i.Humio.Interval
+		if interval <= 0 {
+			interval = i.Interval
+		}
+
+		slog.Info("Initializing Humio manager", "name", curName)
+		return managers.GetDefaultHumioForwarder(
+			i.DataType,
+			time.Duration(interval)*time.Second,
+			i.Humio.BufferSize,
+			config.ReplaceEnv(i.Humio.IngestToken),
+			log,
+			getTransforms(i),
+			stats,
+		)
+	case config.WEBHOOK:
+		tmpl, err := getWebhookTemplate(i.Webhook)
+		if err != nil {
+			slog.Error("Couldn't parse webhook template", "name", i.Name, "error", err)
+			return nil
+		}
+
+		headers := make(map[string]string, len(i.Webhook.Headers))
+		for k, v := range i.Webhook.Headers {
+			headers[k] = config.ReplaceEnv(v)
 		}
 
+		slog.Info("Initializing Webhook manager", "name", curName)
+		return managers.GetDefaultWebhookForwarder(
+			managers.Webhook{
+				URL:             i.Webhook.URL,
+				Headers:         headers,
+				BearerToken:     config.ReplaceEnv(i.Webhook.BearerToken),
+				Username:        i.Webhook.Username,
+				Password:        config.ReplaceEnv(i.Webhook.Password),
+				Template:        tmpl,
+				BatchSize:       i.Webhook.BatchSize,
+				Secret:          config.ReplaceEnv(i.Webhook.HMACSecret),
+				SignatureHeader: i.Webhook.SignatureHeader,
+				Timeout:         time.Duration(i.Webhook.Timeout) * time.Second,
+				Retry:           GetRetryPolicy(i.Webhook.Retry),
+			},
+			i.DataType,
+			time.Duration(i.Interval)*time.Second,
+			log,
+			getTransforms(i),
+			stats,
+		)
+	case config.SPLUNK:
+		slog.Info("Initializing Splunk manager", "name", curName)
+		return managers.GetDefaultSplunkForwarder(
+			managers.Splunk{
+				URL:    i.Splunk.URL,
+				Token:  config.ReplaceEnv(i.Splunk.Token),
+				Index:  i.Splunk.Index,
+				Source: i.Splunk.Source,
+				Host:   i.Splunk.Host,
+			},
+			i.DataType,
+			time.Duration(i.Interval)*time.Second,
+			i.Splunk.BufferSize,
+			log,
+			getTransforms(i),
+			stats,
+		)
+	case config.LOKI:
+		slog.Info("Initializing Loki manager", "name", curName)
+		return managers.GetDefaultLokiForwarder(
+			managers.Loki{
+				URL: i.Loki.URL,
+				Auth: loki.Auth{
+					TenantID: i.Loki.TenantID,
+					Username: i.Loki.Username,
+					Password: config.ReplaceEnv(i.Loki.Password),
+				},
+				Labels:     i.Loki.Labels,
+				DeviceType: deriveFunction(config.DERIVEDEVICETYPE),
+			},
+			time.Duration(i.Interval)*time.Second,
+			i.Loki.BufferSize,
+			log,
+			getTransforms(i),
+			stats,
+		)
+	case config.FILE:
+		slog.Info("Initializing File manager", "name", curName)
+		return managers.GetDefaultFileForwarder(
+			managers.File{
+				Directory: i.File.Directory,
+				Pattern:   i.File.FilePattern,
+				Name:      GetIndexFunction(i.File.FilePattern, i.File.RotationInterval),
+				Compress:  i.File.Compress,
+				Retention: i.File.Retention,
+			},
+			time.Duration(i.Interval)*time.Second,
+			getTransforms(i),
+			stats,
+		)
 	}
 
-	slog.Info("Buffer managers initialized")
+	slog.Warn("Unknown forwarder", "name", i.Name, "type", i.Type, "dataType", i.DataType)
+	return nil
+}
+
+// getWebhookTemplate parses a webhook's body template, returns nil if it doesn't have one
+func getWebhookTemplate(c config.WebhookForwarder) (*template.Template, error) {
+	if len(c.Template) == 0 {
+		return nil, nil
+	}
+	return config.ParseWebhookTemplate(c.Template)
+}
+
+// GetRetryPolicy builds the retry policy for sending to or reading from elk, filling in defaults for anything unset
+func GetRetryPolicy(c config.RetryConfig) elk.RetryPolicy {
+	policy := elk.DefaultRetryPolicy
+
+	switch {
+	case c.MaxRetries < 0:
+		policy.MaxRetries = 0
+	case c.MaxRetries > 0:
+		policy.MaxRetries = c.MaxRetries
+	}
+
+	if c.InitialBackoff > 0 {
+		policy.InitialBackoff = time.Duration(c.InitialBackoff) * time.Second
+	}
+	if c.MaxBackoff > 0 {
+		policy.MaxBackoff = time.Duration(c.MaxBackoff) * time.Second
+	}
+
+	return policy
+}
+
+// getDeadLetterSink builds where an elk forwarder puts items it can't send
+func getDeadLetterSink(c config.ElkForwarder) elk.DeadLetterSink {
+	switch c.DeadLetter.Type {
+	case config.DEADLETTERFILE:
+		return &elk.FileDeadLetterSink{Path: c.DeadLetter.Path}
+	case config.DEADLETTERELK:
+		url := c.DeadLetter.URL
+		if len(url) == 0 {
+			url = c.URL
+		}
+
+		return &elk.IndexDeadLetterSink{
+			URL:   url,
+			Index: GetIndexFunction(c.DeadLetter.IndexPattern, c.DeadLetter.IndexRotationInterval),
+		}
+	}
+
+	return elk.LogDeadLetterSink{}
 }
 
 // GetManagersForType a
@@ -77,6 +514,9 @@ func GetManagersForType(dataType, eventType string) []BufferManager {
 	managerInit.Do(initManagers)
 
 	slog.Debug("Getting managers", "dataType", dataType, "eventType", eventType)
+	managerLock.RLock()
+	defer managerLock.RUnlock()
+
 	v, ok := managerMap[fmt.Sprintf("%s-%s", dataType, eventType)]
 	if !ok {
 		slog.Debug("Unknown manager type", "type", fmt.Sprintf("%s-%s", dataType, eventType))
@@ -85,6 +525,17 @@ func GetManagersForType(dataType, eventType string) []BufferManager {
 	return v
 }
 
+// GetManager returns the manager for the forwarder with name
+func GetManager(name string) (BufferManager, bool) {
+	managerInit.Do(initManagers)
+
+	managerLock.RLock()
+	defer managerLock.RUnlock()
+
+	f, ok := forwarders[name]
+	return f.manager, ok
+}
+
 // GetIndexFunction .
 func GetIndexFunction(indexPattern, rotationInterval string) func() string {
 	switch rotationInterval {
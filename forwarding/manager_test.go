@@ -0,0 +1,249 @@
+package forwarding
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/byuoitav/event-forwarding-microservice/config"
+	"github.com/byuoitav/event-forwarding-microservice/events"
+	"github.com/byuoitav/event-forwarding-microservice/forwarding/managers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fileForwarder(t *testing.T, name string) config.Forwarder {
+	dir := t.TempDir()
+
+	// cleanups run last first, so this stops the forwarder before its directory is removed
+	closeAll(t)
+
+	return config.Forwarder{
+		Name:      name,
+		Type:      config.FILE,
+		EventType: config.ALL,
+		DataType:  config.EVENT,
+		Interval:  1,
+		File: config.FileForwarder{
+			Directory:        dir,
+			FilePattern:      "events",
+			RotationInterval: config.NOROTATE,
+		},
+	}
+}
+
+// closeAll stops every manager started by a test
+func closeAll(t *testing.T) {
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		_, err := Close(ctx)
+		assert.NoError(t, err)
+	})
+}
+
+func running() []string {
+	managerLock.RLock()
+	defer managerLock.RUnlock()
+
+	var names []string
+	for name := range forwarders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func TestApplyConfig(t *testing.T) {
+	closeAll(t)
+
+	a, b := fileForwarder(t, "Archive"), fileForwarder(t, "Backup")
+	ApplyConfig(config.Config{Forwarders: []config.Forwarder{a, b, b}})
+
+	// a duplicate name gets a suffix
+	assert.Equal(t, []string{"Archive", "Backup", "Backup-1"}, running())
+	assert.Len(t, GetManagersForType(config.EVENT, config.ALL), 3)
+
+	archive, ok := GetManager("Archive")
+	require.True(t, ok)
+	backup, _ := GetManager("Backup")
+	duplicate, _ := GetManager("Backup-1")
+
+	// Archive is unchanged, Backup is changed, and the duplicate is removed
+	b.Interval = 2
+	ApplyConfig(config.Config{Forwarders: []config.Forwarder{a, b}})
+	assert.Equal(t, []string{"Archive", "Backup"}, running())
+	assert.Len(t, GetManagersForType(config.EVENT, config.ALL), 2)
+
+	m, _ := GetManager("Archive")
+	assert.Same(t, archive, m)
+	require.NoError(t, m.Send(events.Event{Key: "power"}))
+
+	m, _ = GetManager("Backup")
+	assert.NotSame(t, backup, m)
+	require.NoError(t, m.Send(events.Event{Key: "power"}))
+
+	// the replaced and removed managers are closed in the background
+	for _, old := range []BufferManager{backup, duplicate} {
+		assert.Eventually(t, func() bool {
+			return old.Send(events.Event{Key: "power"}) == managers.ErrClosed
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+
+	// removing everything
+	ApplyConfig(config.Config{})
+	assert.Empty(t, running())
+	assert.Empty(t, GetManagersForType(config.EVENT, config.ALL))
+	assert.Eventually(t, func() bool {
+		return archive.Send(events.Event{Key: "power"}) == managers.ErrClosed
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestApplyConfigUnknownForwarder(t *testing.T) {
+	closeAll(t)
+
+	a := fileForwarder(t, "Archive")
+	unknown := config.Forwarder{Name: "Unknown", Type: "unknown", DataType: config.EVENT, EventType: config.ALL}
+	ApplyConfig(config.Config{Forwarders: []config.Forwarder{a, unknown}})
+
+	assert.Equal(t, []string{"Archive"}, running())
+	_, ok := GetManager("Unknown")
+	assert.False(t, ok)
+}
+
+func TestApplyConfigWAL(t *testing.T) {
+	closeAll(t)
+
+	var mu sync.Mutex
+	var keys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e events.Event
+		b, _ := io.ReadAll(r.Body)
+		assert.NoError(t, json.Unmarshal(b, &e))
+
+		mu.Lock()
+		defer mu.Unlock()
+		keys = append(keys, e.Key)
+	}))
+	defer server.Close()
+
+	sent := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), keys...)
+	}
+
+	f := config.Forwarder{
+		Name:      "Webhook",
+		Type:      config.WEBHOOK,
+		EventType: config.ALL,
+		DataType:  config.EVENT,
+		Interval:  60,
+		Webhook:   config.WebhookForwarder{URL: server.URL},
+		WAL:       config.WALConfig{Directory: t.TempDir()},
+	}
+	ApplyConfig(config.Config{Forwarders: []config.Forwarder{f}})
+
+	m, ok := GetManager("Webhook")
+	require.True(t, ok)
+	require.NoError(t, m.Send(events.Event{Key: "power"}))
+	require.NoError(t, m.Send(events.Event{Key: "input"}))
+
+	// the old manager has flushed by the time it's replaced, and the new one doesn't replay what it sent
+	f.Interval = 61
+	ApplyConfig(config.Config{Forwarders: []config.Forwarder{f}})
+	assert.Equal(t, []string{"power", "input"}, sent())
+
+	m, _ = GetManager("Webhook")
+	require.NoError(t, m.Send(events.Event{Key: "volume"}))
+
+	ApplyConfig(config.Config{})
+	assert.Equal(t, []string{"power", "input", "volume"}, sent())
+}
+
+func TestApplyConfigWALDoesntBlock(t *testing.T) {
+	closeAll(t)
+
+	// the first request hangs until it's released
+	release := make(chan struct{})
+	var once sync.Once
+	var mu sync.Mutex
+	var keys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e events.Event
+		b, _ := io.ReadAll(r.Body)
+		assert.NoError(t, json.Unmarshal(b, &e))
+
+		once.Do(func() { <-release })
+
+		mu.Lock()
+		defer mu.Unlock()
+		keys = append(keys, e.Key)
+	}))
+	t.Cleanup(server.Close)
+
+	f := config.Forwarder{
+		Name:      "Webhook",
+		Type:      config.WEBHOOK,
+		EventType: config.ALL,
+		DataType:  config.EVENT,
+		Interval:  60,
+		Webhook:   config.WebhookForwarder{URL: server.URL},
+		WAL:       config.WALConfig{Directory: t.TempDir()},
+	}
+	ApplyConfig(config.Config{Forwarders: []config.Forwarder{f}})
+
+	m, ok := GetManager("Webhook")
+	require.True(t, ok)
+	require.NoError(t, m.Send(events.Event{Key: "power"}))
+
+	f.Interval = 61
+	applied := make(chan struct{})
+	go func() {
+		defer close(applied)
+		ApplyConfig(config.Config{Forwarders: []config.Forwarder{f}})
+	}()
+
+	// while the old manager is stuck flushing, managers can still be looked up, and what it's sent is kept for the new one
+	time.Sleep(50 * time.Millisecond)
+	looked := make(chan []BufferManager, 1)
+	go func() { looked <- GetManagersForType(config.EVENT, config.ALL) }()
+
+	select {
+	case list := <-looked:
+		require.Len(t, list, 1)
+		require.NoError(t, list[0].Send(events.Event{Key: "input"}))
+	case <-time.After(time.Second):
+		t.Fatal("looking up managers blocked while a manager was being replaced")
+	}
+
+	close(release)
+	<-applied
+
+	ApplyConfig(config.Config{})
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"power", "input"}, keys)
+}
+
+func TestApplyConfigBadFilter(t *testing.T) {
+	closeAll(t)
+
+	a, b := fileForwarder(t, "Archive"), fileForwarder(t, "Backup")
+	b.Filter.Expression = `designation = "production"`
+	ApplyConfig(config.Config{Forwarders: []config.Forwarder{a, b}})
+
+	// a forwarder whose filter can't be built isn't started, rather than being sent everything
+	assert.Equal(t, []string{"Archive"}, running())
+	_, ok := GetManager("Backup")
+	assert.False(t, ok)
+}
@@ -9,13 +9,17 @@ import (
 	"time"
 
 	"github.com/byuoitav/event-forwarding-microservice/couch"
+	"github.com/byuoitav/event-forwarding-microservice/metrics"
 	sd "github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
+	"github.com/byuoitav/event-forwarding-microservice/wal"
 )
 
 // CouchStaticDevice is just an sd StaticDevice with an _id and a _rev
 type CouchStaticDevice struct {
 	sd.StaticDevice
 	Rev
+
+	Deleted bool `json:"_deleted,omitempty"`
 }
 
 // Rev is a utility struct used for updating revisions
@@ -25,10 +29,13 @@ type Rev struct {
 }
 
 // GetDefaultCouchDeviceBuffer starts and returns a buffer manager
-func GetDefaultCouchDeviceBuffer(couchaddr, database string, interval time.Duration) *CouchDeviceBuffer {
+func GetDefaultCouchDeviceBuffer(couchaddr, database string, interval time.Duration, log *wal.Log, stats *metrics.Forwarder) *CouchDeviceBuffer {
 	//we'll need to initialize from the server
 	val := &CouchDeviceBuffer{
+		lifecycle:          newLifecycle(),
+		journal:            newJournal(log),
 		incomingChannel:    make(chan sd.StaticDevice, 10000),
+		deleteChannel:      make(chan string, 1000),
 		reingestionChannel: make(chan CouchStaticDevice, 1000),
 		revChannel:         make(chan []Rev, 100),
 
@@ -37,15 +44,41 @@ func GetDefaultCouchDeviceBuffer(couchaddr, database string, interval time.Durat
 		interval:  interval,
 		database:  database,
 		couchaddr: couchaddr,
+		stats:     stats,
 	}
 
+	val.replay(func(item json.RawMessage) error {
+		// devices are recorded as they are, deletes as a deviceRecord
+		var rec deviceRecord
+		if err := json.Unmarshal(item, &rec); err != nil {
+			return err
+		}
+
+		if len(rec.Delete) > 0 {
+			val.delete(rec.Delete)
+			return nil
+		}
+
+		var dev sd.StaticDevice
+		if err := json.Unmarshal(item, &dev); err != nil {
+			return err
+		}
+
+		val.buffer(dev)
+		return nil
+	})
+
 	go val.start()
 	return val
 }
 
 // CouchDeviceBuffer takes a static device and buffers them for storage in couch
 type CouchDeviceBuffer struct {
+	lifecycle
+	journal
+
 	incomingChannel    chan sd.StaticDevice
+	deleteChannel      chan string
 	reingestionChannel chan CouchStaticDevice
 	revChannel         chan []Rev
 
@@ -55,6 +88,7 @@ type CouchDeviceBuffer struct {
 	interval  time.Duration
 	database  string
 	couchaddr string
+	stats     *metrics.Forwarder
 }
 
 // Send fulfils the manager interface
@@ -64,8 +98,33 @@ func (c *CouchDeviceBuffer) Send(toSend interface{}) error {
 		return errors.New("invalid type, couch device buffer expects a StaticDevice")
 	}
 
-	c.incomingChannel <- dev
+	if c.closed() {
+		return ErrClosed
+	}
+
+	select {
+	case c.incomingChannel <- dev:
+	case <-c.stopped:
+		return ErrClosed
+	}
+
+	c.record(dev)
+	return nil
+}
+
+// Delete removes a device from the database
+func (c *CouchDeviceBuffer) Delete(id string) error {
+	if c.closed() {
+		return ErrClosed
+	}
+
+	select {
+	case c.deleteChannel <- id:
+	case <-c.stopped:
+		return ErrClosed
+	}
 
+	c.record(deviceRecord{Delete: id})
 	return nil
 }
 
@@ -80,7 +139,7 @@ func (c *CouchDeviceBuffer) start() {
 			slog.Debug("Sending bulk ELK update", "database", c.database)
 
 			//send the current one
-			sendBulkDeviceUpdate(c.curBuffer, c.revChannel, c.reingestionChannel, c.couchaddr, c.database)
+			c.flush()
 
 			//create a fresh buffer
 			c.curBuffer = make(map[string]CouchStaticDevice)
@@ -89,17 +148,69 @@ func (c *CouchDeviceBuffer) start() {
 			slog.Debug("Received device", "device", dev)
 			c.buffer(dev)
 
+		case id := <-c.deleteChannel:
+			c.delete(id)
+
 		case revs := <-c.revChannel:
 			slog.Debug("Updating revision numbers")
 			c.updateRevs(revs)
 		case redo := <-c.reingestionChannel:
 			//just dump it in, it's updated
-			c.curBuffer[redo.DeviceID] = redo
-			c.revBuffer[redo.DeviceID] = redo.Rev
+			c.redo(redo)
+		case req := <-c.closeChannel:
+			ticker.Stop()
+			c.drain()
+
+			slog.Info("Flushing couch buffer before closing", "database", c.database, "items", len(c.curBuffer))
+			result := c.flush()
+			c.curBuffer = make(map[string]CouchStaticDevice)
+
+			// conflicts are resolved in the background, which won't happen now
+			c.finish(req, result, nil)
+			return
 		}
 	}
 }
 
+// drain buffers anything left in the incoming channels
+func (c *CouchDeviceBuffer) drain() {
+	for {
+		select {
+		case dev := <-c.incomingChannel:
+			c.buffer(dev)
+		case id := <-c.deleteChannel:
+			c.delete(id)
+		case revs := <-c.revChannel:
+			c.updateRevs(revs)
+		case redo := <-c.reingestionChannel:
+			c.redo(redo)
+		default:
+			return
+		}
+	}
+}
+
+// flush sends the current buffer, acking the write ahead log if it made it to couch
+func (c *CouchDeviceBuffer) flush() FlushResult {
+	m, b := c.checkpoint(c.drain), c.stats.Take()
+
+	start := time.Now()
+	sent, err := sendBulkDeviceUpdate(c.curBuffer, c.revChannel, c.reingestionChannel, c.record, c.couchaddr, c.database)
+	if len(c.curBuffer) > 0 {
+		c.stats.Observe(start)
+	}
+
+	if err != nil {
+		slog.Error("Couldn't send bulk couch update", "database", c.database, "error", err)
+		b.Done(0, len(c.curBuffer))
+		return FlushResult{Abandoned: len(c.curBuffer)}
+	}
+
+	c.ack(m)
+	b.Done(sent, len(c.curBuffer)-sent)
+	return FlushResult{Flushed: sent, Abandoned: len(c.curBuffer) - sent}
+}
+
 func (c *CouchDeviceBuffer) reingest(dev CouchStaticDevice) {
 
 	//check to see if we've gotten a new update
@@ -114,15 +225,26 @@ func (c *CouchDeviceBuffer) reingest(dev CouchStaticDevice) {
 	c.revBuffer[dev.DeviceID] = dev.Rev
 }
 
-func (c *CouchDeviceBuffer) buffer(dev sd.StaticDevice) {
+// redo buffers a device that has to be sent again with its updated _rev
+func (c *CouchDeviceBuffer) redo(dev CouchStaticDevice) {
+	if _, ok := c.curBuffer[dev.DeviceID]; !ok {
+		c.stats.Buffered()
+	}
+
+	c.curBuffer[dev.DeviceID] = dev
+	c.revBuffer[dev.DeviceID] = dev.Rev
+}
 
+func (c *CouchDeviceBuffer) buffer(dev sd.StaticDevice) {
 	//check to see if it's in the cur buffer, if not, get it's _rev from the revBuffer
 	if v, ok := c.curBuffer[dev.DeviceID]; ok {
 		v.StaticDevice = dev
+		v.Deleted = false
 		c.curBuffer[dev.DeviceID] = v
 
 		return
 	}
+	c.stats.Buffered()
 
 	//check the rev table
 	if v, ok := c.revBuffer[dev.DeviceID]; ok {
@@ -141,6 +263,28 @@ func (c *CouchDeviceBuffer) buffer(dev sd.StaticDevice) {
 	}
 }
 
+// delete replaces anything buffered for the device with a delete, which needs the device's current _rev
+func (c *CouchDeviceBuffer) delete(id string) {
+	if len(id) < 1 {
+		return
+	}
+
+	if _, ok := c.curBuffer[id]; !ok {
+		c.stats.Buffered()
+	}
+
+	rev, ok := c.revBuffer[id]
+	if !ok {
+		rev = Rev{ID: id}
+	}
+
+	c.curBuffer[id] = CouchStaticDevice{
+		StaticDevice: sd.StaticDevice{DeviceID: id},
+		Rev:          rev,
+		Deleted:      true,
+	}
+}
+
 func (c *CouchDeviceBuffer) updateRevs(r []Rev) {
 	for i := range r {
 		if v, ok := c.curBuffer[r[i].ID]; ok {
@@ -168,12 +312,13 @@ type CouchBulkUpdateResponse struct {
 	Reason   string `json:"reason,omitempty"`
 }
 
-// assume is run in go routine
-func sendBulkDeviceUpdate(toSend map[string]CouchStaticDevice, returnChan chan<- []Rev, reingestionChannel chan<- CouchStaticDevice, addr, database string) {
+// sendBulkDeviceUpdate returns how many of the devices couch accepted. Devices with conflicts are sent down
+// reingestionChannel with their current _rev, and passed to record once they have been.
+func sendBulkDeviceUpdate(toSend map[string]CouchStaticDevice, returnChan chan<- []Rev, reingestionChannel chan<- CouchStaticDevice, record func(interface{}), addr, database string) (int, error) {
 
 	if len(toSend) < 1 {
 		slog.Info("No devices to send, returning...", "addr", addr, "database", database)
-		return
+		return 0, nil
 	}
 	slog.Info("Sending bulk update", "addr", addr, "database", database)
 
@@ -191,7 +336,7 @@ func sendBulkDeviceUpdate(toSend map[string]CouchStaticDevice, returnChan chan<-
 	)
 	if err != nil {
 		slog.Error("Bad response received from Couch", "error", err.Error())
-		return
+		return 0, fmt.Errorf("couldn't send bulk update: %w", err)
 	}
 	//we unmarshal the response into the update respons
 	var respArray []CouchBulkUpdateResponse
@@ -199,7 +344,7 @@ func sendBulkDeviceUpdate(toSend map[string]CouchStaticDevice, returnChan chan<-
 	er := json.Unmarshal(resp, &respArray)
 	if er != nil {
 		slog.Error("Unknown response received", "error", er.Error(), "response", string(resp))
-		return
+		return 0, fmt.Errorf("couldn't parse bulk update response: %w", er)
 	}
 	toReturn := []Rev{}
 
@@ -222,8 +367,9 @@ func sendBulkDeviceUpdate(toSend map[string]CouchStaticDevice, returnChan chan<-
 		}
 	}
 
-	go getUpdatedRevs(addr, database, toBeFixed, reingestionChannel)
+	go getUpdatedRevs(addr, database, toBeFixed, reingestionChannel, record)
 	returnChan <- toReturn
+	return len(toReturn), nil
 }
 
 // CouchBulkRequestItem .
@@ -247,7 +393,7 @@ type CouchBulkDevicesResponse struct {
 	} `json:"results"`
 }
 
-func getUpdatedRevs(addr, database string, toBeFixed map[string]CouchStaticDevice, reingestionChannel chan<- CouchStaticDevice) {
+func getUpdatedRevs(addr, database string, toBeFixed map[string]CouchStaticDevice, reingestionChannel chan<- CouchStaticDevice, record func(interface{})) {
 	if len(toBeFixed) < 1 {
 		slog.Debug("No updated revs to get. Returning")
 		return
@@ -283,6 +429,13 @@ func getUpdatedRevs(addr, database string, toBeFixed map[string]CouchStaticDevic
 			v.Rev = rr.Results[i].Docs[0].OK.Rev
 
 			reingestionChannel <- v
+
+			// a delete has to be replayed as a delete, not as the device it's removing
+			if v.Deleted {
+				record(deviceRecord{Delete: v.DeviceID})
+			} else {
+				record(v.StaticDevice)
+			}
 		} else {
 			slog.Error("Unknown key requested while getting updated revs", "id", rr.Results[i].ID, "error", rr.Results[i].Docs[0].Error.Error, "reason", rr.Results[i].Docs[0].Error.Reason)
 		}
@@ -0,0 +1,69 @@
+package managers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/byuoitav/event-forwarding-microservice/metrics"
+	sd "github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCouchBufferAfterDelete(t *testing.T) {
+	stats := metrics.NewForwarder(t.Name())
+	defer metrics.RemoveForwarder(t.Name())
+
+	c := &CouchDeviceBuffer{
+		curBuffer: make(map[string]CouchStaticDevice),
+		revBuffer: map[string]Rev{"ITB-1101-D1": {ID: "ITB-1101-D1", Revision: "1-abc"}},
+		stats:     stats,
+	}
+
+	c.delete("ITB-1101-D1")
+	require.True(t, c.curBuffer["ITB-1101-D1"].Deleted)
+
+	// an update after a delete puts the device back
+	c.buffer(sd.StaticDevice{DeviceID: "ITB-1101-D1", Power: "on"})
+	dev := c.curBuffer["ITB-1101-D1"]
+	assert.False(t, dev.Deleted)
+	assert.Equal(t, "on", dev.Power)
+	assert.Equal(t, "1-abc", dev.Revision)
+
+	assert.Equal(t, 1.0, bufferedTotal(t, t.Name()))
+}
+
+func TestCouchReingestRecordsDeletes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/devices/_bulk_get", r.URL.Path)
+
+		w.Write([]byte(`{"results": [
+			{"id": "ITB-1101-D1", "docs": [{"ok": {"deviceID": "ITB-1101-D1", "_id": "ITB-1101-D1", "_rev": "2-def"}}]},
+			{"id": "ITB-1101-D2", "docs": [{"ok": {"deviceID": "ITB-1101-D2", "_id": "ITB-1101-D2", "_rev": "3-ghi"}}]}
+		]}`))
+	}))
+	defer server.Close()
+
+	toBeFixed := map[string]CouchStaticDevice{
+		"ITB-1101-D1": {StaticDevice: sd.StaticDevice{DeviceID: "ITB-1101-D1"}, Rev: Rev{ID: "ITB-1101-D1", Revision: "1-abc"}, Deleted: true},
+		"ITB-1101-D2": {StaticDevice: sd.StaticDevice{DeviceID: "ITB-1101-D2", Power: "on"}, Rev: Rev{ID: "ITB-1101-D2", Revision: "2-abc"}},
+	}
+
+	reingestion := make(chan CouchStaticDevice, len(toBeFixed))
+	var recorded []interface{}
+	getUpdatedRevs(server.URL, "devices", toBeFixed, reingestion, func(item interface{}) {
+		recorded = append(recorded, item)
+	})
+
+	require.Len(t, reingestion, 2)
+	redo := <-reingestion
+	assert.True(t, redo.Deleted)
+	assert.Equal(t, "2-def", redo.Revision)
+
+	// the delete is journaled as a delete, so it isn't replayed as an upsert
+	assert.Equal(t, []interface{}{
+		deviceRecord{Delete: "ITB-1101-D1"},
+		sd.StaticDevice{DeviceID: "ITB-1101-D2", Power: "on"},
+	}, recorded)
+}
@@ -0,0 +1,151 @@
+package managers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/byuoitav/event-forwarding-microservice/elk"
+	"github.com/byuoitav/event-forwarding-microservice/metrics"
+	"github.com/byuoitav/event-forwarding-microservice/structs"
+	"github.com/byuoitav/event-forwarding-microservice/transform"
+	"github.com/byuoitav/event-forwarding-microservice/wal"
+)
+
+// ElkStaticIssueForwarder is for room issues. Issues are always indexed by their ID, so each update replaces the last.
+type ElkStaticIssueForwarder struct {
+	ElkStaticForwarder
+	incomingChannel chan structs.RoomIssue
+	buffer          map[string]elk.ElkBulkUpdateItem
+}
+
+// GetDefaultElkStaticIssueForwarder returns a regular static issue forwarder with a buffer size of 10000
+func GetDefaultElkStaticIssueForwarder(URL string, index func() string, interval time.Duration, retry elk.RetryPolicy, deadLetter elk.DeadLetterSink, log *wal.Log, transforms transform.Chain, stats *metrics.Forwarder) *ElkStaticIssueForwarder {
+	toReturn := &ElkStaticIssueForwarder{
+		ElkStaticForwarder: ElkStaticForwarder{
+			lifecycle:  newLifecycle(),
+			interval:   interval,
+			url:        URL,
+			index:      index,
+			retry:      retry,
+			deadLetter: deadLetter,
+			journal:    newJournal(log),
+			transform:  transforms,
+			stats:      stats,
+		},
+		incomingChannel: make(chan structs.RoomIssue, 10000),
+		buffer:          make(map[string]elk.ElkBulkUpdateItem),
+	}
+
+	toReturn.replay(func(item json.RawMessage) error {
+		var issue structs.RoomIssue
+		if err := json.Unmarshal(item, &issue); err != nil {
+			return err
+		}
+
+		toReturn.bufferevent(issue)
+		return nil
+	})
+
+	go toReturn.start()
+
+	return toReturn
+}
+
+// Send takes a room issue and adds it to the buffer
+func (e *ElkStaticIssueForwarder) Send(toSend interface{}) error {
+	var issue structs.RoomIssue
+
+	switch v := toSend.(type) {
+	case *structs.RoomIssue:
+		issue = *v
+	case structs.RoomIssue:
+		issue = v
+	default:
+		return errors.New("Invalid type to send via an Elk issue Forwarder, must be a room issue as defined in structs")
+	}
+
+	if e.closed() {
+		return ErrClosed
+	}
+
+	select {
+	case e.incomingChannel <- issue:
+	case <-e.stopped:
+		return ErrClosed
+	}
+
+	e.record(issue)
+	return nil
+}
+
+func (e *ElkStaticIssueForwarder) start() {
+	slog.Info("Starting issue forwarder", "index", e.index())
+	ticker := time.NewTicker(e.interval)
+
+	for {
+		select {
+		case <-ticker.C:
+			//send it off
+			slog.Debug("Sending bulk ELK update", "index", e.index())
+
+			m := e.checkpoint(e.drain)
+			toSend, b := e.buffer, e.stats.Take()
+			e.goSend(func() { e.prepAndForward(context.Background(), toSend, m, b) })
+			e.buffer = make(map[string]elk.ElkBulkUpdateItem)
+
+		case issue := <-e.incomingChannel:
+			e.bufferevent(issue)
+		case req := <-e.closeChannel:
+			ticker.Stop()
+			e.drain()
+
+			slog.Info("Flushing forwarder before closing", "index", e.index(), "items", len(e.buffer))
+			m, b := e.checkpoint(e.drain), e.stats.Take()
+			failed := e.prepAndForward(req.ctx, e.buffer, m, b)
+			result := FlushResult{Flushed: len(e.buffer) - failed, Abandoned: failed}
+			e.buffer = make(map[string]elk.ElkBulkUpdateItem)
+
+			e.finish(req, result, nil)
+			return
+		}
+	}
+}
+
+// drain buffers anything left in the incoming channel
+func (e *ElkStaticIssueForwarder) drain() {
+	for {
+		select {
+		case issue := <-e.incomingChannel:
+			e.bufferevent(issue)
+		default:
+			return
+		}
+	}
+}
+
+func (e *ElkStaticIssueForwarder) bufferevent(issue structs.RoomIssue) {
+	if len(issue.RoomIssueID) < 1 {
+		return
+	}
+
+	doc, ok := e.transformDoc(issue)
+	if !ok {
+		return
+	}
+
+	// a newer version of an issue that's already buffered replaces it, and isn't counted again
+	if _, ok := e.buffer[issue.RoomIssueID]; !ok {
+		e.stats.Buffered()
+	}
+
+	e.buffer[issue.RoomIssueID] = elk.ElkBulkUpdateItem{
+		Index: elk.ElkUpdateHeader{Header: elk.HeaderIndex{
+			Index: e.index(),
+			ID:    issue.RoomIssueID,
+		}},
+		Doc: doc,
+	}
+}
@@ -1,12 +1,17 @@
 package managers
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"log/slog"
 	"time"
 
 	"github.com/byuoitav/event-forwarding-microservice/elk"
+	"github.com/byuoitav/event-forwarding-microservice/metrics"
 	sd "github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
+	"github.com/byuoitav/event-forwarding-microservice/transform"
+	"github.com/byuoitav/event-forwarding-microservice/wal"
 )
 
 // ElkStaticDeviceForwarder is for a device
@@ -29,24 +34,64 @@ type ElkStaticRoomForwarder struct {
 
 // ElkStaticForwarder is the general stuff
 type ElkStaticForwarder struct {
-	interval time.Duration //how often to send an update
-	url      string
-	index    func() string //function to get the indexA
+	lifecycle
+	journal
+
+	interval   time.Duration //how often to send an update
+	url        string
+	index      func() string //function to get the indexA
+	retry      elk.RetryPolicy
+	deadLetter elk.DeadLetterSink
+	transform  transform.Chain
+	stats      *metrics.Forwarder
+}
+
+// deviceRecord is how buffered devices and deletes are written to the write ahead log
+type deviceRecord struct {
+	Device *sd.StaticDevice `json:"device,omitempty"`
+	Delete string           `json:"delete,omitempty"`
+}
+
+// roomRecord is how buffered rooms and deletes are written to the write ahead log
+type roomRecord struct {
+	Room   *sd.StaticRoom `json:"room,omitempty"`
+	Delete string         `json:"delete,omitempty"`
 }
 
 // GetDefaultElkStaticDeviceForwarder returns a regular static device forwarder with a buffer size of 10000
-func GetDefaultElkStaticDeviceForwarder(URL string, index func() string, interval time.Duration, update bool) *ElkStaticDeviceForwarder {
+func GetDefaultElkStaticDeviceForwarder(URL string, index func() string, interval time.Duration, update bool, retry elk.RetryPolicy, deadLetter elk.DeadLetterSink, log *wal.Log, transforms transform.Chain, stats *metrics.Forwarder) *ElkStaticDeviceForwarder {
 	toReturn := &ElkStaticDeviceForwarder{
 		ElkStaticForwarder: ElkStaticForwarder{
-			interval: interval,
-			url:      URL,
-			index:    index,
+			lifecycle:  newLifecycle(),
+			interval:   interval,
+			url:        URL,
+			index:      index,
+			retry:      retry,
+			deadLetter: deadLetter,
+			journal:    newJournal(log),
+			transform:  transforms,
+			stats:      stats,
 		},
 		update:          update,
 		incomingChannel: make(chan sd.StaticDevice, 10000),
+		deleteChannel:   make(chan string, 1000),
 		buffer:          make(map[string]elk.ElkBulkUpdateItem),
 	}
 
+	toReturn.replay(func(item json.RawMessage) error {
+		var rec deviceRecord
+		if err := json.Unmarshal(item, &rec); err != nil {
+			return err
+		}
+
+		if rec.Device != nil {
+			toReturn.bufferevent(*rec.Device)
+		} else {
+			toReturn.deleteRecord(rec.Delete)
+		}
+		return nil
+	})
+
 	go toReturn.start()
 
 	return toReturn
@@ -65,8 +110,17 @@ func (e *ElkStaticDeviceForwarder) Send(toSend interface{}) error {
 		return errors.New("Invalid type to send via an Elk device Forwarder, must be a static device as defined in state/statedefinition")
 	}
 
-	e.incomingChannel <- event
+	if e.closed() {
+		return ErrClosed
+	}
 
+	select {
+	case e.incomingChannel <- event:
+	case <-e.stopped:
+		return ErrClosed
+	}
+
+	e.record(deviceRecord{Device: &event})
 	return nil
 }
 
@@ -83,36 +137,86 @@ func (e *ElkStaticRoomForwarder) Send(toSend interface{}) error {
 		return errors.New("Invalid type to send via an Elk room Forwarder, must be a static room as defined in state/statedefinition")
 	}
 
-	e.incomingChannel <- event
+	if e.closed() {
+		return ErrClosed
+	}
 
+	select {
+	case e.incomingChannel <- event:
+	case <-e.stopped:
+		return ErrClosed
+	}
+
+	e.record(roomRecord{Room: &event})
 	return nil
 }
 
-// Delete .
+// Delete removes a room from the index
 func (e *ElkStaticRoomForwarder) Delete(id string) error {
-	e.deleteChannel <- id
+	if e.closed() {
+		return ErrClosed
+	}
+
+	select {
+	case e.deleteChannel <- id:
+	case <-e.stopped:
+		return ErrClosed
+	}
+
+	e.record(roomRecord{Delete: id})
 	return nil
 }
 
-// Delete .
+// Delete removes a device from the index
 func (e *ElkStaticDeviceForwarder) Delete(id string) error {
-	e.deleteChannel <- id
+	if e.closed() {
+		return ErrClosed
+	}
+
+	select {
+	case e.deleteChannel <- id:
+	case <-e.stopped:
+		return ErrClosed
+	}
+
+	e.record(deviceRecord{Delete: id})
 	return nil
 }
 
 // GetDefaultElkStaticRoomForwarder returns a regular static room forwarder with a buffer size of 10000
-func GetDefaultElkStaticRoomForwarder(URL string, index func() string, interval time.Duration, update bool) *ElkStaticRoomForwarder {
+func GetDefaultElkStaticRoomForwarder(URL string, index func() string, interval time.Duration, update bool, retry elk.RetryPolicy, deadLetter elk.DeadLetterSink, log *wal.Log, transforms transform.Chain, stats *metrics.Forwarder) *ElkStaticRoomForwarder {
 	toReturn := &ElkStaticRoomForwarder{
 		ElkStaticForwarder: ElkStaticForwarder{
-			interval: interval,
-			url:      URL,
-			index:    index,
+			lifecycle:  newLifecycle(),
+			interval:   interval,
+			url:        URL,
+			index:      index,
+			retry:      retry,
+			deadLetter: deadLetter,
+			journal:    newJournal(log),
+			transform:  transforms,
+			stats:      stats,
 		},
 		incomingChannel: make(chan sd.StaticRoom, 10000),
+		deleteChannel:   make(chan string, 1000),
 		buffer:          make(map[string]elk.ElkBulkUpdateItem),
 		update:          update,
 	}
 
+	toReturn.replay(func(item json.RawMessage) error {
+		var rec roomRecord
+		if err := json.Unmarshal(item, &rec); err != nil {
+			return err
+		}
+
+		if rec.Room != nil {
+			toReturn.bufferevent(*rec.Room)
+		} else {
+			toReturn.deleteRecord(rec.Delete)
+		}
+		return nil
+	})
+
 	go toReturn.start()
 
 	return toReturn
@@ -128,13 +232,27 @@ func (e *ElkStaticDeviceForwarder) start() {
 			//send it off
 			slog.Debug("Sending bulk ELK update", "index", e.index())
 
-			go prepAndForward(e.index(), e.url, e.buffer)
+			m := e.checkpoint(e.drain)
+			toSend, b := e.buffer, e.stats.Take()
+			e.goSend(func() { e.prepAndForward(context.Background(), toSend, m, b) })
 			e.buffer = make(map[string]elk.ElkBulkUpdateItem)
 
 		case event := <-e.incomingChannel:
 			e.bufferevent(event)
 		case id := <-e.deleteChannel:
 			e.deleteRecord(id)
+		case req := <-e.closeChannel:
+			ticker.Stop()
+			e.drain()
+
+			slog.Info("Flushing forwarder before closing", "index", e.index(), "items", len(e.buffer))
+			m, b := e.checkpoint(e.drain), e.stats.Take()
+			failed := e.prepAndForward(req.ctx, e.buffer, m, b)
+			result := FlushResult{Flushed: len(e.buffer) - failed, Abandoned: failed}
+			e.buffer = make(map[string]elk.ElkBulkUpdateItem)
+
+			e.finish(req, result, nil)
+			return
 		}
 	}
 }
@@ -149,13 +267,55 @@ func (e *ElkStaticRoomForwarder) start() {
 			//send it off
 			slog.Debug("Sending bulk ELK update", "index", e.index())
 
-			go prepAndForward(e.index(), e.url, e.buffer)
+			m := e.checkpoint(e.drain)
+			toSend, b := e.buffer, e.stats.Take()
+			e.goSend(func() { e.prepAndForward(context.Background(), toSend, m, b) })
 			e.buffer = make(map[string]elk.ElkBulkUpdateItem)
 
 		case event := <-e.incomingChannel:
 			e.bufferevent(event)
 		case id := <-e.deleteChannel:
 			e.deleteRecord(id)
+		case req := <-e.closeChannel:
+			ticker.Stop()
+			e.drain()
+
+			slog.Info("Flushing forwarder before closing", "index", e.index(), "items", len(e.buffer))
+			m, b := e.checkpoint(e.drain), e.stats.Take()
+			failed := e.prepAndForward(req.ctx, e.buffer, m, b)
+			result := FlushResult{Flushed: len(e.buffer) - failed, Abandoned: failed}
+			e.buffer = make(map[string]elk.ElkBulkUpdateItem)
+
+			e.finish(req, result, nil)
+			return
+		}
+	}
+}
+
+// drain buffers anything left in the incoming channels
+func (e *ElkStaticDeviceForwarder) drain() {
+	for {
+		select {
+		case event := <-e.incomingChannel:
+			e.bufferevent(event)
+		case id := <-e.deleteChannel:
+			e.deleteRecord(id)
+		default:
+			return
+		}
+	}
+}
+
+// drain buffers anything left in the incoming channels
+func (e *ElkStaticRoomForwarder) drain() {
+	for {
+		select {
+		case event := <-e.incomingChannel:
+			e.bufferevent(event)
+		case id := <-e.deleteChannel:
+			e.deleteRecord(id)
+		default:
+			return
 		}
 	}
 }
@@ -165,6 +325,11 @@ func (e *ElkStaticDeviceForwarder) bufferevent(event sd.StaticDevice) {
 		return
 	}
 
+	doc, ok := e.transformDoc(event)
+	if !ok {
+		return
+	}
+
 	//check to see if we already have one for this device
 	v, ok := e.buffer[event.DeviceID]
 	if !ok {
@@ -176,14 +341,14 @@ func (e *ElkStaticDeviceForwarder) bufferevent(event sd.StaticDevice) {
 		}
 		e.buffer[event.DeviceID] = elk.ElkBulkUpdateItem{
 			Index: elk.ElkUpdateHeader{Header: Header},
-			Doc:   event,
+			Doc:   doc,
 		}
+		e.stats.Buffered()
 	} else {
-		//we replace
-		v.Doc = event
+		//we replace, it's already counted
+		v.Doc = doc
 		e.buffer[event.DeviceID] = v
 	}
-
 }
 
 func (e *ElkStaticDeviceForwarder) deleteRecord(id string) {
@@ -195,6 +360,9 @@ func (e *ElkStaticDeviceForwarder) deleteRecord(id string) {
 		Index: e.index(),
 		ID:    id,
 	}
+	if _, ok := e.buffer[id]; !ok {
+		e.stats.Buffered()
+	}
 	e.buffer[id] = elk.ElkBulkUpdateItem{
 		Delete: elk.ElkDeleteHeader{Header: Header},
 	}
@@ -209,6 +377,9 @@ func (e *ElkStaticRoomForwarder) deleteRecord(id string) {
 		Index: e.index(),
 		ID:    id,
 	}
+	if _, ok := e.buffer[id]; !ok {
+		e.stats.Buffered()
+	}
 	e.buffer[id] = elk.ElkBulkUpdateItem{
 		Delete: elk.ElkDeleteHeader{Header: Header},
 	}
@@ -220,6 +391,11 @@ func (e *ElkStaticRoomForwarder) bufferevent(event sd.StaticRoom) {
 		return
 	}
 
+	doc, ok := e.transformDoc(event)
+	if !ok {
+		return
+	}
+
 	v, ok := e.buffer[event.RoomID]
 	if !ok {
 		Header := elk.HeaderIndex{
@@ -230,19 +406,53 @@ func (e *ElkStaticRoomForwarder) bufferevent(event sd.StaticRoom) {
 		}
 		e.buffer[event.RoomID] = elk.ElkBulkUpdateItem{
 			Index: elk.ElkUpdateHeader{Header: Header},
-			Doc:   event,
+			Doc:   doc,
 		}
+		e.stats.Buffered()
 	} else {
-		v.Doc = event
+		v.Doc = doc
 		e.buffer[event.RoomID] = v
 	}
 }
 
-func prepAndForward(caller, url string, vals map[string]elk.ElkBulkUpdateItem) {
+// transformDoc runs a document through the transform chain. Documents that can't be transformed are dead lettered.
+func (e *ElkStaticForwarder) transformDoc(doc interface{}) (map[string]interface{}, bool) {
+	transformed, err := e.transform.Apply(doc)
+	if err != nil {
+		slog.Error("Couldn't transform document", "index", e.index(), "error", err)
+
+		failed := []elk.FailedItem{{Item: elk.ElkBulkUpdateItem{Doc: doc}, Reason: err.Error()}}
+		if er := e.deadLetter.Write(e.index(), failed); er != nil {
+			slog.Error("Couldn't write document to dead letter sink", "index", e.index(), "error", er)
+		}
+		return nil, false
+	}
+
+	return transformed, true
+}
+
+// prepAndForward sends vals, returning how many items couldn't be sent
+func (e *ElkStaticForwarder) prepAndForward(ctx context.Context, vals map[string]elk.ElkBulkUpdateItem, m wal.Marker, b *metrics.Batch) int {
 	var toUpdate []elk.ElkBulkUpdateItem
 	for _, v := range vals {
 		toUpdate = append(toUpdate, v)
 	}
 
-	elk.BulkForward(caller, url, "", "", toUpdate)
+	start := time.Now()
+	failed, err := elk.BulkForwardWithRetry(ctx, e.index(), e.url, "", "", toUpdate, e.retry, e.deadLetter)
+	if err != nil {
+		slog.Error("Couldn't send bulk ELK update", "index", e.index(), "error", err)
+	}
+
+	if len(toUpdate) > 0 {
+		e.stats.Observe(start)
+	}
+	b.Done(len(toUpdate)-failed, failed)
+
+	// anything that wasn't sent has been dead lettered, unless we ran out of time
+	if ctx.Err() == nil {
+		e.ack(m)
+	}
+
+	return failed
 }
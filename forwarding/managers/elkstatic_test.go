@@ -0,0 +1,84 @@
+package managers
+
+import (
+	"testing"
+
+	"github.com/byuoitav/event-forwarding-microservice/elk"
+	"github.com/byuoitav/event-forwarding-microservice/metrics"
+	sd "github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
+	"github.com/byuoitav/event-forwarding-microservice/structs"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bufferedTotal is how many items the forwarder called name has counted as buffered
+func bufferedTotal(t *testing.T, name string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+
+	for _, family := range families {
+		if family.GetName() != "event_forwarding_forwarder_buffered_total" {
+			continue
+		}
+
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "forwarder" && label.GetValue() == name {
+					return m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+
+	return 0
+}
+
+func TestElkStaticBufferedCount(t *testing.T) {
+	stats := metrics.NewForwarder(t.Name())
+	defer metrics.RemoveForwarder(t.Name())
+
+	index := func() string { return "test" }
+	devices := &ElkStaticDeviceForwarder{
+		ElkStaticForwarder: ElkStaticForwarder{index: index, stats: stats},
+		update:             true,
+		buffer:             make(map[string]elk.ElkBulkUpdateItem),
+	}
+	rooms := &ElkStaticRoomForwarder{
+		ElkStaticForwarder: ElkStaticForwarder{index: index, stats: stats},
+		update:             true,
+		buffer:             make(map[string]elk.ElkBulkUpdateItem),
+	}
+
+	// replacing something already buffered doesn't count it again
+	devices.bufferevent(sd.StaticDevice{DeviceID: "ITB-1101-D1", Power: "on"})
+	devices.bufferevent(sd.StaticDevice{DeviceID: "ITB-1101-D1", Power: "standby"})
+	devices.deleteRecord("ITB-1101-D1")
+	devices.deleteRecord("ITB-1101-D2")
+	devices.bufferevent(sd.StaticDevice{DeviceID: "ITB-1101-D2"})
+	assert.Len(t, devices.buffer, 2)
+
+	rooms.bufferevent(sd.StaticRoom{RoomID: "ITB-1101"})
+	rooms.bufferevent(sd.StaticRoom{RoomID: "ITB-1101"})
+	rooms.deleteRecord("ITB-1101")
+	assert.Len(t, rooms.buffer, 1)
+
+	assert.Equal(t, 3.0, bufferedTotal(t, t.Name()))
+}
+
+func TestElkIssueBufferedCount(t *testing.T) {
+	stats := metrics.NewForwarder(t.Name())
+	defer metrics.RemoveForwarder(t.Name())
+
+	issues := &ElkStaticIssueForwarder{
+		ElkStaticForwarder: ElkStaticForwarder{index: func() string { return "test" }, stats: stats},
+		buffer:             make(map[string]elk.ElkBulkUpdateItem),
+	}
+
+	issues.bufferevent(structs.RoomIssue{RoomIssueID: "ITB-1101-1"})
+	issues.bufferevent(structs.RoomIssue{RoomIssueID: "ITB-1101-1", AlertDevices: []string{"ITB-1101-D1"}})
+	issues.bufferevent(structs.RoomIssue{RoomIssueID: "ITB-1102-1"})
+	assert.Len(t, issues.buffer, 2)
+
+	assert.Equal(t, 2.0, bufferedTotal(t, t.Name()))
+}
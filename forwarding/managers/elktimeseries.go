@@ -1,6 +1,8 @@
 package managers
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"time"
 
@@ -8,6 +10,9 @@ import (
 
 	"github.com/byuoitav/event-forwarding-microservice/elk"
 	"github.com/byuoitav/event-forwarding-microservice/events"
+	"github.com/byuoitav/event-forwarding-microservice/metrics"
+	"github.com/byuoitav/event-forwarding-microservice/transform"
+	"github.com/byuoitav/event-forwarding-microservice/wal"
 )
 
 // ElkTimeseriesForwarder NOT THREAD SAFE
@@ -18,16 +23,33 @@ type ElkTimeseriesForwarder struct {
 }
 
 // GetDefaultElkTimeSeries returns a default elk event forwarder after setting it up.
-func GetDefaultElkTimeSeries(URL string, index func() string, interval time.Duration) *ElkTimeseriesForwarder {
+// If log isn't nil, events are recorded in it until they're sent, and any left from a previous run are buffered first.
+func GetDefaultElkTimeSeries(URL string, index func() string, interval time.Duration, retry elk.RetryPolicy, deadLetter elk.DeadLetterSink, log *wal.Log, transforms transform.Chain, stats *metrics.Forwarder) *ElkTimeseriesForwarder {
 	toReturn := &ElkTimeseriesForwarder{
 		incomingChannel: make(chan events.Event, 1000),
 		ElkStaticForwarder: ElkStaticForwarder{
-			interval: interval,
-			url:      URL,
-			index:    index,
+			lifecycle:  newLifecycle(),
+			interval:   interval,
+			url:        URL,
+			index:      index,
+			retry:      retry,
+			deadLetter: deadLetter,
+			journal:    newJournal(log),
+			transform:  transforms,
+			stats:      stats,
 		},
 	}
 
+	toReturn.replay(func(item json.RawMessage) error {
+		var event events.Event
+		if err := json.Unmarshal(item, &event); err != nil {
+			return err
+		}
+
+		toReturn.bufferevent(event)
+		return nil
+	})
+
 	//start the manager
 	go toReturn.start()
 
@@ -47,8 +69,17 @@ func (e *ElkTimeseriesForwarder) Send(toSend interface{}) error {
 		return errors.New("Invalid type to send via an Elk Event Forwarder, must be an event from the events package.")
 	}
 
-	e.incomingChannel <- event
+	if e.closed() {
+		return ErrClosed
+	}
+
+	select {
+	case e.incomingChannel <- event:
+	case <-e.stopped:
+		return ErrClosed
+	}
 
+	e.record(event)
 	return nil
 }
 
@@ -63,22 +94,75 @@ func (e *ElkTimeseriesForwarder) start() {
 			//send it off
 			slog.Debug("Sending bulk ELK update", "index", e.index())
 
-			go elk.BulkForward(e.index(), e.url, "", "", e.buffer)
+			m := e.checkpoint(e.drain)
+			toSend, b := e.buffer, e.stats.Take()
+			e.goSend(func() { e.forward(context.Background(), toSend, m, b) })
 			e.buffer = []elk.ElkBulkUpdateItem{}
 
 		case event := <-e.incomingChannel:
 			e.bufferevent(event)
+		case req := <-e.closeChannel:
+			ticker.Stop()
+			e.drain()
+
+			slog.Info("Flushing forwarder before closing", "index", e.index(), "items", len(e.buffer))
+			m, b := e.checkpoint(e.drain), e.stats.Take()
+			failed := e.forward(req.ctx, e.buffer, m, b)
+			result := FlushResult{Flushed: len(e.buffer) - failed, Abandoned: failed}
+			e.buffer = []elk.ElkBulkUpdateItem{}
+
+			e.finish(req, result, nil)
+			return
 		}
 	}
 }
 
+// drain buffers anything left in the incoming channel
+func (e *ElkTimeseriesForwarder) drain() {
+	for {
+		select {
+		case event := <-e.incomingChannel:
+			e.bufferevent(event)
+		default:
+			return
+		}
+	}
+}
+
+// forward sends toSend, returning how many items couldn't be sent
+func (e *ElkTimeseriesForwarder) forward(ctx context.Context, toSend []elk.ElkBulkUpdateItem, m wal.Marker, b *metrics.Batch) int {
+	start := time.Now()
+	failed, err := elk.BulkForwardWithRetry(ctx, e.index(), e.url, "", "", toSend, e.retry, e.deadLetter)
+	if err != nil {
+		slog.Error("Couldn't send bulk ELK update", "index", e.index(), "error", err)
+	}
+
+	if len(toSend) > 0 {
+		e.stats.Observe(start)
+	}
+	b.Done(len(toSend)-failed, failed)
+
+	// anything that wasn't sent has been dead lettered, unless we ran out of time
+	if ctx.Err() == nil {
+		e.ack(m)
+	}
+
+	return failed
+}
+
 // NOT THREAD SAFE
 func (e *ElkTimeseriesForwarder) bufferevent(event events.Event) {
+	doc, ok := e.transformDoc(event)
+	if !ok {
+		return
+	}
+
 	e.buffer = append(e.buffer, elk.ElkBulkUpdateItem{
 		Index: elk.ElkUpdateHeader{
 			Header: elk.HeaderIndex{
 				Index: e.index(),
 			}},
-		Doc: event,
+		Doc: doc,
 	})
+	e.stats.Buffered()
 }
@@ -0,0 +1,122 @@
+package managers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/byuoitav/event-forwarding-microservice/elk"
+	"github.com/byuoitav/event-forwarding-microservice/events"
+	"github.com/byuoitav/event-forwarding-microservice/wal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bulkServer is a fake ELK bulk endpoint that accepts everything
+type bulkServer struct {
+	*httptest.Server
+
+	mu   sync.Mutex
+	keys []string
+}
+
+func newBulkServer() *bulkServer {
+	b := &bulkServer{}
+	b.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		resp := elk.BulkUpdateResponse{}
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			if len(scanner.Bytes()) == 0 {
+				continue
+			}
+
+			scanner.Scan()
+			var event events.Event
+			json.Unmarshal(scanner.Bytes(), &event)
+
+			b.keys = append(b.keys, event.Key)
+			resp.Items = append(resp.Items, map[string]elk.BulkItemResult{"index": {Status: http.StatusCreated}})
+		}
+
+		json.NewEncoder(w).Encode(resp)
+	}))
+
+	return b
+}
+
+func (b *bulkServer) received() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string{}, b.keys...)
+}
+
+func TestElkTimeseriesClose(t *testing.T) {
+	server := newBulkServer()
+	defer server.Close()
+
+	index := func() string { return "test" }
+	e := GetDefaultElkTimeSeries(server.URL, index, time.Hour, elk.RetryPolicy{}, elk.LogDeadLetterSink{}, nil, nil, nil)
+
+	for _, key := range []string{"a", "b", "c"} {
+		require.NoError(t, e.Send(events.Event{Key: key}))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := e.Close(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, FlushResult{Flushed: 3}, result)
+	assert.Equal(t, []string{"a", "b", "c"}, server.received())
+
+	assert.ErrorIs(t, e.Send(events.Event{Key: "d"}), ErrClosed)
+}
+
+func TestElkTimeseriesReplay(t *testing.T) {
+	server := newBulkServer()
+	defer server.Close()
+
+	dir := t.TempDir()
+
+	// events left behind by a previous run
+	log, err := wal.Open(dir, 0, wal.DropOldest)
+	require.NoError(t, err)
+	require.NoError(t, log.Append(events.Event{Key: "a"}))
+	require.NoError(t, log.Append(events.Event{Key: "b"}))
+	require.NoError(t, log.Close())
+
+	log, err = wal.Open(dir, 0, wal.DropOldest)
+	require.NoError(t, err)
+	defer log.Close()
+
+	index := func() string { return "test" }
+	e := GetDefaultElkTimeSeries(server.URL, index, time.Hour, elk.RetryPolicy{}, elk.LogDeadLetterSink{}, log, nil, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := e.Close(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, FlushResult{Flushed: 2}, result)
+	assert.Equal(t, []string{"a", "b"}, server.received())
+
+	// everything was sent, so nothing should be replayed next time
+	require.NoError(t, log.Close())
+	log, err = wal.Open(dir, 0, wal.DropOldest)
+	require.NoError(t, err)
+
+	replayed := 0
+	require.NoError(t, log.Replay(func(json.RawMessage) error {
+		replayed++
+		return nil
+	}))
+	assert.Zero(t, replayed)
+}
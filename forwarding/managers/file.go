@@ -0,0 +1,380 @@
+package managers
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/byuoitav/event-forwarding-microservice/events"
+	"github.com/byuoitav/event-forwarding-microservice/metrics"
+	sd "github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
+	"github.com/byuoitav/event-forwarding-microservice/transform"
+)
+
+const (
+	segmentExt    = ".jsonl"
+	compressedExt = ".jsonl.gz"
+)
+
+// File is where a file forwarder writes what it's given
+type File struct {
+	Directory string
+
+	// the segment names are Pattern, or Pattern-<date>
+	Pattern string
+
+	// returns the name of the segment to write to now, without an extension
+	Name func() string
+
+	// gzip segments once they're closed
+	Compress bool
+
+	// how many segments to keep, including the one being written to. 0 keeps all of them
+	Retention int
+}
+
+// FileForwarder writes events, devices, or rooms to rotating newline delimited json files
+type FileForwarder struct {
+	lifecycle
+
+	incomingChannel chan map[string]interface{}
+	buffer          []map[string]interface{}
+
+	file      File
+	interval  time.Duration //how often to write
+	transform transform.Chain
+	stats     *metrics.Forwarder
+
+	// the segment being written to
+	current string
+	out     *os.File
+
+	// only one cleanup at a time
+	cleaning sync.Mutex
+}
+
+// GetDefaultFileForwarder returns a file forwarder after starting it
+func GetDefaultFileForwarder(file File, interval time.Duration, transforms transform.Chain, stats *metrics.Forwarder) *FileForwarder {
+	toReturn := &FileForwarder{
+		lifecycle:       newLifecycle(),
+		incomingChannel: make(chan map[string]interface{}, 10000),
+		file:            file,
+		interval:        interval,
+		transform:       transforms,
+		stats:           stats,
+	}
+
+	go toReturn.start()
+
+	return toReturn
+}
+
+// Send takes an event, device, or room and adds it to the buffer
+func (f *FileForwarder) Send(toSend interface{}) error {
+	switch toSend.(type) {
+	case *events.Event, events.Event:
+	case *sd.StaticDevice, sd.StaticDevice:
+	case *sd.StaticRoom, sd.StaticRoom:
+	default:
+		return errors.New("Invalid type to send via a File Forwarder, must be an event or a static device/room as defined in state/statedefinition")
+	}
+
+	doc, err := f.transform.Apply(toSend)
+	if err != nil {
+		return fmt.Errorf("couldn't send via file forwarder: %w", err)
+	}
+
+	if f.closed() {
+		return ErrClosed
+	}
+
+	select {
+	case f.incomingChannel <- doc:
+	case <-f.stopped:
+		return ErrClosed
+	}
+
+	return nil
+}
+
+func (f *FileForwarder) start() {
+	slog.Info("Starting file forwarder", "directory", f.file.Directory, "pattern", f.file.Pattern)
+	ticker := time.NewTicker(f.interval)
+
+	if err := os.MkdirAll(f.file.Directory, 0755); err != nil {
+		slog.Error("Couldn't create file forwarder directory", "directory", f.file.Directory, "error", err)
+	}
+
+	// anything left uncompressed from a previous run
+	name := f.file.Name()
+	f.goSend(func() {
+		f.cleanup(name)
+	})
+
+	for {
+		select {
+		case <-ticker.C:
+			f.flush()
+
+		case doc := <-f.incomingChannel:
+			f.buffer = append(f.buffer, doc)
+			f.stats.Buffered()
+		case req := <-f.closeChannel:
+			ticker.Stop()
+			f.drain()
+
+			slog.Info("Flushing file forwarder before closing", "directory", f.file.Directory, "pattern", f.file.Pattern, "items", len(f.buffer))
+			var result FlushResult
+			err := f.write(f.buffer, f.stats.Take())
+			if err == nil {
+				result.Flushed = len(f.buffer)
+			} else {
+				result.Abandoned = len(f.buffer)
+			}
+			f.buffer = []map[string]interface{}{}
+
+			if f.out != nil {
+				err = errors.Join(err, f.out.Close())
+			}
+
+			f.finish(req, result, err)
+			return
+		}
+	}
+}
+
+// drain buffers anything left in the incoming channel
+func (f *FileForwarder) drain() {
+	for {
+		select {
+		case doc := <-f.incomingChannel:
+			f.buffer = append(f.buffer, doc)
+			f.stats.Buffered()
+		default:
+			return
+		}
+	}
+}
+
+func (f *FileForwarder) flush() {
+	if len(f.buffer) == 0 {
+		return
+	}
+
+	if err := f.write(f.buffer, f.stats.Take()); err != nil {
+		slog.Error("Couldn't write to file", "directory", f.file.Directory, "segment", f.current, "error", err)
+	}
+
+	f.buffer = []map[string]interface{}{}
+}
+
+// write appends toSend to the current segment, rotating to a new one first if it's time to
+func (f *FileForwarder) write(toSend []map[string]interface{}, b *metrics.Batch) error {
+	if len(toSend) == 0 {
+		return nil
+	}
+
+	start := time.Now()
+	defer f.stats.Observe(start)
+
+	if err := f.rotate(); err != nil {
+		b.Done(0, len(toSend))
+		return err
+	}
+
+	w := bufio.NewWriter(f.out)
+	enc := json.NewEncoder(w)
+	for i := range toSend {
+		if err := enc.Encode(toSend[i]); err != nil {
+			b.Done(0, len(toSend))
+			return fmt.Errorf("couldn't encode item: %w", err)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		b.Done(0, len(toSend))
+		return fmt.Errorf("couldn't write to %v: %w", f.out.Name(), err)
+	}
+
+	b.Done(len(toSend), 0)
+	return nil
+}
+
+// rotate makes sure the segment that should be written to now is open, closing the last one
+func (f *FileForwarder) rotate() error {
+	name := f.file.Name()
+	if f.out != nil && name == f.current {
+		return nil
+	}
+
+	rotated := f.out != nil
+	if rotated {
+		slog.Info("Rotating file", "from", f.current, "to", name)
+		if err := f.out.Close(); err != nil {
+			slog.Warn("Couldn't close segment", "segment", f.current, "error", err)
+		}
+		f.out = nil
+	}
+
+	out, err := os.OpenFile(filepath.Join(f.file.Directory, name+segmentExt), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("couldn't open segment: %w", err)
+	}
+	f.current, f.out = name, out
+
+	// the last segment is closed now
+	if rotated {
+		f.goSend(func() {
+			f.cleanup(name)
+		})
+	}
+
+	return nil
+}
+
+// cleanup compresses any segment besides current that isn't already, then deletes the oldest segments past the retention count
+func (f *FileForwarder) cleanup(current string) {
+	f.cleaning.Lock()
+	defer f.cleaning.Unlock()
+
+	segments, err := f.segments()
+	if err != nil {
+		slog.Error("Couldn't list segments", "directory", f.file.Directory, "error", err)
+		return
+	}
+
+	if f.file.Compress {
+		for i, path := range segments {
+			if !strings.HasSuffix(path, segmentExt) || filepath.Base(path) == current+segmentExt {
+				continue
+			}
+
+			compressed, err := compress(path)
+			if err != nil {
+				slog.Error("Couldn't compress segment", "segment", path, "error", err)
+				continue
+			}
+			segments[i] = compressed
+		}
+	}
+
+	if f.file.Retention <= 0 || len(segments) <= f.file.Retention {
+		return
+	}
+
+	// newest first
+	modTimes := make(map[string]time.Time, len(segments))
+	for _, path := range segments {
+		if info, err := os.Stat(path); err == nil {
+			modTimes[path] = info.ModTime()
+		}
+	}
+	sort.SliceStable(segments, func(i, j int) bool {
+		return modTimes[segments[i]].After(modTimes[segments[j]])
+	})
+
+	for _, path := range segments[f.file.Retention:] {
+		if filepath.Base(path) == current+segmentExt {
+			continue
+		}
+
+		slog.Info("Removing old segment", "segment", path)
+		if err := os.Remove(path); err != nil {
+			slog.Warn("Couldn't remove segment", "segment", path, "error", err)
+		}
+	}
+}
+
+// segments returns the paths of every segment this forwarder has written
+func (f *FileForwarder) segments() ([]string, error) {
+	entries, err := os.ReadDir(f.file.Directory)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		if entry.IsDir() || !isSegment(f.file.Pattern, entry.Name()) {
+			continue
+		}
+		paths = append(paths, filepath.Join(f.file.Directory, entry.Name()))
+	}
+
+	return paths, nil
+}
+
+// isSegment is whether name is a segment file for pattern, i.e. pattern.jsonl or pattern-<date>.jsonl, optionally gzipped
+func isSegment(pattern, name string) bool {
+	switch {
+	case strings.HasSuffix(name, compressedExt):
+		name = strings.TrimSuffix(name, compressedExt)
+	case strings.HasSuffix(name, segmentExt):
+		name = strings.TrimSuffix(name, segmentExt)
+	default:
+		return false
+	}
+
+	if name == pattern {
+		return true
+	}
+
+	date, ok := strings.CutPrefix(name, pattern+"-")
+	if !ok || len(date) == 0 {
+		return false
+	}
+
+	for _, c := range date {
+		if !unicode.IsDigit(c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// compress gzips the segment at path, removing the original once it's done, and returns the path of the compressed segment.
+// The compressed segment keeps the original's modification time so retention still removes the oldest segments first.
+func compress(path string) (string, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	toReturn := strings.TrimSuffix(path, segmentExt) + compressedExt
+	out, err := os.OpenFile(toReturn, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", err
+	}
+
+	gz := gzip.NewWriter(out)
+	_, err = io.Copy(gz, in)
+	err = errors.Join(err, gz.Close(), out.Close())
+	if err != nil {
+		os.Remove(toReturn)
+		return "", err
+	}
+
+	if err := os.Chtimes(toReturn, info.ModTime(), info.ModTime()); err != nil {
+		slog.Debug("Couldn't keep segment's modification time", "segment", toReturn, "error", err)
+	}
+
+	in.Close()
+	return toReturn, os.Remove(path)
+}
@@ -0,0 +1,188 @@
+package managers
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/byuoitav/event-forwarding-microservice/events"
+	sd "github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
+	"github.com/byuoitav/event-forwarding-microservice/structs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// segmentName is a File.Name that tests can rotate
+type segmentName struct {
+	mu   sync.Mutex
+	name string
+}
+
+func (s *segmentName) get() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.name
+}
+
+func (s *segmentName) set(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.name = name
+}
+
+// readSegment returns the lines in the segment at path, gunzipping it if it's compressed
+func readSegment(t *testing.T, path string) []map[string]interface{} {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var r io.Reader = f
+	if filepath.Ext(path) == ".gz" {
+		gz, err := gzip.NewReader(f)
+		require.NoError(t, err)
+		defer gz.Close()
+		r = gz
+	}
+
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		lines = append(lines, line)
+	}
+	require.NoError(t, scanner.Err())
+
+	return lines
+}
+
+func listSegments(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func TestFileForwarder(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "archive")
+	name := &segmentName{name: "av-events-20240501"}
+
+	f := GetDefaultFileForwarder(File{
+		Directory: dir,
+		Pattern:   "av-events",
+		Name:      name.get,
+	}, 20*time.Millisecond, nil, nil)
+
+	require.NoError(t, f.Send(events.Event{Key: "power", Value: "on"}))
+	require.NoError(t, f.Send(&events.Event{Key: "input", Value: "hdmi1"}))
+	assert.Error(t, f.Send(structs.RoomIssue{}))
+
+	path := filepath.Join(dir, "av-events-20240501.jsonl")
+	assert.Eventually(t, func() bool {
+		b, err := os.ReadFile(path)
+		return err == nil && len(b) > 0
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, f.Send(sd.StaticDevice{DeviceID: "ITB-1101-D1"}))
+
+	result, err := closeForwarder(t, f)
+	require.NoError(t, err)
+	assert.Equal(t, FlushResult{Flushed: 1}, result)
+
+	lines := readSegment(t, path)
+	require.Len(t, lines, 3)
+	assert.Equal(t, "power", lines[0]["key"])
+	assert.Equal(t, "hdmi1", lines[1]["value"])
+	assert.Equal(t, "ITB-1101-D1", lines[2]["deviceID"])
+
+	assert.ErrorIs(t, f.Send(events.Event{Key: "power"}), ErrClosed)
+}
+
+func TestFileForwarderRotation(t *testing.T) {
+	dir := t.TempDir()
+	name := &segmentName{name: "av-events-20240501"}
+
+	// left by someone else
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "av-events-archive.jsonl"), []byte("{}\n"), 0644))
+
+	f := GetDefaultFileForwarder(File{
+		Directory: dir,
+		Pattern:   "av-events",
+		Name:      name.get,
+		Compress:  true,
+		Retention: 2,
+	}, 20*time.Millisecond, nil, nil)
+
+	// a day at a time
+	for i, day := range []string{"20240501", "20240502", "20240503"} {
+		name.set("av-events-" + day)
+		require.NoError(t, f.Send(events.Event{Key: "day", Value: day}))
+
+		path := filepath.Join(dir, "av-events-"+day+".jsonl")
+		require.Eventually(t, func() bool {
+			b, err := os.ReadFile(path)
+			return err == nil && len(b) > 0
+		}, time.Second, 10*time.Millisecond)
+
+		// keep the segments' modification times in order
+		modTime := time.Now().Add(time.Duration(i-10) * time.Minute)
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+
+	result, err := closeForwarder(t, f)
+	require.NoError(t, err)
+	assert.Equal(t, FlushResult{}, result)
+
+	// the first day is past the retention count, the second was compressed when it was rotated
+	assert.Equal(t, []string{"av-events-20240502.jsonl.gz", "av-events-20240503.jsonl", "av-events-archive.jsonl"}, listSegments(t, dir))
+
+	lines := readSegment(t, filepath.Join(dir, "av-events-20240502.jsonl.gz"))
+	require.Len(t, lines, 1)
+	assert.Equal(t, "20240502", lines[0]["value"])
+}
+
+func TestFileForwarderLeftovers(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "av-devices-2023.jsonl"), []byte(`{"deviceID": "ITB-1101-D1"}`+"\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "av-devices-2024.jsonl"), []byte(`{"deviceID": "ITB-1101-D2"}`+"\n"), 0644))
+
+	// segments left from a previous run are compressed, except the one that's still being written to
+	f := GetDefaultFileForwarder(File{
+		Directory: dir,
+		Pattern:   "av-devices",
+		Name:      func() string { return "av-devices-2024" },
+		Compress:  true,
+	}, time.Hour, nil, nil)
+
+	require.NoError(t, f.Send(sd.StaticDevice{DeviceID: "ITB-1101-D3"}))
+
+	result, err := closeForwarder(t, f)
+	require.NoError(t, err)
+	assert.Equal(t, FlushResult{Flushed: 1}, result)
+
+	assert.Equal(t, []string{"av-devices-2023.jsonl.gz", "av-devices-2024.jsonl"}, listSegments(t, dir))
+	assert.Equal(t, "ITB-1101-D1", readSegment(t, filepath.Join(dir, "av-devices-2023.jsonl.gz"))[0]["deviceID"])
+	assert.Len(t, readSegment(t, filepath.Join(dir, "av-devices-2024.jsonl")), 2)
+}
+
+func TestIsSegment(t *testing.T) {
+	assert.True(t, isSegment("av-events", "av-events.jsonl"))
+	assert.True(t, isSegment("av-events", "av-events-202419.jsonl"))
+	assert.True(t, isSegment("av-events", "av-events-20240501.jsonl.gz"))
+	assert.False(t, isSegment("av-events", "av-events-archive.jsonl"))
+	assert.False(t, isSegment("av-events", "av-events-20240501.json"))
+	assert.False(t, isSegment("av", "av-events-20240501.jsonl"))
+}
@@ -0,0 +1,200 @@
+package managers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/byuoitav/event-forwarding-microservice/events"
+	"github.com/byuoitav/event-forwarding-microservice/humio"
+	"github.com/byuoitav/event-forwarding-microservice/metrics"
+	sd "github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
+	"github.com/byuoitav/event-forwarding-microservice/structs"
+	"github.com/byuoitav/event-forwarding-microservice/transform"
+	"github.com/byuoitav/event-forwarding-microservice/wal"
+)
+
+// HumioForwarder batches events, devices, and rooms and sends them to humio's structured ingest endpoint
+type HumioForwarder struct {
+	lifecycle
+	journal
+
+	incomingChannel chan humio.StructuredEvent
+	buffer          []humio.StructuredEvent
+
+	interval    time.Duration //how often to send an update
+	bufferSize  int           //send early if the buffer reaches this size
+	ingestToken string
+	tags        map[string]string
+	transform   transform.Chain
+	stats       *metrics.Forwarder
+}
+
+// GetDefaultHumioForwarder returns a humio forwarder after starting it
+func GetDefaultHumioForwarder(dataType string, interval time.Duration, bufferSize int, ingestToken string, log *wal.Log, transforms transform.Chain, stats *metrics.Forwarder) *HumioForwarder {
+	toReturn := &HumioForwarder{
+		lifecycle:       newLifecycle(),
+		journal:         newJournal(log),
+		incomingChannel: make(chan humio.StructuredEvent, 10000),
+		interval:        interval,
+		bufferSize:      bufferSize,
+		ingestToken:     ingestToken,
+		transform:       transforms,
+		stats:           stats,
+		tags: map[string]string{
+			"data-type": dataType,
+		},
+	}
+
+	toReturn.replay(func(item json.RawMessage) error {
+		var event humio.StructuredEvent
+		if err := json.Unmarshal(item, &event); err != nil {
+			return err
+		}
+
+		toReturn.buffer = append(toReturn.buffer, event)
+		toReturn.stats.Buffered()
+		return nil
+	})
+
+	go toReturn.start()
+
+	return toReturn
+}
+
+// Send takes an event, device, or room and adds it to the buffer
+func (h *HumioForwarder) Send(toSend interface{}) error {
+	var timestamp time.Time
+
+	switch v := toSend.(type) {
+	case *events.Event:
+		timestamp = v.Timestamp
+	case events.Event:
+		timestamp = v.Timestamp
+	case *sd.StaticDevice:
+		timestamp = v.LastStateReceived
+	case sd.StaticDevice:
+		timestamp = v.LastStateReceived
+	case *sd.StaticRoom, sd.StaticRoom:
+	case *structs.RoomIssue, structs.RoomIssue:
+	default:
+		return errors.New("Invalid type to send via a Humio Forwarder, must be an event, a static device/room as defined in state/statedefinition, or a room issue")
+	}
+
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	attributes, err := h.transform.Apply(toSend)
+	if err != nil {
+		return fmt.Errorf("couldn't send via humio forwarder: %w", err)
+	}
+
+	if h.closed() {
+		return ErrClosed
+	}
+
+	event := humio.StructuredEvent{
+		Timestamp:  timestamp.Format(time.RFC3339Nano),
+		Attributes: attributes,
+	}
+
+	select {
+	case h.incomingChannel <- event:
+	case <-h.stopped:
+		return ErrClosed
+	}
+
+	h.record(event)
+	return nil
+}
+
+func (h *HumioForwarder) start() {
+	slog.Info("Starting humio forwarder", "tags", h.tags)
+	ticker := time.NewTicker(h.interval)
+
+	for {
+		select {
+		case <-ticker.C:
+			//send it off
+			slog.Debug("Sending bulk humio update", "tags", h.tags)
+			h.flush()
+
+		case event := <-h.incomingChannel:
+			h.buffer = append(h.buffer, event)
+			h.stats.Buffered()
+			if h.bufferSize > 0 && len(h.buffer) >= h.bufferSize {
+				slog.Debug("Humio buffer full, sending early", "tags", h.tags, "size", len(h.buffer))
+				h.flush()
+			}
+		case req := <-h.closeChannel:
+			ticker.Stop()
+			h.drain()
+
+			slog.Info("Flushing humio forwarder before closing", "tags", h.tags, "items", len(h.buffer))
+			var result FlushResult
+			var err error
+			if len(h.buffer) > 0 {
+				m, b := h.checkpoint(h.drain), h.stats.Take()
+				err = h.forward(req.ctx, h.buffer, m, b)
+				if err == nil {
+					result.Flushed = len(h.buffer)
+				} else {
+					result.Abandoned = len(h.buffer)
+				}
+			}
+			h.buffer = []humio.StructuredEvent{}
+
+			h.finish(req, result, err)
+			return
+		}
+	}
+}
+
+// drain buffers anything left in the incoming channel
+func (h *HumioForwarder) drain() {
+	for {
+		select {
+		case event := <-h.incomingChannel:
+			h.buffer = append(h.buffer, event)
+			h.stats.Buffered()
+		default:
+			return
+		}
+	}
+}
+
+func (h *HumioForwarder) flush() {
+	if len(h.buffer) == 0 {
+		return
+	}
+
+	m := h.checkpoint(h.drain)
+	toSend, b := h.buffer, h.stats.Take()
+	h.goSend(func() {
+		if err := h.forward(context.Background(), toSend, m, b); err != nil {
+			slog.Error("Couldn't send humio update", "error", err)
+		}
+	})
+
+	h.buffer = []humio.StructuredEvent{}
+}
+
+// forward sends toSend, acking the write ahead log if it made it to humio. It gives up when ctx is done.
+func (h *HumioForwarder) forward(ctx context.Context, toSend []humio.StructuredEvent, m wal.Marker, b *metrics.Batch) error {
+	start := time.Now()
+	err := humio.BulkForward(ctx, h.tags["data-type"], h.ingestToken, h.tags, toSend)
+	h.stats.Observe(start)
+
+	if err != nil {
+		b.Done(0, len(toSend))
+		return err
+	}
+
+	h.ack(m)
+	b.Done(len(toSend), 0)
+	return nil
+}
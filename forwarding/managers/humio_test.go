@@ -0,0 +1,200 @@
+package managers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/byuoitav/event-forwarding-microservice/events"
+	"github.com/byuoitav/event-forwarding-microservice/humio"
+	sd "github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
+	"github.com/byuoitav/event-forwarding-microservice/wal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// humioServer points humio requests at a hook server for the length of the test
+func humioServer(t *testing.T, status int) *hookServer {
+	server := newHookServer(status)
+	t.Cleanup(server.Close)
+
+	addr := humio.APIAddr
+	humio.APIAddr = server.URL
+	t.Cleanup(func() { humio.APIAddr = addr })
+
+	return server
+}
+
+// humioEvents decodes the events in a structured ingest request body
+func humioEvents(t *testing.T, body string) []humio.StructuredEvent {
+	var req []humio.StructuredRequest
+	require.NoError(t, json.Unmarshal([]byte(body), &req))
+	require.Len(t, req, 1)
+	assert.Equal(t, map[string]string{"data-type": "event"}, req[0].Tags)
+
+	return req[0].Events
+}
+
+func TestHumioForwarder(t *testing.T) {
+	server := humioServer(t, http.StatusOK)
+
+	h := GetDefaultHumioForwarder("event", 50*time.Millisecond, 0, "token", nil, nil, nil)
+
+	timestamp := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	require.NoError(t, h.Send(events.Event{Key: "power", Value: "on", Timestamp: timestamp}))
+	require.NoError(t, h.Send(&events.Event{Key: "input", Value: "hdmi1", Timestamp: timestamp}))
+	assert.Error(t, h.Send("not an event"))
+
+	// sent on the interval
+	assert.Eventually(t, func() bool {
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		return len(server.bodies) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	result, err := closeForwarder(t, h)
+	require.NoError(t, err)
+	assert.Equal(t, FlushResult{}, result)
+
+	assert.Equal(t, humio.StructuredIngestEndpoint, server.requests[0].URL.Path)
+	assert.Equal(t, "Bearer token", server.requests[0].Header.Get("Authorization"))
+
+	sent := humioEvents(t, server.bodies[0])
+	require.Len(t, sent, 2)
+	assert.Equal(t, "2024-05-01T12:30:00Z", sent[0].Timestamp)
+	assert.Equal(t, "power", sent[0].Attributes["key"])
+	assert.Equal(t, "hdmi1", sent[1].Attributes["value"])
+
+	assert.ErrorIs(t, h.Send(events.Event{Key: "power"}), ErrClosed)
+}
+
+func TestHumioForwarderBufferSize(t *testing.T) {
+	server := humioServer(t, http.StatusOK)
+
+	h := GetDefaultHumioForwarder("event", time.Hour, 2, "token", nil, nil, nil)
+
+	// a full buffer is sent early
+	require.NoError(t, h.Send(sd.StaticDevice{DeviceID: "ITB-1101-D1"}))
+	require.NoError(t, h.Send(sd.StaticDevice{DeviceID: "ITB-1101-D2"}))
+	assert.Eventually(t, func() bool {
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		return len(server.bodies) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, h.Send(sd.StaticDevice{DeviceID: "ITB-1101-D3"}))
+	result, err := closeForwarder(t, h)
+	require.NoError(t, err)
+	assert.Equal(t, FlushResult{Flushed: 1}, result)
+
+	require.Len(t, server.bodies, 2)
+	first := humioEvents(t, server.bodies[0])
+	require.Len(t, first, 2)
+	assert.Equal(t, "ITB-1101-D1", first[0].Attributes["deviceID"])
+
+	// devices without a state use the time they were sent
+	ts, err := time.Parse(time.RFC3339Nano, first[0].Timestamp)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), ts, time.Minute)
+}
+
+func TestHumioForwarderFailure(t *testing.T) {
+	humioServer(t, http.StatusUnauthorized)
+
+	h := GetDefaultHumioForwarder("event", time.Hour, 0, "bad", nil, nil, nil)
+	require.NoError(t, h.Send(events.Event{Key: "power"}))
+
+	result, err := closeForwarder(t, h)
+	assert.Error(t, err)
+	assert.Equal(t, FlushResult{Abandoned: 1}, result)
+}
+
+func TestHumioForwarderReplay(t *testing.T) {
+	server := humioServer(t, http.StatusOK)
+	dir := t.TempDir()
+
+	// events left behind by a previous run
+	log, err := wal.Open(dir, 0, wal.DropOldest)
+	require.NoError(t, err)
+	require.NoError(t, log.Append(humio.StructuredEvent{Timestamp: "2024-05-01T12:00:00Z", Attributes: map[string]interface{}{"key": "a"}}))
+	require.NoError(t, log.Close())
+
+	log, err = wal.Open(dir, 0, wal.DropOldest)
+	require.NoError(t, err)
+	defer log.Close()
+
+	h := GetDefaultHumioForwarder("event", time.Hour, 0, "token", log, nil, nil)
+
+	result, err := closeForwarder(t, h)
+	require.NoError(t, err)
+	assert.Equal(t, FlushResult{Flushed: 1}, result)
+
+	require.Len(t, server.bodies, 1)
+	sent := humioEvents(t, server.bodies[0])
+	require.Len(t, sent, 1)
+	assert.Equal(t, "a", sent[0].Attributes["key"])
+}
+
+func TestHumioForwarderRecordsOnSend(t *testing.T) {
+	humioServer(t, http.StatusOK)
+	dir := t.TempDir()
+
+	log, err := wal.Open(dir, 0, wal.DropOldest)
+	require.NoError(t, err)
+	defer log.Close()
+
+	h := GetDefaultHumioForwarder("event", time.Hour, 0, "token", log, nil, nil)
+	require.NoError(t, h.Send(events.Event{Key: "power"}))
+	require.NoError(t, h.Send(events.Event{Key: "input"}))
+
+	// they're in the log as soon as Send returns, even if they haven't been buffered yet
+	var recorded []interface{}
+	for _, name := range listSegments(t, dir) {
+		for _, line := range readSegment(t, filepath.Join(dir, name)) {
+			recorded = append(recorded, line["attributes"].(map[string]interface{})["key"])
+		}
+	}
+	assert.Equal(t, []interface{}{"power", "input"}, recorded)
+
+	result, err := closeForwarder(t, h)
+	require.NoError(t, err)
+	assert.Equal(t, FlushResult{Flushed: 2}, result)
+
+	for _, name := range listSegments(t, dir) {
+		assert.Empty(t, readSegment(t, filepath.Join(dir, name)), "sent events are acked")
+	}
+}
+
+func TestHumioCloseTimeout(t *testing.T) {
+	// humio stops responding
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+
+	addr := humio.APIAddr
+	humio.APIAddr = server.URL
+	t.Cleanup(func() { humio.APIAddr = addr })
+
+	h := GetDefaultHumioForwarder("event", time.Hour, 0, "token", nil, nil, nil)
+	require.NoError(t, h.Send(events.Event{Key: "power", Value: "on"}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := h.Close(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// the flush gives up when the close does, rather than waiting out the request timeout
+	select {
+	case <-h.stopped:
+	case <-time.After(time.Second):
+		t.Fatal("forwarder was still flushing after its close deadline")
+	}
+}
@@ -0,0 +1,85 @@
+package managers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+
+	"github.com/byuoitav/event-forwarding-microservice/wal"
+)
+
+// journal records what a forwarder has buffered in a write ahead log, so it can be replayed if the service dies before it's sent.
+// A journal without a log does nothing.
+//
+// Items are recorded by Send once they've been handed to the run loop, so nothing waiting in a forwarder's
+// incoming channel is lost. A checkpoint drains the channel first, so everything recorded before it is in the buffer being sent.
+type journal struct {
+	log *wal.Log
+
+	// held while recording, and exclusively while checkpointing
+	mu *sync.RWMutex
+}
+
+func newJournal(log *wal.Log) journal {
+	return journal{log: log, mu: &sync.RWMutex{}}
+}
+
+// record writes an item to the log, call it after the item has been handed to the run loop
+func (j journal) record(item interface{}) {
+	if j.log == nil {
+		return
+	}
+
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	err := j.log.Append(item)
+	switch {
+	case errors.Is(err, wal.ErrFull):
+		slog.Warn("Write ahead log is full, item is only buffered in memory", "dir", j.log.Dir())
+	case err != nil:
+		slog.Error("Couldn't write to write ahead log", "dir", j.log.Dir(), "error", err)
+	}
+}
+
+// checkpoint buffers what's waiting in the incoming channels with drain, then marks everything recorded so far.
+// Call it from the run loop before the buffer is handed off to be sent.
+func (j journal) checkpoint(drain func()) wal.Marker {
+	if j.log == nil {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	drain()
+	m, err := j.log.Checkpoint()
+	if err != nil {
+		slog.Error("Couldn't checkpoint write ahead log", "dir", j.log.Dir(), "error", err)
+	}
+
+	return m
+}
+
+// ack removes a checkpoint from the log once what was buffered before it has been sent
+func (j journal) ack(m wal.Marker) {
+	if j.log == nil || len(m) == 0 {
+		return
+	}
+
+	if err := j.log.Ack(m); err != nil {
+		slog.Error("Couldn't ack write ahead log", "dir", j.log.Dir(), "error", err)
+	}
+}
+
+// replay calls fn with each item left in the log from a previous run
+func (j journal) replay(fn func(item json.RawMessage) error) {
+	if j.log == nil {
+		return
+	}
+
+	if err := j.log.Replay(fn); err != nil {
+		slog.Error("Couldn't replay write ahead log", "dir", j.log.Dir(), "error", err)
+	}
+}
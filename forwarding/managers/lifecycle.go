@@ -0,0 +1,106 @@
+package managers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrClosed is returned when sending to a forwarder that has been closed
+var ErrClosed = errors.New("forwarder is closed")
+
+// FlushResult is what happened to the items a forwarder had buffered when it was closed
+type FlushResult struct {
+	Flushed   int `json:"flushed"`
+	Abandoned int `json:"abandoned"`
+}
+
+// closeRequest asks a forwarder's run loop to flush what it has buffered and exit
+type closeRequest struct {
+	ctx  context.Context
+	done chan closeResponse
+}
+
+type closeResponse struct {
+	result FlushResult
+	err    error
+}
+
+// lifecycle is embedded in each forwarder to let its run loop be stopped
+type lifecycle struct {
+	closeChannel chan closeRequest
+	stopped      chan struct{}
+
+	// sends that were started in the background and haven't finished
+	inflight *sync.WaitGroup
+}
+
+func newLifecycle() lifecycle {
+	return lifecycle{
+		closeChannel: make(chan closeRequest),
+		stopped:      make(chan struct{}),
+		inflight:     &sync.WaitGroup{},
+	}
+}
+
+// Close flushes anything buffered and stops the forwarder, waiting for any sends already in progress.
+// It returns early if ctx is done before the flush finishes.
+func (l *lifecycle) Close(ctx context.Context) (FlushResult, error) {
+	req := closeRequest{
+		ctx:  ctx,
+		done: make(chan closeResponse, 1),
+	}
+
+	select {
+	case l.closeChannel <- req:
+	case <-l.stopped:
+		return FlushResult{}, nil
+	case <-ctx.Done():
+		return FlushResult{}, ctx.Err()
+	}
+
+	select {
+	case resp := <-req.done:
+		return resp.result, resp.err
+	case <-ctx.Done():
+		return FlushResult{}, ctx.Err()
+	}
+}
+
+// closed returns true once the run loop has exited
+func (l *lifecycle) closed() bool {
+	select {
+	case <-l.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+// goSend runs send in the background, Close waits for it to finish
+func (l *lifecycle) goSend(send func()) {
+	l.inflight.Add(1)
+	go func() {
+		defer l.inflight.Done()
+		send()
+	}()
+}
+
+// finish waits for any sends in progress, marks the run loop as exited, and responds to the close request
+func (l *lifecycle) finish(req closeRequest, result FlushResult, err error) {
+	done := make(chan struct{})
+	go func() {
+		l.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-req.ctx.Done():
+		err = errors.Join(err, fmt.Errorf("gave up waiting for sends in progress: %w", req.ctx.Err()))
+	}
+
+	close(l.stopped)
+	req.done <- closeResponse{result: result, err: err}
+}
@@ -0,0 +1,297 @@
+package managers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/byuoitav/event-forwarding-microservice/events"
+	"github.com/byuoitav/event-forwarding-microservice/loki"
+	"github.com/byuoitav/event-forwarding-microservice/metrics"
+	"github.com/byuoitav/event-forwarding-microservice/transform"
+	"github.com/byuoitav/event-forwarding-microservice/wal"
+)
+
+// Loki is where a loki forwarder pushes what it's given
+type Loki struct {
+	URL  string
+	Auth loki.Auth
+
+	// added to every stream, defaults to job=event-forwarder since loki won't take a stream without labels
+	Labels map[string]string
+
+	// looks up the type of a device from its ID, for the device_type label. Can be nil
+	DeviceType func(string) string
+}
+
+// lokiEntry is a line waiting to be pushed, with the labels of the stream it goes in
+type lokiEntry struct {
+	Labels    map[string]string `json:"labels"`
+	Timestamp string            `json:"timestamp"`
+	Line      string            `json:"line"`
+}
+
+// LokiForwarder batches events into streams labeled by building, device type, and tags, and pushes them to loki
+type LokiForwarder struct {
+	lifecycle
+	journal
+
+	incomingChannel chan lokiEntry
+	buffer          []lokiEntry
+
+	loki       Loki
+	interval   time.Duration //how often to send an update
+	bufferSize int           //send early if the buffer reaches this size
+	transform  transform.Chain
+	stats      *metrics.Forwarder
+}
+
+// GetDefaultLokiForwarder returns a loki forwarder after starting it
+func GetDefaultLokiForwarder(l Loki, interval time.Duration, bufferSize int, log *wal.Log, transforms transform.Chain, stats *metrics.Forwarder) *LokiForwarder {
+	if len(l.Labels) == 0 {
+		l.Labels = map[string]string{"job": "event-forwarder"}
+	}
+
+	toReturn := &LokiForwarder{
+		lifecycle:       newLifecycle(),
+		journal:         newJournal(log),
+		incomingChannel: make(chan lokiEntry, 10000),
+		loki:            l,
+		interval:        interval,
+		bufferSize:      bufferSize,
+		transform:       transforms,
+		stats:           stats,
+	}
+
+	toReturn.replay(func(item json.RawMessage) error {
+		var entry lokiEntry
+		if err := json.Unmarshal(item, &entry); err != nil {
+			return err
+		}
+
+		toReturn.buffer = append(toReturn.buffer, entry)
+		toReturn.stats.Buffered()
+		return nil
+	})
+
+	go toReturn.start()
+
+	return toReturn
+}
+
+// Send takes an event and adds it to the buffer
+func (l *LokiForwarder) Send(toSend interface{}) error {
+	var event events.Event
+
+	switch v := toSend.(type) {
+	case *events.Event:
+		event = *v
+	case events.Event:
+		event = v
+	default:
+		return errors.New("Invalid type to send via a Loki Forwarder, must be an event")
+	}
+
+	timestamp := event.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	doc, err := l.transform.Apply(toSend)
+	if err != nil {
+		return fmt.Errorf("couldn't send via loki forwarder: %w", err)
+	}
+
+	line, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("couldn't send via loki forwarder: %w", err)
+	}
+
+	if l.closed() {
+		return ErrClosed
+	}
+
+	entry := lokiEntry{
+		Labels:    l.labels(event),
+		Timestamp: strconv.FormatInt(timestamp.UnixNano(), 10),
+		Line:      string(line),
+	}
+
+	select {
+	case l.incomingChannel <- entry:
+	case <-l.stopped:
+		return ErrClosed
+	}
+
+	l.record(entry)
+	return nil
+}
+
+// labels returns the labels of the stream event goes in. They're kept to low cardinality fields so loki doesn't end up with too many streams
+func (l *LokiForwarder) labels(event events.Event) map[string]string {
+	labels := make(map[string]string, len(l.loki.Labels)+3)
+	for k, v := range l.loki.Labels {
+		labels[k] = v
+	}
+
+	building := event.TargetDevice.BuildingID
+	if len(building) == 0 {
+		building = event.AffectedRoom.BuildingID
+	}
+	if len(building) > 0 {
+		labels["building"] = building
+	}
+
+	if l.loki.DeviceType != nil && len(event.TargetDevice.DeviceID) > 0 {
+		if deviceType := l.loki.DeviceType(event.TargetDevice.DeviceID); len(deviceType) > 0 {
+			labels["device_type"] = deviceType
+		}
+	}
+
+	if len(event.EventTags) > 0 {
+		tags := make([]string, len(event.EventTags))
+		copy(tags, event.EventTags)
+		sort.Strings(tags)
+		labels["tags"] = strings.Join(tags, ",")
+	}
+
+	return labels
+}
+
+func (l *LokiForwarder) start() {
+	slog.Info("Starting loki forwarder", "url", l.loki.URL)
+	ticker := time.NewTicker(l.interval)
+
+	for {
+		select {
+		case <-ticker.C:
+			//send it off
+			slog.Debug("Sending loki push", "url", l.loki.URL)
+			l.flush()
+
+		case entry := <-l.incomingChannel:
+			l.buffer = append(l.buffer, entry)
+			l.stats.Buffered()
+			if l.bufferSize > 0 && len(l.buffer) >= l.bufferSize {
+				slog.Debug("Loki buffer full, sending early", "url", l.loki.URL, "size", len(l.buffer))
+				l.flush()
+			}
+		case req := <-l.closeChannel:
+			ticker.Stop()
+			l.drain()
+
+			slog.Info("Flushing loki forwarder before closing", "url", l.loki.URL, "items", len(l.buffer))
+			var result FlushResult
+			var err error
+			if len(l.buffer) > 0 {
+				m, b := l.checkpoint(l.drain), l.stats.Take()
+				err = l.forward(l.buffer, m, b)
+				if err == nil {
+					result.Flushed = len(l.buffer)
+				} else {
+					result.Abandoned = len(l.buffer)
+				}
+			}
+			l.buffer = []lokiEntry{}
+
+			l.finish(req, result, err)
+			return
+		}
+	}
+}
+
+// drain buffers anything left in the incoming channel
+func (l *LokiForwarder) drain() {
+	for {
+		select {
+		case entry := <-l.incomingChannel:
+			l.buffer = append(l.buffer, entry)
+			l.stats.Buffered()
+		default:
+			return
+		}
+	}
+}
+
+func (l *LokiForwarder) flush() {
+	if len(l.buffer) == 0 {
+		return
+	}
+
+	m := l.checkpoint(l.drain)
+	toSend, b := l.buffer, l.stats.Take()
+	l.goSend(func() {
+		if err := l.forward(toSend, m, b); err != nil {
+			slog.Error("Couldn't send loki push", "url", l.loki.URL, "error", err)
+		}
+	})
+
+	l.buffer = []lokiEntry{}
+}
+
+// forward pushes toSend, acking the write ahead log if it made it to loki
+func (l *LokiForwarder) forward(toSend []lokiEntry, m wal.Marker, b *metrics.Batch) error {
+	start := time.Now()
+	err := loki.Push(l.loki.URL, l.loki.Auth, streams(toSend))
+	l.stats.Observe(start)
+
+	if err != nil {
+		b.Done(0, len(toSend))
+		return err
+	}
+
+	l.ack(m)
+	b.Done(len(toSend), 0)
+	return nil
+}
+
+// streams groups entries by their labels, in the order each stream was first seen. Each stream's lines are in timestamp order
+func streams(entries []lokiEntry) []loki.Stream {
+	var toReturn []loki.Stream
+	index := make(map[string]int)
+
+	for _, entry := range entries {
+		key := streamKey(entry.Labels)
+
+		i, ok := index[key]
+		if !ok {
+			i = len(toReturn)
+			index[key] = i
+			toReturn = append(toReturn, loki.Stream{Labels: entry.Labels})
+		}
+
+		toReturn[i].Values = append(toReturn[i].Values, [2]string{entry.Timestamp, entry.Line})
+	}
+
+	for i := range toReturn {
+		values := toReturn[i].Values
+		sort.SliceStable(values, func(a, b int) bool {
+			ta, _ := strconv.ParseInt(values[a][0], 10, 64)
+			tb, _ := strconv.ParseInt(values[b][0], 10, 64)
+			return ta < tb
+		})
+	}
+
+	return toReturn
+}
+
+// streamKey is the same for any two label sets that are equal
+func streamKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&sb, "%s=%q,", k, labels[k])
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,103 @@
+package managers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/byuoitav/event-forwarding-microservice/events"
+	"github.com/byuoitav/event-forwarding-microservice/loki"
+	sd "github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLokiStreams(t *testing.T) {
+	server := newHookServer(http.StatusNoContent)
+	defer server.Close()
+
+	l := GetDefaultLokiForwarder(Loki{
+		URL:  server.URL,
+		Auth: loki.Auth{TenantID: "av", Username: "user", Password: "pass"},
+		DeviceType: func(id string) string {
+			return map[string]string{"ITB-1101-D1": "display", "ITB-1101-CP1": "control-processor"}[id]
+		},
+	}, time.Hour, 0, nil, nil, nil)
+
+	timestamp := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	display := events.BasicDeviceInfo{
+		BasicRoomInfo: events.BasicRoomInfo{BuildingID: "ITB", RoomID: "ITB-1101"},
+		DeviceID:      "ITB-1101-D1",
+	}
+
+	require.NoError(t, l.Send(events.Event{Key: "power", Value: "on", TargetDevice: display, EventTags: []string{"user-generated", "core-state"}, Timestamp: timestamp.Add(time.Second)}))
+	require.NoError(t, l.Send(&events.Event{Key: "input", Value: "hdmi1", TargetDevice: display, EventTags: []string{"core-state", "user-generated"}, Timestamp: timestamp}))
+	require.NoError(t, l.Send(events.Event{Key: "heartbeat", AffectedRoom: events.BasicRoomInfo{BuildingID: "JFSB"}, Timestamp: timestamp}))
+	assert.Error(t, l.Send(sd.StaticDevice{DeviceID: "ITB-1101-D1"}))
+
+	result, err := closeForwarder(t, l)
+	require.NoError(t, err)
+	assert.Equal(t, FlushResult{Flushed: 3}, result)
+
+	require.Len(t, server.requests, 1)
+	r := server.requests[0]
+	assert.Equal(t, loki.PushEndpoint, r.URL.Path)
+	assert.Equal(t, "av", r.Header.Get("X-Scope-OrgID"))
+	user, pass, ok := r.BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "user", user)
+	assert.Equal(t, "pass", pass)
+
+	var push loki.PushRequest
+	require.NoError(t, json.Unmarshal([]byte(server.bodies[0]), &push))
+	require.Len(t, push.Streams, 2)
+
+	// the tags are in the same stream whatever order they're in, and the lines are in timestamp order
+	stream := push.Streams[0]
+	assert.Equal(t, map[string]string{"job": "event-forwarder", "building": "ITB", "device_type": "display", "tags": "core-state,user-generated"}, stream.Labels)
+	require.Len(t, stream.Values, 2)
+	assert.Equal(t, "1714564800000000000", stream.Values[0][0])
+
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(stream.Values[0][1]), &line))
+	assert.Equal(t, "input", line["key"])
+	assert.Equal(t, "hdmi1", line["value"])
+
+	assert.Equal(t, map[string]string{"job": "event-forwarder", "building": "JFSB"}, push.Streams[1].Labels)
+}
+
+func TestLokiInterval(t *testing.T) {
+	server := newHookServer(http.StatusNoContent)
+	defer server.Close()
+
+	l := GetDefaultLokiForwarder(Loki{URL: server.URL, Labels: map[string]string{"env": "test"}}, 50*time.Millisecond, 0, nil, nil, nil)
+	require.NoError(t, l.Send(events.Event{Key: "power"}))
+
+	assert.Eventually(t, func() bool {
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		return len(server.bodies) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	result, err := closeForwarder(t, l)
+	require.NoError(t, err)
+	assert.Equal(t, FlushResult{}, result)
+
+	var push loki.PushRequest
+	require.NoError(t, json.Unmarshal([]byte(server.bodies[0]), &push))
+	require.Len(t, push.Streams, 1)
+	assert.Equal(t, map[string]string{"env": "test"}, push.Streams[0].Labels)
+}
+
+func TestLokiFailure(t *testing.T) {
+	server := newHookServer(http.StatusBadRequest)
+	defer server.Close()
+
+	l := GetDefaultLokiForwarder(Loki{URL: server.URL}, time.Hour, 0, nil, nil, nil)
+	require.NoError(t, l.Send(events.Event{Key: "power"}))
+
+	result, err := closeForwarder(t, l)
+	assert.Error(t, err)
+	assert.Equal(t, FlushResult{Abandoned: 1}, result)
+}
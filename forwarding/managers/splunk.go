@@ -0,0 +1,209 @@
+package managers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/byuoitav/event-forwarding-microservice/events"
+	"github.com/byuoitav/event-forwarding-microservice/metrics"
+	"github.com/byuoitav/event-forwarding-microservice/splunk"
+	sd "github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
+	"github.com/byuoitav/event-forwarding-microservice/transform"
+	"github.com/byuoitav/event-forwarding-microservice/wal"
+)
+
+// Splunk is where a splunk forwarder sends what it's given
+type Splunk struct {
+	URL   string
+	Token string
+
+	// optional, the collector's defaults are used if they're empty
+	Index  string
+	Source string
+	Host   string
+}
+
+// SplunkForwarder batches events and devices and sends them to a splunk HTTP Event Collector
+type SplunkForwarder struct {
+	lifecycle
+	journal
+
+	incomingChannel chan splunk.Event
+	buffer          []splunk.Event
+
+	hec        Splunk
+	sourceType string
+	interval   time.Duration //how often to send an update
+	bufferSize int           //send early if the buffer reaches this size
+	transform  transform.Chain
+	stats      *metrics.Forwarder
+}
+
+// GetDefaultSplunkForwarder returns a splunk forwarder after starting it. Everything it sends has a sourcetype of av:<dataType>
+func GetDefaultSplunkForwarder(hec Splunk, dataType string, interval time.Duration, bufferSize int, log *wal.Log, transforms transform.Chain, stats *metrics.Forwarder) *SplunkForwarder {
+	toReturn := &SplunkForwarder{
+		lifecycle:       newLifecycle(),
+		journal:         newJournal(log),
+		incomingChannel: make(chan splunk.Event, 10000),
+		hec:             hec,
+		sourceType:      "av:" + dataType,
+		interval:        interval,
+		bufferSize:      bufferSize,
+		transform:       transforms,
+		stats:           stats,
+	}
+
+	toReturn.replay(func(item json.RawMessage) error {
+		var event splunk.Event
+		if err := json.Unmarshal(item, &event); err != nil {
+			return err
+		}
+
+		toReturn.buffer = append(toReturn.buffer, event)
+		toReturn.stats.Buffered()
+		return nil
+	})
+
+	go toReturn.start()
+
+	return toReturn
+}
+
+// Send takes an event or device and adds it to the buffer
+func (s *SplunkForwarder) Send(toSend interface{}) error {
+	var timestamp time.Time
+
+	switch v := toSend.(type) {
+	case *events.Event:
+		timestamp = v.Timestamp
+	case events.Event:
+		timestamp = v.Timestamp
+	case *sd.StaticDevice:
+		timestamp = v.LastStateReceived
+	case sd.StaticDevice:
+		timestamp = v.LastStateReceived
+	default:
+		return errors.New("Invalid type to send via a Splunk Forwarder, must be an event or a static device as defined in state/statedefinition")
+	}
+
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	doc, err := s.transform.Apply(toSend)
+	if err != nil {
+		return fmt.Errorf("couldn't send via splunk forwarder: %w", err)
+	}
+
+	if s.closed() {
+		return ErrClosed
+	}
+
+	event := splunk.Event{
+		Time:       splunk.Time(timestamp),
+		Host:       s.hec.Host,
+		Source:     s.hec.Source,
+		SourceType: s.sourceType,
+		Index:      s.hec.Index,
+		Event:      doc,
+	}
+
+	select {
+	case s.incomingChannel <- event:
+	case <-s.stopped:
+		return ErrClosed
+	}
+
+	s.record(event)
+	return nil
+}
+
+func (s *SplunkForwarder) start() {
+	slog.Info("Starting splunk forwarder", "url", s.hec.URL, "sourcetype", s.sourceType)
+	ticker := time.NewTicker(s.interval)
+
+	for {
+		select {
+		case <-ticker.C:
+			//send it off
+			slog.Debug("Sending bulk splunk update", "sourcetype", s.sourceType)
+			s.flush()
+
+		case event := <-s.incomingChannel:
+			s.buffer = append(s.buffer, event)
+			s.stats.Buffered()
+			if s.bufferSize > 0 && len(s.buffer) >= s.bufferSize {
+				slog.Debug("Splunk buffer full, sending early", "sourcetype", s.sourceType, "size", len(s.buffer))
+				s.flush()
+			}
+		case req := <-s.closeChannel:
+			ticker.Stop()
+			s.drain()
+
+			slog.Info("Flushing splunk forwarder before closing", "sourcetype", s.sourceType, "items", len(s.buffer))
+			var result FlushResult
+			var err error
+			if len(s.buffer) > 0 {
+				m, b := s.checkpoint(s.drain), s.stats.Take()
+				err = s.forward(s.buffer, m, b)
+				if err == nil {
+					result.Flushed = len(s.buffer)
+				} else {
+					result.Abandoned = len(s.buffer)
+				}
+			}
+			s.buffer = []splunk.Event{}
+
+			s.finish(req, result, err)
+			return
+		}
+	}
+}
+
+// drain buffers anything left in the incoming channel
+func (s *SplunkForwarder) drain() {
+	for {
+		select {
+		case event := <-s.incomingChannel:
+			s.buffer = append(s.buffer, event)
+			s.stats.Buffered()
+		default:
+			return
+		}
+	}
+}
+
+func (s *SplunkForwarder) flush() {
+	if len(s.buffer) == 0 {
+		return
+	}
+
+	m := s.checkpoint(s.drain)
+	toSend, b := s.buffer, s.stats.Take()
+	s.goSend(func() {
+		if err := s.forward(toSend, m, b); err != nil {
+			slog.Error("Couldn't send splunk update", "sourcetype", s.sourceType, "error", err)
+		}
+	})
+
+	s.buffer = []splunk.Event{}
+}
+
+// forward sends toSend, acking the write ahead log if it made it to splunk
+func (s *SplunkForwarder) forward(toSend []splunk.Event, m wal.Marker, b *metrics.Batch) error {
+	start := time.Now()
+	err := splunk.BulkForward(s.hec.URL, s.hec.Token, toSend)
+	s.stats.Observe(start)
+
+	if err != nil {
+		b.Done(0, len(toSend))
+		return err
+	}
+
+	s.ack(m)
+	b.Done(len(toSend), 0)
+	return nil
+}
@@ -0,0 +1,112 @@
+package managers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/byuoitav/event-forwarding-microservice/config"
+	"github.com/byuoitav/event-forwarding-microservice/events"
+	"github.com/byuoitav/event-forwarding-microservice/splunk"
+	sd "github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// splunkEvents decodes the events in a collector request body
+func splunkEvents(t *testing.T, body string) []splunk.Event {
+	var toReturn []splunk.Event
+
+	dec := json.NewDecoder(strings.NewReader(body))
+	for dec.More() {
+		var event splunk.Event
+		require.NoError(t, dec.Decode(&event))
+		toReturn = append(toReturn, event)
+	}
+
+	return toReturn
+}
+
+func TestSplunkEvents(t *testing.T) {
+	server := newHookServer(http.StatusOK)
+	defer server.Close()
+
+	s := GetDefaultSplunkForwarder(Splunk{
+		URL:    server.URL + "/",
+		Token:  "token",
+		Index:  "av",
+		Source: "event-forwarder",
+	}, config.EVENT, 50*time.Millisecond, 0, nil, nil, nil)
+
+	timestamp := time.Date(2024, 5, 1, 12, 30, 0, 250*int(time.Millisecond), time.UTC)
+	require.NoError(t, s.Send(events.Event{Key: "power", Value: "on", Timestamp: timestamp}))
+	require.NoError(t, s.Send(&events.Event{Key: "input", Value: "hdmi1", Timestamp: timestamp}))
+	assert.Error(t, s.Send(sd.StaticRoom{RoomID: "ITB-1101"}))
+
+	// sent on the interval
+	assert.Eventually(t, func() bool {
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		return len(server.bodies) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	result, err := closeForwarder(t, s)
+	require.NoError(t, err)
+	assert.Equal(t, FlushResult{}, result)
+
+	r := server.requests[0]
+	assert.Equal(t, splunk.EventEndpoint, r.URL.Path)
+	assert.Equal(t, "Splunk token", r.Header.Get("Authorization"))
+
+	sent := splunkEvents(t, server.bodies[0])
+	require.Len(t, sent, 2)
+	assert.Equal(t, 1714566600.25, sent[0].Time)
+	assert.Equal(t, "av:event", sent[0].SourceType)
+	assert.Equal(t, "av", sent[0].Index)
+	assert.Equal(t, "event-forwarder", sent[0].Source)
+	assert.Equal(t, "power", sent[0].Event["key"])
+	assert.Equal(t, "hdmi1", sent[1].Event["value"])
+}
+
+func TestSplunkDevices(t *testing.T) {
+	server := newHookServer(http.StatusOK)
+	defer server.Close()
+
+	s := GetDefaultSplunkForwarder(Splunk{URL: server.URL, Token: "token"}, config.DEVICE, time.Hour, 2, nil, nil, nil)
+
+	// a full buffer is sent early
+	require.NoError(t, s.Send(sd.StaticDevice{DeviceID: "ITB-1101-D1"}))
+	require.NoError(t, s.Send(sd.StaticDevice{DeviceID: "ITB-1101-D2"}))
+	assert.Eventually(t, func() bool {
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		return len(server.bodies) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, s.Send(sd.StaticDevice{DeviceID: "ITB-1101-D3"}))
+	result, err := closeForwarder(t, s)
+	require.NoError(t, err)
+	assert.Equal(t, FlushResult{Flushed: 1}, result)
+
+	require.Len(t, server.bodies, 2)
+	first := splunkEvents(t, server.bodies[0])
+	require.Len(t, first, 2)
+	assert.Equal(t, "av:device", first[0].SourceType)
+	assert.Equal(t, "ITB-1101-D1", first[0].Event["deviceID"])
+	assert.NotZero(t, first[0].Time)
+	assert.Empty(t, first[0].Index)
+}
+
+func TestSplunkFailure(t *testing.T) {
+	server := newHookServer(http.StatusForbidden)
+	defer server.Close()
+
+	s := GetDefaultSplunkForwarder(Splunk{URL: server.URL, Token: "bad"}, config.EVENT, time.Hour, 0, nil, nil, nil)
+	require.NoError(t, s.Send(events.Event{Key: "power"}))
+
+	result, err := closeForwarder(t, s)
+	assert.Error(t, err)
+	assert.Equal(t, FlushResult{Abandoned: 1}, result)
+}
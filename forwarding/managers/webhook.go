@@ -0,0 +1,354 @@
+package managers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/byuoitav/event-forwarding-microservice/elk"
+	"github.com/byuoitav/event-forwarding-microservice/events"
+	"github.com/byuoitav/event-forwarding-microservice/metrics"
+	sd "github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
+	"github.com/byuoitav/event-forwarding-microservice/structs"
+	"github.com/byuoitav/event-forwarding-microservice/transform"
+	"github.com/byuoitav/event-forwarding-microservice/wal"
+)
+
+// Webhook is where and how a webhook forwarder sends what it's given
+type Webhook struct {
+	URL     string
+	Headers map[string]string
+
+	// either a bearer token or basic auth
+	BearerToken string
+	Username    string
+	Password    string
+
+	// the body, or nil to send the items as JSON
+	Template *template.Template
+
+	// most items to send in one request, 0 sends each item in its own request
+	BatchSize int
+
+	// signs the body with HMAC-SHA256 if set
+	Secret          string
+	SignatureHeader string
+
+	Timeout time.Duration
+
+	// how a request that fails is retried
+	Retry elk.RetryPolicy
+}
+
+// WebhookPayload is what a webhook's template is executed with
+type WebhookPayload struct {
+	DataType string
+	Items    []map[string]interface{}
+
+	// the first item, for webhooks that send one item per request
+	Item map[string]interface{}
+}
+
+// WebhookForwarder batches events, devices, rooms, or issues and POSTs them to a URL
+type WebhookForwarder struct {
+	lifecycle
+	journal
+
+	incomingChannel chan map[string]interface{}
+	buffer          []map[string]interface{}
+
+	hook      Webhook
+	dataType  string
+	interval  time.Duration //how often to send an update
+	client    *http.Client
+	transform transform.Chain
+	stats     *metrics.Forwarder
+}
+
+// GetDefaultWebhookForwarder returns a webhook forwarder after starting it
+func GetDefaultWebhookForwarder(hook Webhook, dataType string, interval time.Duration, log *wal.Log, transforms transform.Chain, stats *metrics.Forwarder) *WebhookForwarder {
+	if len(hook.SignatureHeader) == 0 {
+		hook.SignatureHeader = "X-Signature"
+	}
+	if hook.Timeout <= 0 {
+		hook.Timeout = 10 * time.Second
+	}
+	if hook.Retry.InitialBackoff <= 0 {
+		hook.Retry.InitialBackoff = elk.DefaultRetryPolicy.InitialBackoff
+	}
+	if hook.Retry.MaxBackoff <= 0 {
+		hook.Retry.MaxBackoff = elk.DefaultRetryPolicy.MaxBackoff
+	}
+
+	toReturn := &WebhookForwarder{
+		lifecycle:       newLifecycle(),
+		journal:         newJournal(log),
+		incomingChannel: make(chan map[string]interface{}, 10000),
+		hook:            hook,
+		dataType:        dataType,
+		interval:        interval,
+		client:          &http.Client{Timeout: hook.Timeout},
+		transform:       transforms,
+		stats:           stats,
+	}
+
+	toReturn.replay(func(item json.RawMessage) error {
+		var doc map[string]interface{}
+		if err := json.Unmarshal(item, &doc); err != nil {
+			return err
+		}
+
+		toReturn.buffer = append(toReturn.buffer, doc)
+		toReturn.stats.Buffered()
+		return nil
+	})
+
+	go toReturn.start()
+
+	return toReturn
+}
+
+// Send takes an event, device, room, or room issue and adds it to the buffer
+func (w *WebhookForwarder) Send(toSend interface{}) error {
+	switch toSend.(type) {
+	case *events.Event, events.Event:
+	case *sd.StaticDevice, sd.StaticDevice:
+	case *sd.StaticRoom, sd.StaticRoom:
+	case *structs.RoomIssue, structs.RoomIssue:
+	default:
+		return errors.New("Invalid type to send via a Webhook Forwarder, must be an event, a static device/room as defined in state/statedefinition, or a room issue")
+	}
+
+	doc, err := w.transform.Apply(toSend)
+	if err != nil {
+		return fmt.Errorf("couldn't send via webhook forwarder: %w", err)
+	}
+
+	if w.closed() {
+		return ErrClosed
+	}
+
+	select {
+	case w.incomingChannel <- doc:
+	case <-w.stopped:
+		return ErrClosed
+	}
+
+	w.record(doc)
+	return nil
+}
+
+func (w *WebhookForwarder) start() {
+	slog.Info("Starting webhook forwarder", "url", w.hook.URL, "dataType", w.dataType)
+	ticker := time.NewTicker(w.interval)
+
+	for {
+		select {
+		case <-ticker.C:
+			w.flush()
+
+		case doc := <-w.incomingChannel:
+			w.buffer = append(w.buffer, doc)
+			w.stats.Buffered()
+		case req := <-w.closeChannel:
+			ticker.Stop()
+			w.drain()
+
+			slog.Info("Flushing webhook forwarder before closing", "url", w.hook.URL, "items", len(w.buffer))
+			var result FlushResult
+			var err error
+			if len(w.buffer) > 0 {
+				m, b := w.checkpoint(w.drain), w.stats.Take()
+				var sent int
+				sent, err = w.forward(req.ctx, w.buffer, m, b)
+				result.Flushed = sent
+				result.Abandoned = len(w.buffer) - sent
+			}
+			w.buffer = []map[string]interface{}{}
+
+			w.finish(req, result, err)
+			return
+		}
+	}
+}
+
+// drain buffers anything left in the incoming channel
+func (w *WebhookForwarder) drain() {
+	for {
+		select {
+		case doc := <-w.incomingChannel:
+			w.buffer = append(w.buffer, doc)
+			w.stats.Buffered()
+		default:
+			return
+		}
+	}
+}
+
+func (w *WebhookForwarder) flush() {
+	if len(w.buffer) == 0 {
+		return
+	}
+
+	m := w.checkpoint(w.drain)
+	toSend, b := w.buffer, w.stats.Take()
+	w.goSend(func() {
+		if _, err := w.forward(context.Background(), toSend, m, b); err != nil {
+			slog.Error("Couldn't send webhook update", "url", w.hook.URL, "error", err)
+		}
+	})
+
+	w.buffer = []map[string]interface{}{}
+}
+
+/*
+forward sends toSend a batch at a time, retrying a batch that fails with backoff. A batch that still fails after every retry is given up on.
+Once each batch has been sent or given up on, the write ahead log is acked, so a restart doesn't send what was delivered again.
+If ctx is done first, whatever hasn't been sent is recorded again so it's replayed. It returns how many items were sent.
+*/
+func (w *WebhookForwarder) forward(ctx context.Context, toSend []map[string]interface{}, m wal.Marker, b *metrics.Batch) (int, error) {
+	size := w.hook.BatchSize
+	if size <= 0 {
+		size = 1
+	}
+
+	sent := 0
+	var errs []error
+	for start := 0; start < len(toSend); start += size {
+		batch := toSend[start:min(start+size, len(toSend))]
+
+		err := w.postWithRetry(ctx, batch)
+		if ctx.Err() != nil {
+			for _, doc := range toSend[start:] {
+				w.record(doc)
+			}
+
+			errs = append(errs, fmt.Errorf("gave up sending: %w", ctx.Err()))
+			break
+		}
+
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		sent += len(batch)
+	}
+
+	b.Done(sent, len(toSend)-sent)
+	w.ack(m)
+
+	if len(errs) > 0 {
+		return sent, fmt.Errorf("couldn't send %v of %v items: %w", len(toSend)-sent, len(toSend), errors.Join(errs...))
+	}
+	return sent, nil
+}
+
+// postWithRetry posts batch, retrying with backoff until it's sent, it fails in a way that can't be retried, the retries run out, or ctx is done
+func (w *WebhookForwarder) postWithRetry(ctx context.Context, batch []map[string]interface{}) error {
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			wait := w.hook.Retry.Backoff(attempt)
+			slog.Info("Retrying webhook request", "url", w.hook.URL, "attempt", attempt, "items", len(batch), "backoff", wait)
+
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			}
+		}
+
+		begin := time.Now()
+		retry, err := w.post(ctx, batch)
+		w.stats.Observe(begin)
+
+		if err == nil || !retry || attempt >= w.hook.Retry.MaxRetries {
+			return err
+		}
+		slog.Warn("Couldn't send webhook request", "url", w.hook.URL, "attempt", attempt, "error", err)
+	}
+}
+
+// post sends a single request with the items in batch. It returns true if the request failed in a way that's worth retrying,
+// i.e. it couldn't be sent, or the response was a 429 or 5xx.
+func (w *WebhookForwarder) post(ctx context.Context, batch []map[string]interface{}) (bool, error) {
+	body, err := w.body(batch)
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.hook.Headers {
+		req.Header.Set(k, v)
+	}
+
+	switch {
+	case len(w.hook.BearerToken) > 0:
+		req.Header.Set("Authorization", "Bearer "+w.hook.BearerToken)
+	case len(w.hook.Username) > 0:
+		req.SetBasicAuth(w.hook.Username, w.hook.Password)
+	}
+
+	if len(w.hook.Secret) > 0 {
+		req.Header.Set(w.hook.SignatureHeader, "sha256="+Sign(w.hook.Secret, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("failed to send HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode/100 == 5
+		return retry, fmt.Errorf("non 200 response code received. code: %v, body: %s", resp.StatusCode, b)
+	}
+
+	return false, nil
+}
+
+// body renders the request body for batch, with the template if there is one
+func (w *WebhookForwarder) body(batch []map[string]interface{}) ([]byte, error) {
+	if w.hook.Template == nil {
+		if w.hook.BatchSize <= 0 {
+			return json.Marshal(batch[0])
+		}
+		return json.Marshal(batch)
+	}
+
+	var buf bytes.Buffer
+	err := w.hook.Template.Execute(&buf, WebhookPayload{
+		DataType: w.dataType,
+		Items:    batch,
+		Item:     batch[0],
+	})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't execute webhook template: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
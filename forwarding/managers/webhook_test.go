@@ -0,0 +1,230 @@
+package managers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/byuoitav/event-forwarding-microservice/config"
+	"github.com/byuoitav/event-forwarding-microservice/elk"
+	"github.com/byuoitav/event-forwarding-microservice/events"
+	sd "github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
+	"github.com/byuoitav/event-forwarding-microservice/wal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hookServer records the requests made to it
+type hookServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	bodies   []string
+	requests []*http.Request
+}
+
+func newHookServer(status int) *hookServer {
+	h := &hookServer{}
+	h.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		b, _ := io.ReadAll(r.Body)
+		h.bodies = append(h.bodies, string(b))
+		h.requests = append(h.requests, r)
+		w.WriteHeader(status)
+	}))
+
+	return h
+}
+
+func closeForwarder(t *testing.T, f interface {
+	Close(context.Context) (FlushResult, error)
+}) (FlushResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return f.Close(ctx)
+}
+
+func TestWebhookBatches(t *testing.T) {
+	server := newHookServer(http.StatusOK)
+	defer server.Close()
+
+	tmpl, err := config.ParseWebhookTemplate(`{"type": "{{.DataType}}", "keys": [{{range $i, $e := .Items}}{{if $i}},{{end}}{{json $e.key}}{{end}}]}`)
+	require.NoError(t, err)
+
+	w := GetDefaultWebhookForwarder(Webhook{
+		URL:         server.URL,
+		Headers:     map[string]string{"X-Source": "forwarder"},
+		BearerToken: "token",
+		Template:    tmpl,
+		BatchSize:   2,
+		Secret:      "secret",
+	}, config.EVENT, time.Hour, nil, nil, nil)
+
+	for _, key := range []string{"a", "b", "c"} {
+		require.NoError(t, w.Send(events.Event{Key: key}))
+	}
+	assert.Error(t, w.Send("not an event"))
+
+	result, err := closeForwarder(t, w)
+	require.NoError(t, err)
+	assert.Equal(t, FlushResult{Flushed: 3}, result)
+
+	require.Equal(t, []string{
+		`{"type": "event", "keys": ["a","b"]}`,
+		`{"type": "event", "keys": ["c"]}`,
+	}, server.bodies)
+
+	r := server.requests[0]
+	assert.Equal(t, http.MethodPost, r.Method)
+	assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+	assert.Equal(t, "forwarder", r.Header.Get("X-Source"))
+	assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+	assert.Equal(t, "sha256="+Sign("secret", []byte(server.bodies[0])), r.Header.Get("X-Signature"))
+}
+
+func TestWebhookSingleItems(t *testing.T) {
+	server := newHookServer(http.StatusNoContent)
+	defer server.Close()
+
+	w := GetDefaultWebhookForwarder(Webhook{
+		URL:      server.URL,
+		Username: "user",
+		Password: "pass",
+	}, config.DEVICE, time.Hour, nil, nil, nil)
+
+	require.NoError(t, w.Send(sd.StaticDevice{DeviceID: "ITB-1101-D1", Power: "on"}))
+	require.NoError(t, w.Send(&sd.StaticDevice{DeviceID: "ITB-1101-D2", Power: "standby"}))
+
+	result, err := closeForwarder(t, w)
+	require.NoError(t, err)
+	assert.Equal(t, FlushResult{Flushed: 2}, result)
+
+	require.Len(t, server.bodies, 2)
+	var device sd.StaticDevice
+	require.NoError(t, json.Unmarshal([]byte(server.bodies[0]), &device))
+	assert.Equal(t, "ITB-1101-D1", device.DeviceID)
+	assert.Equal(t, "on", device.Power)
+
+	user, pass, ok := server.requests[1].BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "user", user)
+	assert.Equal(t, "pass", pass)
+	assert.Empty(t, server.requests[1].Header.Get("X-Signature"))
+}
+
+func TestWebhookFailure(t *testing.T) {
+	server := newHookServer(http.StatusInternalServerError)
+	defer server.Close()
+
+	w := GetDefaultWebhookForwarder(Webhook{URL: server.URL, BatchSize: 10}, config.ROOM, time.Hour, nil, nil, nil)
+	require.NoError(t, w.Send(sd.StaticRoom{RoomID: "ITB-1101"}))
+
+	result, err := closeForwarder(t, w)
+	assert.Error(t, err)
+	assert.Equal(t, FlushResult{Abandoned: 1}, result)
+
+	assert.ErrorIs(t, w.Send(sd.StaticRoom{RoomID: "ITB-1101"}), ErrClosed)
+}
+
+// replayedKeys reopens the log in dir and returns the keys of the events left in it
+func replayedKeys(t *testing.T, dir string) []string {
+	log, err := wal.Open(dir, 0, wal.DropOldest)
+	require.NoError(t, err)
+	defer log.Close()
+
+	var keys []string
+	require.NoError(t, log.Replay(func(item json.RawMessage) error {
+		var doc map[string]interface{}
+		require.NoError(t, json.Unmarshal(item, &doc))
+		keys = append(keys, doc["key"].(string))
+		return nil
+	}))
+	return keys
+}
+
+func TestWebhookRetry(t *testing.T) {
+	// "a" fails with a 503 the first time it's sent, "b" is always rejected with a 400
+	var mu sync.Mutex
+	attempts := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		var doc map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&doc)
+		key := doc["key"].(string)
+		attempts[key]++
+
+		switch {
+		case key == "a" && attempts[key] == 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case key == "b":
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	log, err := wal.Open(dir, 0, wal.DropOldest)
+	require.NoError(t, err)
+
+	w := GetDefaultWebhookForwarder(Webhook{
+		URL:   server.URL,
+		Retry: elk.RetryPolicy{MaxRetries: 2, InitialBackoff: time.Millisecond},
+	}, config.EVENT, time.Hour, log, nil, nil)
+
+	for _, key := range []string{"a", "b", "c"} {
+		require.NoError(t, w.Send(events.Event{Key: key}))
+	}
+
+	result, err := closeForwarder(t, w)
+	assert.Error(t, err)
+	assert.Equal(t, FlushResult{Flushed: 2, Abandoned: 1}, result)
+	assert.Equal(t, map[string]int{"a": 2, "b": 1, "c": 1}, attempts)
+
+	// what was delivered isn't sent again after a restart
+	require.NoError(t, log.Close())
+	assert.Empty(t, replayedKeys(t, dir))
+}
+
+func TestWebhookCloseTimeout(t *testing.T) {
+	// "a" is sent, then the endpoint stops responding
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var doc map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&doc)
+		if doc["key"] != "a" {
+			<-release
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	dir := t.TempDir()
+	log, err := wal.Open(dir, 0, wal.DropOldest)
+	require.NoError(t, err)
+
+	w := GetDefaultWebhookForwarder(Webhook{URL: server.URL}, config.EVENT, time.Hour, log, nil, nil)
+	for _, key := range []string{"a", "b", "c"} {
+		require.NoError(t, w.Send(events.Event{Key: key}))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err = w.Close(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// only what wasn't sent is replayed, once the flush has given up
+	<-w.stopped
+	require.NoError(t, log.Close())
+	assert.Equal(t, []string{"b", "c"}, replayedKeys(t, dir))
+}
@@ -1,18 +1,42 @@
 package managers
 
-import "github.com/byuoitav/shipwright/socket"
+import (
+	"context"
+	"fmt"
+
+	"github.com/byuoitav/event-forwarding-microservice/transform"
+	"github.com/byuoitav/shipwright/socket"
+)
 
 //WebsocketForwarder .
 type WebsocketForwarder struct {
+	transform transform.Chain
 }
 
 //GetDefaultWebsocketForwarder .
-func GetDefaultWebsocketForwarder() *WebsocketForwarder {
-	return &WebsocketForwarder{}
+func GetDefaultWebsocketForwarder(transforms transform.Chain) *WebsocketForwarder {
+	return &WebsocketForwarder{
+		transform: transforms,
+	}
 }
 
 //Send .
 func (e *WebsocketForwarder) Send(toSend interface{}) error {
+	if len(e.transform) > 0 {
+		doc, err := e.transform.Apply(toSend)
+		if err != nil {
+			return fmt.Errorf("couldn't send via websocket forwarder: %w", err)
+		}
+
+		socket.GetManager().WriteToSockets(doc)
+		return nil
+	}
+
 	socket.GetManager().WriteToSockets(toSend)
 	return nil
 }
+
+//Close does nothing, the websocket forwarder doesn't buffer anything.
+func (e *WebsocketForwarder) Close(ctx context.Context) (FlushResult, error) {
+	return FlushResult{}, nil
+}
@@ -0,0 +1,76 @@
+package forwarding
+
+import (
+	"github.com/byuoitav/event-forwarding-microservice/config"
+	"github.com/byuoitav/event-forwarding-microservice/transform"
+)
+
+// redacted is what redacted fields are replaced with by default
+const redacted = "REDACTED"
+
+// getTransforms builds the transform chain for a forwarder. ELK forwarders finish with elk-sanitize unless the chain already has it.
+func getTransforms(i config.Forwarder) transform.Chain {
+	var chain transform.Chain
+	sanitized := false
+
+	for _, t := range i.Transforms {
+		switch t.Type {
+		case config.TRANSFORMDROP:
+			chain = append(chain, transform.Drop(t.Fields...))
+		case config.TRANSFORMRENAME:
+			chain = append(chain, transform.Rename(t.Rename))
+		case config.TRANSFORMREDACT:
+			fields := t.Fields
+			if len(fields) == 0 {
+				fields = []string{"user"}
+			}
+
+			value := t.Value
+			if len(value) == 0 {
+				value = redacted
+			}
+
+			chain = append(chain, transform.Redact(fields, value, t.Hash))
+		case config.TRANSFORMFLATTEN:
+			separator := t.Separator
+			if len(separator) == 0 {
+				separator = "_"
+			}
+
+			chain = append(chain, transform.Flatten(t.Fields, separator))
+		case config.TRANSFORMADD:
+			chain = append(chain, transform.Add(t.Values))
+		case config.TRANSFORMDERIVE:
+			if fn := deriveFunction(t.Function); fn != nil {
+				chain = append(chain, transform.Derive(t.Field, t.From, fn))
+			}
+		case config.TRANSFORMELKSANITIZE:
+			chain = append(chain, transform.ElkSanitize())
+			sanitized = true
+		}
+	}
+
+	if !sanitized && (i.Type == config.ELKSTATIC || i.Type == config.ELKTIMESERIES) {
+		chain = append(chain, transform.ElkSanitize())
+	}
+
+	return chain
+}
+
+func deriveFunction(name string) func(string) string {
+	switch name {
+	case config.DERIVEDEVICETYPE:
+		return func(id string) string {
+			if deviceTypeLookup == nil {
+				return ""
+			}
+			return deviceTypeLookup(id)
+		}
+	case config.DERIVEBUILDING:
+		return transform.BuildingFromID
+	case config.DERIVEROOM:
+		return transform.RoomFromID
+	}
+
+	return nil
+}
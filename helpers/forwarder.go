@@ -2,11 +2,13 @@ package helpers
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"sync"
 
 	"github.com/byuoitav/event-forwarding-microservice/cache"
 	"github.com/byuoitav/event-forwarding-microservice/events"
+	"github.com/byuoitav/event-forwarding-microservice/metrics"
 )
 
 // A ForwardManager manages events to efficiently forward them
@@ -15,8 +17,9 @@ type ForwardManager struct {
 	EventStream chan events.Event
 	EventCache  string
 
-	wg  *sync.WaitGroup
-	ctx context.Context // the context passed in when Start() was called
+	wg   *sync.WaitGroup
+	ctx  context.Context // the context passed in when Start() was called
+	done chan struct{}   // closed when Start() returns
 }
 
 var (
@@ -31,7 +34,10 @@ func GetForwardManager() *ForwardManager {
 			Workers:     10,
 			EventStream: make(chan events.Event, 10000),
 			EventCache:  "default",
+			done:        make(chan struct{}),
 		}
+
+		metrics.EventStreamDepth(func() int { return len(fm.EventStream) })
 	})
 
 	return fm
@@ -80,6 +86,21 @@ func (f *ForwardManager) Start(ctx context.Context) error {
 
 	f.wg.Wait()
 	slog.Info("forward manager stopped.")
+	close(f.done)
 
 	return nil
 }
+
+// Stop closes the event stream and waits for the workers to finish the events left in it.
+// If ctx is done first, it returns how many events were left unprocessed. Nothing can be sent to the event stream after Stop is called.
+func (f *ForwardManager) Stop(ctx context.Context) (int, error) {
+	slog.Info("Stopping forward manager", "pending", len(f.EventStream))
+	close(f.EventStream)
+
+	select {
+	case <-f.done:
+		return 0, nil
+	case <-ctx.Done():
+		return len(f.EventStream), fmt.Errorf("gave up waiting for the event stream to drain: %w", ctx.Err())
+	}
+}
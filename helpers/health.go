@@ -0,0 +1,143 @@
+package helpers
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/byuoitav/event-forwarding-microservice/cache"
+	"github.com/byuoitav/event-forwarding-microservice/metrics"
+)
+
+// hubConnected is the state the messenger reports while it's connected to the hub
+const hubConnected = "good"
+
+// HealthThresholds are how degraded things can get before the service is unhealthy
+type HealthThresholds struct {
+	// MaxForwarderFailures is how many sends in a row a forwarder can fail
+	MaxForwarderFailures int
+
+	// MaxHubDowntime is how long the hub can be disconnected
+	MaxHubDowntime time.Duration
+}
+
+// HealthReport is the state of everything the service depends on
+type HealthReport struct {
+	Status     string                     `json:"status"` // ok or degraded
+	Problems   []string                   `json:"problems,omitempty"`
+	Hub        HubHealth                  `json:"hub"`
+	Caches     map[string]cache.Status    `json:"caches"`
+	Forwarders map[string]ForwarderHealth `json:"forwarders"`
+}
+
+// HubHealth is the state of the connection to the hub
+type HubHealth struct {
+	State     string     `json:"state"`
+	DownSince *time.Time `json:"down-since,omitempty"`
+}
+
+// ForwarderHealth is how a forwarder's sends have been going
+type ForwarderHealth struct {
+	LastSuccess         *time.Time `json:"last-success,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive-failures"`
+	OldestUnflushed     *time.Time `json:"oldest-unflushed,omitempty"`
+}
+
+var (
+	hubDownSince time.Time
+	hubLock      sync.Mutex
+)
+
+// CheckLiveness reports whether the service itself is working. It fails if the hub has been disconnected for more than t.MaxHubDowntime.
+// Forwarders failing only means something downstream is, which restarting the service wouldn't fix, so they're left to readiness.
+func CheckLiveness(hubState string, t HealthThresholds) HealthReport {
+	r := buildReport(hubState)
+
+	if r.Hub.DownSince != nil && time.Since(*r.Hub.DownSince) > t.MaxHubDowntime {
+		r.problem("hub has been disconnected since %v", r.Hub.DownSince.Format(time.RFC3339))
+	}
+
+	return r
+}
+
+// CheckReadiness reports whether the service is ready to forward events. On top of liveness, it fails while the hub is disconnected,
+// a cache hasn't been fully loaded, or a forwarder has failed more than t.MaxForwarderFailures times in a row.
+func CheckReadiness(hubState string, t HealthThresholds) HealthReport {
+	r := buildReport(hubState)
+
+	if r.Hub.State != hubConnected {
+		r.problem("hub isn't connected: %q", r.Hub.State)
+	}
+
+	names := make([]string, 0, len(r.Caches))
+	for name := range r.Caches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if s := r.Caches[name]; !s.Initialized {
+			r.problem("cache %v isn't initialized: %v", name, s.Error)
+		}
+	}
+	r.checkForwarders(t)
+
+	return r
+}
+
+func buildReport(hubState string) HealthReport {
+	r := HealthReport{
+		Status:     "ok",
+		Hub:        HubHealth{State: hubState},
+		Caches:     cache.Statuses(),
+		Forwarders: make(map[string]ForwarderHealth),
+	}
+
+	hubLock.Lock()
+	switch {
+	case hubState == hubConnected:
+		hubDownSince = time.Time{}
+	case hubDownSince.IsZero():
+		hubDownSince = time.Now()
+	}
+
+	if !hubDownSince.IsZero() {
+		since := hubDownSince
+		r.Hub.DownSince = &since
+	}
+	hubLock.Unlock()
+
+	for name, s := range metrics.Statuses() {
+		f := ForwarderHealth{ConsecutiveFailures: s.ConsecutiveFailures}
+		if last := s.LastSuccess; !last.IsZero() {
+			f.LastSuccess = &last
+		}
+		if oldest := s.OldestUnflushed; !oldest.IsZero() {
+			f.OldestUnflushed = &oldest
+		}
+
+		r.Forwarders[name] = f
+	}
+
+	return r
+}
+
+func (r *HealthReport) checkForwarders(t HealthThresholds) {
+	names := make([]string, 0, len(r.Forwarders))
+	for name := range r.Forwarders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if f := r.Forwarders[name]; f.ConsecutiveFailures > t.MaxForwarderFailures {
+			r.problem("forwarder %v has failed %v times in a row", name, f.ConsecutiveFailures)
+		}
+	}
+}
+
+func (r *HealthReport) problem(format string, a ...interface{}) {
+	r.Status = "degraded"
+	r.Problems = append(r.Problems, fmt.Sprintf(format, a...))
+}
@@ -0,0 +1,28 @@
+package helpers
+
+import (
+	"github.com/byuoitav/event-forwarding-microservice/cache"
+	"github.com/byuoitav/event-forwarding-microservice/cache/shared"
+	"github.com/byuoitav/event-forwarding-microservice/forwarding"
+	sd "github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
+)
+
+func init() {
+	// let forwarder filters look up rooms and device types
+	forwarding.SetLookups(lookupRoom, shared.GetDeviceTypeByID)
+}
+
+// lookupRoom returns the room with roomID from the named cache
+func lookupRoom(cacheName, roomID string) (sd.StaticRoom, bool) {
+	c, ok := cache.LookupCache(cacheName)
+	if !ok {
+		return sd.StaticRoom{}, false
+	}
+
+	room, err := c.GetRoomRecord(roomID)
+	if err != nil || len(room.RoomID) == 0 {
+		return sd.StaticRoom{}, false
+	}
+
+	return room, true
+}
@@ -0,0 +1,48 @@
+package helpers
+
+import (
+	"log/slog"
+
+	"github.com/byuoitav/event-forwarding-microservice/cache"
+	"github.com/byuoitav/event-forwarding-microservice/metrics"
+)
+
+// sizer is implemented by caches that can count what they hold without reading every record
+type sizer interface {
+	Size() (devices, rooms int)
+}
+
+func init() {
+	metrics.CacheSizes(cacheSizes)
+}
+
+// cacheSizes counts the devices and rooms in each cache
+func cacheSizes() []metrics.CacheSize {
+	var sizes []metrics.CacheSize
+	for _, c := range cache.ListCaches() {
+		size := metrics.CacheSize{Name: c.GetCacheName()}
+
+		if s, ok := c.(sizer); ok {
+			size.Devices, size.Rooms = s.Size()
+			sizes = append(sizes, size)
+			continue
+		}
+
+		devices, err := c.GetAllDeviceRecords()
+		if err != nil {
+			slog.Warn("Couldn't count devices in cache", "cache", size.Name, "error", err)
+			continue
+		}
+
+		rooms, err := c.GetAllRoomRecords()
+		if err != nil {
+			slog.Warn("Couldn't count rooms in cache", "cache", size.Name, "error", err)
+			continue
+		}
+
+		size.Devices, size.Rooms = len(devices), len(rooms)
+		sizes = append(sizes, size)
+	}
+
+	return sizes
+}
@@ -0,0 +1,39 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/byuoitav/event-forwarding-microservice/cache"
+	"github.com/byuoitav/event-forwarding-microservice/config"
+	"github.com/byuoitav/event-forwarding-microservice/forwarding"
+)
+
+var reloadLock sync.Mutex
+
+// ReloadConfig re-reads the service config and applies it to the running forwarders and caches.
+// If the config can't be loaded or isn't valid nothing is changed.
+func ReloadConfig() error {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+
+	if shutdown {
+		return errors.New("couldn't reload config: service is shutting down")
+	}
+
+	slog.Info("Reloading config")
+
+	c, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("couldn't reload config: %w", err)
+	}
+
+	// forwarders first, so anything the caches push on a rebuild goes to the new forwarders
+	forwarding.ApplyConfig(c)
+	cache.ApplyConfig(c)
+
+	slog.Info("Config reloaded and applied")
+	return nil
+}
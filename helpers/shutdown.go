@@ -0,0 +1,58 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/byuoitav/event-forwarding-microservice/forwarding"
+)
+
+// shutdown is set once Shutdown has been called, so the config can't be reloaded into stopped forwarders
+var shutdown bool
+
+// ShutdownReport is what happened to everything the service had buffered when it shut down
+type ShutdownReport struct {
+	// events left in the event stream that never made it to a cache
+	EventsAbandoned int `json:"events-abandoned"`
+
+	// totals across every forwarder
+	Flushed   int `json:"flushed"`
+	Abandoned int `json:"abandoned"`
+
+	Forwarders map[string]forwarding.FlushResult `json:"forwarders"`
+}
+
+// Shutdown drains the event stream into the caches, then flushes and closes every forwarder.
+// Anything that hasn't been sent when ctx is done is abandoned. Intake into the event stream must be stopped before calling Shutdown.
+func Shutdown(ctx context.Context) (ShutdownReport, error) {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+	shutdown = true
+
+	var report ShutdownReport
+	var errs []error
+
+	abandoned, err := GetForwardManager().Stop(ctx)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	report.EventsAbandoned = abandoned
+
+	results, err := forwarding.Close(ctx)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	report.Forwarders = results
+
+	for name, result := range results {
+		report.Flushed += result.Flushed
+		report.Abandoned += result.Abandoned
+
+		if result.Flushed > 0 || result.Abandoned > 0 {
+			slog.Info("Flushed forwarder", "name", name, "flushed", result.Flushed, "abandoned", result.Abandoned)
+		}
+	}
+
+	return report, errors.Join(errs...)
+}
@@ -3,6 +3,7 @@ package humio
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -19,6 +20,11 @@ var (
 
 // sends a http request to humio using the given method, body, and authToken
 func MakeGenericHumioRequest(addr, method string, body interface{}, authToken string) ([]byte, error) {
+	return MakeGenericHumioRequestWithContext(context.Background(), addr, method, body, authToken)
+}
+
+// MakeGenericHumioRequestWithContext is MakeGenericHumioRequest for requests that should give up when ctx is done, e.g. while shutting down
+func MakeGenericHumioRequestWithContext(ctx context.Context, addr, method string, body interface{}, authToken string) ([]byte, error) {
 	var reqBody []byte
 	var err error
 
@@ -35,7 +41,7 @@ func MakeGenericHumioRequest(addr, method string, body interface{}, authToken st
 	}
 
 	//create the request
-	req, err := http.NewRequest(method, addr, bytes.NewReader(reqBody))
+	req, err := http.NewRequestWithContext(ctx, method, addr, bytes.NewReader(reqBody))
 	if err != nil {
 		return []byte{}, fmt.Errorf("failed to create HTTP request: %w", err)
 	}
@@ -75,11 +81,54 @@ func MakeGenericHumioRequest(addr, method string, body interface{}, authToken st
 
 // MakeHumioRequest sends an http request to humio using a direct address stored in the environment
 func MakeHumioRequest(method, endpoint string, body interface{}, authToken string) ([]byte, error) {
+	return MakeHumioRequestWithContext(context.Background(), method, endpoint, body, authToken)
+}
+
+// MakeHumioRequestWithContext is MakeHumioRequest for requests that should give up when ctx is done
+func MakeHumioRequestWithContext(ctx context.Context, method, endpoint string, body interface{}, authToken string) ([]byte, error) {
 	if len(APIAddr) == 0 {
 		slog.Error("HUMIO_DIRECT_ADDRESS is not set.")
 	}
 
 	//format whole address
 	addr := fmt.Sprintf("%s%s", APIAddr, endpoint)
-	return MakeGenericHumioRequest(addr, method, body, authToken)
+	return MakeGenericHumioRequestWithContext(ctx, addr, method, body, authToken)
+}
+
+// StructuredIngestEndpoint is the humio endpoint for ingesting structured data
+const StructuredIngestEndpoint = "/api/v1/ingest/humio-structured"
+
+// StructuredEvent is a single event in a humio structured ingest request
+type StructuredEvent struct {
+	Timestamp  string                 `json:"timestamp"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+// StructuredRequest is a group of events that share the same tags
+type StructuredRequest struct {
+	Tags   map[string]string `json:"tags,omitempty"`
+	Events []StructuredEvent `json:"events"`
+}
+
+// BulkForward sends the buffered events to humio's structured ingest endpoint using the given ingest token, giving up when ctx is done
+func BulkForward(ctx context.Context, caller, authToken string, tags map[string]string, toSend []StructuredEvent) error {
+	if len(toSend) == 0 {
+		return nil
+	}
+	slog.Info("Sending bulk humio ingest", "caller", caller, "items", len(toSend))
+
+	body := []StructuredRequest{
+		{
+			Tags:   tags,
+			Events: toSend,
+		},
+	}
+
+	_, err := MakeHumioRequestWithContext(ctx, http.MethodPost, StructuredIngestEndpoint, body, authToken)
+	if err != nil {
+		return fmt.Errorf("couldn't send bulk humio ingest for %v: %w", caller, err)
+	}
+
+	slog.Debug("Successfully sent bulk humio ingest", "caller", caller)
+	return nil
 }
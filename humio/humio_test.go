@@ -0,0 +1,58 @@
+package humio
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBulkForward(t *testing.T) {
+	var requests []*http.Request
+	var bodies [][]byte
+
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		requests = append(requests, r)
+		bodies = append(bodies, b)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	addr := APIAddr
+	APIAddr = server.URL
+	defer func() { APIAddr = addr }()
+
+	// nothing to send, so nothing is sent
+	require.NoError(t, BulkForward(context.Background(), "test", "token", nil, nil))
+	assert.Empty(t, requests)
+
+	tags := map[string]string{"data-type": "event"}
+	toSend := []StructuredEvent{
+		{Timestamp: "2024-05-01T12:00:00Z", Attributes: map[string]interface{}{"key": "power"}},
+		{Timestamp: "2024-05-01T12:00:01Z", Attributes: map[string]interface{}{"key": "input"}},
+	}
+	require.NoError(t, BulkForward(context.Background(), "test", "token", tags, toSend))
+
+	require.Len(t, requests, 1)
+	assert.Equal(t, http.MethodPost, requests[0].Method)
+	assert.Equal(t, StructuredIngestEndpoint, requests[0].URL.Path)
+	assert.Equal(t, "Bearer token", requests[0].Header.Get("Authorization"))
+	assert.Equal(t, "application/json", requests[0].Header.Get("Content-Type"))
+
+	var sent []StructuredRequest
+	require.NoError(t, json.Unmarshal(bodies[0], &sent))
+	require.Len(t, sent, 1)
+	assert.Equal(t, tags, sent[0].Tags)
+	assert.Equal(t, toSend[0].Timestamp, sent[0].Events[0].Timestamp)
+	assert.Equal(t, "input", sent[0].Events[1].Attributes["key"])
+
+	status = http.StatusUnauthorized
+	assert.Error(t, BulkForward(context.Background(), "test", "bad", tags, toSend))
+}
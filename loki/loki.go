@@ -0,0 +1,80 @@
+// The Loki package is for making final http requests to Grafana Loki
+package loki
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// PushEndpoint is the loki endpoint for pushing log lines
+const PushEndpoint = "/loki/api/v1/push"
+
+// Stream is a group of log lines that share the same labels
+type Stream struct {
+	Labels map[string]string `json:"stream"`
+
+	// each value is a timestamp, in nanoseconds since the epoch, and a line
+	Values [][2]string `json:"values"`
+}
+
+// PushRequest is the body of a push
+type PushRequest struct {
+	Streams []Stream `json:"streams"`
+}
+
+// Auth is how a push is authenticated, any of it can be empty
+type Auth struct {
+	// sent as X-Scope-OrgID to multi-tenant lokis
+	TenantID string
+	Username string
+	Password string
+}
+
+var client = http.Client{
+	Timeout: 10 * time.Second,
+}
+
+// Push sends streams to the loki at url
+func Push(url string, auth Auth, streams []Stream) error {
+	if len(streams) == 0 {
+		return nil
+	}
+	slog.Info("Sending loki push", "url", url, "streams", len(streams))
+
+	body, err := json.Marshal(PushRequest{Streams: streams})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(url, "/")+PushEndpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+
+	req.Header.Add("content-type", "application/json")
+	if len(auth.TenantID) > 0 {
+		req.Header.Add("X-Scope-OrgID", auth.TenantID)
+	}
+	if len(auth.Username) > 0 {
+		req.SetBasicAuth(auth.Username, auth.Password)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to execute HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("non 200 response code received. code: %v, body: %s", resp.StatusCode, respBody)
+	}
+
+	return nil
+}
@@ -0,0 +1,248 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	forwarderBuffered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "forwarder_buffered_total",
+		Help:      "Items added to a forwarder's buffer.",
+	}, []string{"forwarder"})
+
+	forwarderFlushed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "forwarder_flushed_total",
+		Help:      "Items a forwarder sent.",
+	}, []string{"forwarder"})
+
+	forwarderFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "forwarder_failed_total",
+		Help:      "Items a forwarder couldn't send, including anything dead lettered.",
+	}, []string{"forwarder"})
+
+	forwarderRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "forwarder_request_duration_seconds",
+		Help:      "How long it took a forwarder to send a batch, including retries.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+	}, []string{"forwarder"})
+
+	oldestUnflushedDesc = prometheus.NewDesc(namespace+"_forwarder_oldest_unflushed_seconds",
+		"Age of the oldest item a forwarder has buffered or is sending, 0 if there isn't one.", []string{"forwarder"}, nil)
+)
+
+// forwarders holds the running forwarders by name, for the oldest unflushed collector
+var (
+	forwarders     = make(map[string]*Forwarder)
+	forwardersLock sync.Mutex
+)
+
+func init() {
+	prometheus.MustRegister(oldestCollector{})
+}
+
+// Forwarder tracks what happens to the items a forwarder buffers. A nil Forwarder does nothing.
+type Forwarder struct {
+	name     string
+	buffered prometheus.Counter
+	flushed  prometheus.Counter
+	failed   prometheus.Counter
+	duration prometheus.Observer
+
+	mu        sync.Mutex
+	buffering time.Time           // when the oldest item in the buffer was added
+	batches   map[*Batch]struct{} // batches being sent
+
+	lastSuccess time.Time
+	failures    int // batches in a row where nothing was sent
+}
+
+// Status is how a forwarder's sends have been going
+type Status struct {
+	LastSuccess         time.Time `json:"last-success"`
+	ConsecutiveFailures int       `json:"consecutive-failures"`
+	OldestUnflushed     time.Time `json:"oldest-unflushed"`
+}
+
+// Batch is a buffer a forwarder has handed off to be sent
+type Batch struct {
+	f       *Forwarder
+	started time.Time // when the oldest item in the batch was buffered
+}
+
+// NewForwarder returns the tracker for the forwarder called name, replacing the one it had before
+func NewForwarder(name string) *Forwarder {
+	f := &Forwarder{
+		name:     name,
+		buffered: forwarderBuffered.WithLabelValues(name),
+		flushed:  forwarderFlushed.WithLabelValues(name),
+		failed:   forwarderFailed.WithLabelValues(name),
+		duration: forwarderRequestDuration.WithLabelValues(name),
+		batches:  make(map[*Batch]struct{}),
+	}
+
+	forwardersLock.Lock()
+	forwarders[name] = f
+	forwardersLock.Unlock()
+
+	return f
+}
+
+// RemoveForwarder stops reporting the forwarder called name
+func RemoveForwarder(name string) {
+	forwardersLock.Lock()
+	delete(forwarders, name)
+	forwardersLock.Unlock()
+
+	forwarderBuffered.DeleteLabelValues(name)
+	forwarderFlushed.DeleteLabelValues(name)
+	forwarderFailed.DeleteLabelValues(name)
+	forwarderRequestDuration.DeleteLabelValues(name)
+}
+
+// Buffered counts an item added to the buffer
+func (f *Forwarder) Buffered() {
+	if f == nil {
+		return
+	}
+
+	f.buffered.Inc()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.buffering.IsZero() {
+		f.buffering = time.Now()
+	}
+}
+
+// Take marks everything buffered so far as handed off to be sent, call Done on the batch once it has been
+func (f *Forwarder) Take() *Batch {
+	if f == nil {
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	b := &Batch{f: f, started: f.buffering}
+	f.buffering = time.Time{}
+
+	if !b.started.IsZero() {
+		f.batches[b] = struct{}{}
+	}
+
+	return b
+}
+
+// Observe records how long a request that started at start took
+func (f *Forwarder) Observe(start time.Time) {
+	if f == nil {
+		return
+	}
+
+	f.duration.Observe(time.Since(start).Seconds())
+}
+
+// Oldest returns when the oldest item that hasn't been sent was buffered, or the zero time if everything has been
+func (f *Forwarder) Oldest() time.Time {
+	if f == nil {
+		return time.Time{}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	oldest := f.buffering
+	for b := range f.batches {
+		if oldest.IsZero() || b.started.Before(oldest) {
+			oldest = b.started
+		}
+	}
+
+	return oldest
+}
+
+// Status returns how the forwarder's sends have been going
+func (f *Forwarder) Status() Status {
+	if f == nil {
+		return Status{}
+	}
+
+	oldest := f.Oldest()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return Status{
+		LastSuccess:         f.lastSuccess,
+		ConsecutiveFailures: f.failures,
+		OldestUnflushed:     oldest,
+	}
+}
+
+// Statuses returns the status of each forwarder by name
+func Statuses() map[string]Status {
+	forwardersLock.Lock()
+	defer forwardersLock.Unlock()
+
+	toReturn := make(map[string]Status, len(forwarders))
+	for name, f := range forwarders {
+		toReturn[name] = f.Status()
+	}
+	return toReturn
+}
+
+// Done counts how many items in the batch were sent and how many failed.
+// A batch where nothing was sent counts as a failure, unless it was empty.
+func (b *Batch) Done(flushed, failed int) {
+	if b == nil {
+		return
+	}
+
+	b.f.flushed.Add(float64(flushed))
+	b.f.failed.Add(float64(failed))
+
+	b.f.mu.Lock()
+	defer b.f.mu.Unlock()
+
+	delete(b.f.batches, b)
+
+	switch {
+	case flushed > 0:
+		b.f.lastSuccess = time.Now()
+		b.f.failures = 0
+	case failed > 0:
+		b.f.failures++
+	}
+}
+
+// oldestCollector reports the oldest unflushed item of each forwarder when it's scraped
+type oldestCollector struct{}
+
+// Describe .
+func (oldestCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- oldestUnflushedDesc
+}
+
+// Collect .
+func (oldestCollector) Collect(ch chan<- prometheus.Metric) {
+	forwardersLock.Lock()
+	defer forwardersLock.Unlock()
+
+	for name, f := range forwarders {
+		var age float64
+		if oldest := f.Oldest(); !oldest.IsZero() {
+			age = time.Since(oldest).Seconds()
+		}
+
+		ch <- prometheus.MustNewConstMetric(oldestUnflushedDesc, prometheus.GaugeValue, age, name)
+	}
+}
@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForwarder(t *testing.T) {
+	f := NewForwarder("test")
+	defer RemoveForwarder("test")
+
+	assert.True(t, f.Oldest().IsZero())
+
+	f.Buffered()
+	first := f.Oldest()
+	assert.False(t, first.IsZero())
+
+	f.Buffered()
+	assert.Equal(t, first, f.Oldest(), "the oldest item should stay the oldest")
+
+	// items buffered while the first batch is being sent are newer
+	b := f.Take()
+	time.Sleep(time.Millisecond)
+	f.Buffered()
+	assert.Equal(t, first, f.Oldest())
+
+	b.Done(1, 1)
+	assert.True(t, f.Oldest().After(first))
+	assert.False(t, f.Status().LastSuccess.IsZero())
+
+	f.Take().Done(1, 0)
+	assert.True(t, f.Oldest().IsZero())
+
+	assert.Equal(t, 3.0, testutil.ToFloat64(forwarderBuffered.WithLabelValues("test")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(forwarderFlushed.WithLabelValues("test")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(forwarderFailed.WithLabelValues("test")))
+
+	// an empty buffer doesn't make a batch that's waiting to be sent
+	f.Take()
+	assert.True(t, f.Oldest().IsZero())
+
+	f.Take().Done(0, 2)
+	f.Take().Done(0, 0)
+	f.Take().Done(0, 1)
+	assert.Equal(t, 2, Statuses()["test"].ConsecutiveFailures)
+
+	f.Take().Done(1, 0)
+	assert.Zero(t, Statuses()["test"].ConsecutiveFailures)
+}
+
+func TestNilForwarder(t *testing.T) {
+	var f *Forwarder
+	f.Buffered()
+	f.Observe(time.Now())
+	f.Take().Done(1, 0)
+	assert.True(t, f.Oldest().IsZero())
+}
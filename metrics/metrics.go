@@ -0,0 +1,88 @@
+// Package metrics exposes what the service is doing to prometheus.
+package metrics
+
+import (
+	"github.com/byuoitav/event-forwarding-microservice/events"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "event_forwarding"
+
+var (
+	eventsReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_received_total",
+		Help:      "Events received from the hub, by tag. Events without tags are counted as none.",
+	}, []string{"tag"})
+
+	stateChanges = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "state_changes_total",
+		Help:      "Events that changed a device in a cache, by field.",
+	}, []string{"cache", "field"})
+)
+
+// EventReceived counts an event from the hub once for each of its tags
+func EventReceived(event events.Event) {
+	if len(event.EventTags) == 0 {
+		eventsReceived.WithLabelValues("none").Inc()
+		return
+	}
+
+	for _, tag := range event.EventTags {
+		eventsReceived.WithLabelValues(tag).Inc()
+	}
+}
+
+// StateChanged counts a change to field on a device in cache
+func StateChanged(cache, field string) {
+	stateChanges.WithLabelValues(cache, field).Inc()
+}
+
+// EventStreamDepth reports depth as the number of events waiting to be processed. Call it once.
+func EventStreamDepth(depth func() int) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "event_stream_depth",
+		Help:      "Events waiting in the event stream to be processed.",
+	}, func() float64 {
+		return float64(depth())
+	})
+}
+
+// CacheSize is how many devices and rooms are in a cache
+type CacheSize struct {
+	Name    string
+	Devices int
+	Rooms   int
+}
+
+// CacheSizes reports the size of each cache returned by sizes. Call it once.
+func CacheSizes(sizes func() []CacheSize) {
+	prometheus.MustRegister(cacheCollector{sizes: sizes})
+}
+
+var (
+	cacheDevicesDesc = prometheus.NewDesc(namespace+"_cache_devices", "Devices in the cache.", []string{"cache"}, nil)
+	cacheRoomsDesc   = prometheus.NewDesc(namespace+"_cache_rooms", "Rooms in the cache.", []string{"cache"}, nil)
+)
+
+// cacheCollector sizes the caches when it's scraped
+type cacheCollector struct {
+	sizes func() []CacheSize
+}
+
+// Describe .
+func (c cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cacheDevicesDesc
+	ch <- cacheRoomsDesc
+}
+
+// Collect .
+func (c cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, s := range c.sizes() {
+		ch <- prometheus.MustNewConstMetric(cacheDevicesDesc, prometheus.GaugeValue, float64(s.Devices), s.Name)
+		ch <- prometheus.MustNewConstMetric(cacheRoomsDesc, prometheus.GaugeValue, float64(s.Rooms), s.Name)
+	}
+}
@@ -0,0 +1,169 @@
+package replay
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/byuoitav/event-forwarding-microservice/cache/shared"
+	"github.com/byuoitav/event-forwarding-microservice/config"
+	"github.com/byuoitav/event-forwarding-microservice/events"
+	sd "github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
+)
+
+// DeviceChange is what replaying would change about a device
+type DeviceChange struct {
+	DeviceID string `json:"deviceID"`
+
+	// the device isn't in the cache yet
+	New bool `json:"new,omitempty"`
+
+	// the fields that would change, and how many events would change them
+	Fields []string `json:"fields"`
+	Events int      `json:"events"`
+}
+
+/*
+DryRun works out what replaying events would change about the devices in a cache, without changing the cache or forwarding anything.
+Its Send is used in place of a real one, and events are applied the same way the cache applies them, to copies of the devices.
+Changes to rooms derived from their devices aren't included.
+*/
+type DryRun struct {
+	cache shared.Cache
+
+	mu      sync.Mutex
+	devices map[string]sd.StaticDevice
+	changes map[string]*DeviceChange
+}
+
+// NewDryRun returns a DryRun against c
+func NewDryRun(c shared.Cache) *DryRun {
+	return &DryRun{
+		cache:   c,
+		devices: make(map[string]sd.StaticDevice),
+		changes: make(map[string]*DeviceChange),
+	}
+}
+
+// Send applies event to the copies of the devices it would change
+func (d *DryRun) Send(event events.Event) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// events from a device count as a heartbeat from it
+	if len(event.GeneratingSystem) > 0 && !events.ContainsAnyTags(event, events.Heartbeat) && len(strings.Split(event.GeneratingSystem, "-")) >= 3 {
+		err := d.apply(sd.State{
+			ID:    event.GeneratingSystem,
+			Key:   "auto-heartbeat",
+			Time:  event.Timestamp,
+			Value: "ok",
+			Tags:  []string{events.Heartbeat},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// the cache only keeps state
+	if !events.ContainsAnyTags(event, events.CoreState, events.DetailState, events.Heartbeat) {
+		return nil
+	}
+
+	return d.apply(sd.State{
+		ID:    event.TargetDevice.DeviceID,
+		Key:   event.Key,
+		Time:  event.Timestamp,
+		Value: event.Value,
+		Tags:  event.EventTags,
+	})
+}
+
+// apply edits the copy of the device that state is for, recording the field if it changed
+// must hold mu
+func (d *DryRun) apply(state sd.State) error {
+	device, isNew, err := d.device(state.ID)
+	if err != nil {
+		return err
+	}
+
+	device, changed, err := shared.EditDeviceFromEvent(state, device)
+	if err != nil {
+		return fmt.Errorf("couldn't apply %v to %v: %w", state.Key, state.ID, err)
+	}
+	d.devices[state.ID] = device
+
+	if !changed && !isNew {
+		return nil
+	}
+
+	change, ok := d.changes[state.ID]
+	if !ok {
+		change = &DeviceChange{DeviceID: state.ID, New: isNew}
+		d.changes[state.ID] = change
+	}
+
+	field := state.Key
+	if shared.HasTag(events.Heartbeat, state.Tags) || state.Key == "responsive" {
+		field = "last-heartbeat"
+	}
+	if changed && !config.Contains(change.Fields, field) {
+		change.Fields = append(change.Fields, field)
+	}
+	change.Events++
+
+	return nil
+}
+
+// device returns the copy of the device with id, and whether it's new to the cache
+// must hold mu
+func (d *DryRun) device(id string) (sd.StaticDevice, bool, error) {
+	if device, ok := d.devices[id]; ok {
+		change, ok := d.changes[id]
+		return device, ok && change.New, nil
+	}
+
+	device, err := d.cache.GetDeviceRecord(id)
+	if err != nil {
+		return sd.StaticDevice{}, false, fmt.Errorf("couldn't get %v from the cache: %w", id, err)
+	}
+
+	if len(device.DeviceID) == 0 {
+		device, err = shared.GetNewDevice(id)
+		return device, true, err
+	}
+
+	// the cache's device can share maps with what's stored, so edit a copy
+	b, err := json.Marshal(device)
+	if err != nil {
+		return sd.StaticDevice{}, false, fmt.Errorf("couldn't copy %v: %w", id, err)
+	}
+
+	var copied sd.StaticDevice
+	if err := json.Unmarshal(b, &copied); err != nil {
+		return sd.StaticDevice{}, false, fmt.Errorf("couldn't copy %v: %w", id, err)
+	}
+
+	return copied, false, nil
+}
+
+// Changes returns what would change about each device, by device ID
+func (d *DryRun) Changes() []DeviceChange {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	toReturn := make([]DeviceChange, 0, len(d.changes))
+	for _, change := range d.changes {
+		c := *change
+		c.Fields = append([]string{}, change.Fields...)
+		sort.Strings(c.Fields)
+		toReturn = append(toReturn, c)
+	}
+
+	sort.Slice(toReturn, func(i, j int) bool {
+		return toReturn[i].DeviceID < toReturn[j].DeviceID
+	})
+
+	return toReturn
+}
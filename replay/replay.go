@@ -0,0 +1,204 @@
+// The Replay package is for feeding archived events back through the service
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/byuoitav/event-forwarding-microservice/events"
+)
+
+// maxLineSize is the longest line Run will read
+const maxLineSize = 16 * 1024 * 1024
+
+// Options controls which events are replayed and how fast
+type Options struct {
+	// only events at or after From and before To are replayed, either can be zero to leave that end open
+	From time.Time
+	To   time.Time
+
+	// most events to replay a second, 0 is unlimited
+	Rate float64
+}
+
+// Report is what happened to the lines that were read
+type Report struct {
+	Read     int `json:"read"`
+	Replayed int `json:"replayed"`
+
+	// outside the time range
+	Skipped int `json:"skipped"`
+
+	// lines that weren't events
+	Invalid int `json:"invalid"`
+
+	// events send returned an error for
+	Failed int `json:"failed"`
+}
+
+// Open opens the newline delimited json at path for Run, or stdin if path is -. Gzipped files are decompressed.
+func Open(path string) (io.ReadCloser, error) {
+	var f io.ReadCloser = os.Stdin
+	if path != "-" {
+		var err error
+		f, err = os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	r := bufio.NewReader(f)
+	magic, _ := r.Peek(2)
+	if !bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		return readCloser{Reader: r, Closer: f}, nil
+	}
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("couldn't decompress %v: %w", path, err)
+	}
+
+	return readCloser{Reader: gz, Closer: closers{gz, f}}, nil
+}
+
+/*
+Run reads newline delimited json events from each source in order and calls send with each one in the time range, no faster than opts.Rate.
+Lines can be events, like the file forwarder writes, or documents from an ELK export with the event in _source.
+
+Lines that can't be read and events send fails for are counted in the report and skipped. Run stops early if ctx is done or a source can't be read.
+*/
+func Run(ctx context.Context, sources []io.Reader, opts Options, send func(events.Event) error) (Report, error) {
+	var report Report
+	var next time.Time
+	interval := time.Duration(0)
+	if opts.Rate > 0 {
+		interval = time.Duration(float64(time.Second) / opts.Rate)
+	}
+
+	for i, source := range sources {
+		scanner := bufio.NewScanner(source)
+		scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+
+		line := 0
+		for scanner.Scan() {
+			line++
+			if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+				continue
+			}
+			report.Read++
+
+			event, err := decode(scanner.Bytes())
+			if err != nil {
+				slog.Debug("Skipping line that isn't an event", "source", i, "line", line, "error", err)
+				report.Invalid++
+				continue
+			}
+
+			if !inRange(event.Timestamp, opts) {
+				report.Skipped++
+				continue
+			}
+
+			if interval > 0 {
+				if err := wait(ctx, next); err != nil {
+					return report, err
+				}
+				next = time.Now().Add(interval)
+			} else if err := ctx.Err(); err != nil {
+				return report, err
+			}
+
+			if err := send(event); err != nil {
+				slog.Warn("Couldn't replay event", "source", i, "line", line, "error", err)
+				report.Failed++
+				continue
+			}
+			report.Replayed++
+		}
+
+		if err := scanner.Err(); err != nil {
+			return report, fmt.Errorf("couldn't read source %v at line %v: %w", i, line+1, err)
+		}
+	}
+
+	return report, nil
+}
+
+// decode reads an event from a line, which is either the event or an ELK document with the event in _source
+func decode(line []byte) (events.Event, error) {
+	var doc struct {
+		Source json.RawMessage `json:"_source"`
+	}
+	if err := json.Unmarshal(line, &doc); err != nil {
+		return events.Event{}, err
+	}
+
+	if len(doc.Source) > 0 {
+		line = doc.Source
+	}
+
+	var event events.Event
+	if err := json.Unmarshal(line, &event); err != nil {
+		return events.Event{}, err
+	}
+
+	if len(event.Key) == 0 {
+		return events.Event{}, errors.New("event has no key")
+	}
+
+	return event, nil
+}
+
+func inRange(t time.Time, opts Options) bool {
+	if !opts.From.IsZero() && t.Before(opts.From) {
+		return false
+	}
+	if !opts.To.IsZero() && !t.Before(opts.To) {
+		return false
+	}
+	return true
+}
+
+// wait blocks until until, or ctx is done
+func wait(ctx context.Context, until time.Time) error {
+	d := time.Until(until)
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// closers closes each of its closers in order
+type closers []io.Closer
+
+func (c closers) Close() error {
+	var errs []error
+	for i := range c {
+		errs = append(errs, c[i].Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,179 @@
+package replay
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/byuoitav/event-forwarding-microservice/cache/memorycache"
+	"github.com/byuoitav/event-forwarding-microservice/config"
+	"github.com/byuoitav/event-forwarding-microservice/events"
+	sd "github.com/byuoitav/event-forwarding-microservice/state/statedefinition"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const archive = `{"key": "power", "value": "on", "timestamp": "2024-05-01T10:00:00Z", "target-device": {"deviceID": "ITB-1101-D1"}}
+not json
+
+{"_index": "av-events-20240501", "_source": {"key": "input", "value": "hdmi1", "timestamp": "2024-05-01T11:00:00Z", "target-device": {"deviceID": "ITB-1101-D1"}}}
+{"value": "no key", "timestamp": "2024-05-01T11:30:00Z"}
+{"key": "power", "value": "standby", "timestamp": "2024-05-02T10:00:00Z", "target-device": {"deviceID": "ITB-1101-D1"}}
+`
+
+func collect(t *testing.T, opts Options, sources ...string) ([]events.Event, Report) {
+	var readers []io.Reader
+	for _, source := range sources {
+		readers = append(readers, strings.NewReader(source))
+	}
+
+	var sent []events.Event
+	report, err := Run(context.Background(), readers, opts, func(event events.Event) error {
+		sent = append(sent, event)
+		return nil
+	})
+	require.NoError(t, err)
+
+	return sent, report
+}
+
+func TestRun(t *testing.T) {
+	sent, report := collect(t, Options{}, archive)
+
+	assert.Equal(t, Report{Read: 5, Replayed: 3, Invalid: 2}, report)
+	require.Len(t, sent, 3)
+	assert.Equal(t, "on", sent[0].Value)
+	assert.Equal(t, "hdmi1", sent[1].Value)
+	assert.Equal(t, "ITB-1101-D1", sent[1].TargetDevice.DeviceID)
+	assert.Equal(t, "standby", sent[2].Value)
+}
+
+func TestRunTimeRange(t *testing.T) {
+	sent, report := collect(t, Options{
+		From: time.Date(2024, 5, 1, 11, 0, 0, 0, time.UTC),
+		To:   time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC),
+	}, archive)
+
+	// from is inclusive, to isn't
+	assert.Equal(t, Report{Read: 5, Replayed: 1, Skipped: 2, Invalid: 2}, report)
+	require.Len(t, sent, 1)
+	assert.Equal(t, "hdmi1", sent[0].Value)
+}
+
+func TestRunFailures(t *testing.T) {
+	report, err := Run(context.Background(), []io.Reader{strings.NewReader(archive)}, Options{}, func(event events.Event) error {
+		if event.Value == "hdmi1" {
+			return errors.New("nope")
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, Report{Read: 5, Replayed: 2, Invalid: 2, Failed: 1}, report)
+}
+
+func TestRunRate(t *testing.T) {
+	start := time.Now()
+	sent, _ := collect(t, Options{Rate: 20}, archive, archive)
+	assert.Len(t, sent, 6)
+
+	// the first one goes right away
+	assert.GreaterOrEqual(t, time.Since(start), 5*50*time.Millisecond)
+}
+
+func TestRunCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	report, err := Run(ctx, []io.Reader{strings.NewReader(archive)}, Options{Rate: 1}, func(events.Event) error {
+		cancel()
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, report.Replayed)
+}
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+
+	plain := filepath.Join(dir, "av-events-20240501.jsonl")
+	require.NoError(t, os.WriteFile(plain, []byte(archive), 0644))
+
+	compressed := filepath.Join(dir, "av-events-20240502.jsonl.gz")
+	f, err := os.Create(compressed)
+	require.NoError(t, err)
+	gz := gzip.NewWriter(f)
+	_, err = gz.Write([]byte(archive))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	require.NoError(t, f.Close())
+
+	var sources []io.Reader
+	for _, path := range []string{plain, compressed} {
+		source, err := Open(path)
+		require.NoError(t, err)
+		defer source.Close()
+
+		sources = append(sources, source)
+	}
+
+	report, err := Run(context.Background(), sources, Options{}, func(events.Event) error { return nil })
+	require.NoError(t, err)
+	assert.Equal(t, Report{Read: 10, Replayed: 6, Invalid: 4}, report)
+
+	_, err = Open(filepath.Join(dir, "missing.jsonl"))
+	assert.Error(t, err)
+}
+
+func TestDryRun(t *testing.T) {
+	c, err := memorycache.MakeMemoryCache([]sd.StaticDevice{{DeviceID: "ITB-1101-D1", Power: "on"}}, nil, "0 0 0 * * *", config.Cache{Name: "test"})
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+
+	d := NewDryRun(c)
+	ts := time.Now()
+	send := func(device, key, value string, tags ...string) {
+		info := events.GenerateBasicDeviceInfo(device)
+		require.NoError(t, d.Send(events.Event{
+			Timestamp:    ts,
+			EventTags:    tags,
+			TargetDevice: info,
+			AffectedRoom: info.BasicRoomInfo,
+			Key:          key,
+			Value:        value,
+		}))
+		ts = ts.Add(time.Second)
+	}
+
+	send("ITB-1101-D1", "power", "on", events.CoreState)
+	send("ITB-1101-D1", "input", "hdmi1", events.CoreState)
+	send("ITB-1101-D1", "power", "standby", events.CoreState)
+	send("ITB-1101-D2", "volume", "30", events.CoreState)
+	send("ITB-1101-D3", "button-press", "power", events.UserGenerated)
+
+	changes := d.Changes()
+	require.Len(t, changes, 2)
+
+	assert.Equal(t, "ITB-1101-D1", changes[0].DeviceID)
+	assert.False(t, changes[0].New)
+	assert.Equal(t, []string{"input", "power"}, changes[0].Fields)
+	assert.Equal(t, 2, changes[0].Events)
+
+	assert.Equal(t, "ITB-1101-D2", changes[1].DeviceID)
+	assert.True(t, changes[1].New)
+	assert.Equal(t, []string{"volume"}, changes[1].Fields)
+
+	// the cache is left alone
+	device, err := c.GetDeviceRecord("ITB-1101-D1")
+	require.NoError(t, err)
+	assert.Equal(t, "on", device.Power)
+	assert.Empty(t, device.Input)
+
+	device, err = c.GetDeviceRecord("ITB-1101-D2")
+	require.NoError(t, err)
+	assert.Empty(t, device.DeviceID)
+}
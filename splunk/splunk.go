@@ -0,0 +1,78 @@
+// The Splunk package is for making final http requests to a Splunk HTTP Event Collector
+package splunk
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// EventEndpoint is the HTTP Event Collector endpoint for JSON events
+const EventEndpoint = "/services/collector/event"
+
+// Event is a single event in an HTTP Event Collector request
+type Event struct {
+	// seconds since the epoch
+	Time       float64                `json:"time"`
+	Host       string                 `json:"host,omitempty"`
+	Source     string                 `json:"source,omitempty"`
+	SourceType string                 `json:"sourcetype,omitempty"`
+	Index      string                 `json:"index,omitempty"`
+	Event      map[string]interface{} `json:"event"`
+}
+
+// Time converts t to the seconds since the epoch, to the millisecond, that the HTTP Event Collector expects
+func Time(t time.Time) float64 {
+	return float64(t.UnixMilli()) / 1000
+}
+
+var client = http.Client{
+	Timeout: 10 * time.Second,
+}
+
+// BulkForward sends the buffered events to the HTTP Event Collector at url using the given token
+func BulkForward(url, token string, toSend []Event) error {
+	if len(toSend) == 0 {
+		return nil
+	}
+	slog.Info("Sending bulk splunk update", "url", url, "items", len(toSend))
+
+	// the collector takes events one after another, not in an array
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for i := range toSend {
+		if err := enc.Encode(toSend[i]); err != nil {
+			return fmt.Errorf("failed to marshal event: %w", err)
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(url, "/")+EventEndpoint, &body)
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+
+	req.Header.Add("content-type", "application/json")
+	req.Header.Add("Authorization", fmt.Sprintf("Splunk %s", token))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to execute HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("non 200 response code received. code: %v, body: %s", resp.StatusCode, respBody)
+	}
+
+	return nil
+}
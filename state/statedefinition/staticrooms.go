@@ -36,6 +36,11 @@ type StaticRoom struct {
 
 	Tags []string `json:"tags,omitempty"`
 
+	//Derived from the events in the room and its devices
+	LastActivity time.Time `json:"last-activity,omitempty"` //when the last event that wasn't a heartbeat happened in the room
+	DeviceCount  *int      `json:"device-count,omitempty"`
+	Alerting     *bool     `json:"alerting,omitempty"` //if any of the room's devices are alerting
+
 	UpdateTimes map[string]time.Time `json:"update-times"`
 
 	AlertsToSupress []string `json:"alerts-to-supress"`
@@ -70,17 +75,76 @@ func CompareRooms(base, new StaticRoom) (diff, merged StaticRoom, changes bool,
 	}
 
 	//time fields
-	if new.UpdateTimes["maintenence-mode-until"].After(base.UpdateTimes["maintenence-mode-until"]) {
-		diff.MaintenenceModeEndTime, merged.MaintenenceModeEndTime, changes = compareTime(base.MaintenenceModeEndTime, new.MaintenenceModeEndTime, changes)
+	//the end time is set along with maintenance mode, so a zero end time clears it instead of being ignored
+	if new.UpdateTimes["maintenence-mode-until"].After(base.UpdateTimes["maintenence-mode-until"]) && !new.MaintenenceModeEndTime.Equal(base.MaintenenceModeEndTime) {
+		diff.MaintenenceModeEndTime, merged.MaintenenceModeEndTime, changes = new.MaintenenceModeEndTime, new.MaintenenceModeEndTime, true
 	}
 
 	if new.UpdateTimes["tags"].After(base.UpdateTimes["tags"]) {
 		diff.Tags, merged.Tags, changes = compareTags(base.Tags, new.Tags, changes)
 	}
+	if new.UpdateTimes["alerts-to-supress"].After(base.UpdateTimes["alerts-to-supress"]) {
+		diff.AlertsToSupress, merged.AlertsToSupress, changes = compareTags(base.AlertsToSupress, new.AlertsToSupress, changes)
+	}
+
+	//derived fields
+	if new.UpdateTimes["last-activity"].After(base.UpdateTimes["last-activity"]) {
+		diff.LastActivity, merged.LastActivity, changes = compareTime(base.LastActivity, new.LastActivity, changes)
+	}
+	if new.UpdateTimes["device-count"].After(base.UpdateTimes["device-count"]) {
+		diff.DeviceCount, merged.DeviceCount, changes = compareInt(base.DeviceCount, new.DeviceCount, changes)
+	}
+	if new.UpdateTimes["alerting"].After(base.UpdateTimes["alerting"]) {
+		diff.Alerting, merged.Alerting, changes = compareBool(base.Alerting, new.Alerting, changes)
+	}
+
+	//keep the latest update time of each field, so older updates don't overwrite newer ones
+	merged.UpdateTimes = make(map[string]time.Time, len(base.UpdateTimes))
+	for k, v := range base.UpdateTimes {
+		merged.UpdateTimes[k] = v
+	}
+	for k, v := range new.UpdateTimes {
+		if v.After(merged.UpdateTimes[k]) {
+			merged.UpdateTimes[k] = v
+		}
+	}
 
 	return
 }
 
+// InMaintenance returns true if the room is in maintenance mode at now. Maintenance mode with an end time is over once it passes.
+func (r *StaticRoom) InMaintenance(now time.Time) bool {
+	if r.MaintenenceMode == nil || !*r.MaintenenceMode {
+		return false
+	}
+
+	return r.MaintenenceModeEndTime.IsZero() || now.Before(r.MaintenenceModeEndTime)
+}
+
+// MaintenanceExpired returns true if the room is still marked as in maintenance mode, but its end time has passed
+func (r *StaticRoom) MaintenanceExpired(now time.Time) bool {
+	if r.MaintenenceMode == nil || !*r.MaintenenceMode {
+		return false
+	}
+
+	return !r.MaintenenceModeEndTime.IsZero() && !now.Before(r.MaintenenceModeEndTime)
+}
+
+// SuppressesAlert returns true if alerts called name are masked on the room's devices at now,
+// either because the room is in maintenance mode or the alert is in AlertsToSupress
+func (r *StaticRoom) SuppressesAlert(name string, now time.Time) bool {
+	if r.InMaintenance(now) {
+		return true
+	}
+
+	for i := range r.AlertsToSupress {
+		if r.AlertsToSupress[i] == name {
+			return true
+		}
+	}
+	return false
+}
+
 func (r *StaticRoom) HasSystemType(s string) bool {
 	for i := range r.SystemType {
 		if r.SystemType[i] == s {
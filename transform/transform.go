@@ -0,0 +1,276 @@
+// Package transform reshapes documents before a forwarder sends them.
+package transform
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Step changes a document in place
+type Step func(doc map[string]interface{}) error
+
+// Chain is a list of steps applied in order
+type Chain []Step
+
+// Apply converts item to a generic document and runs it through each step in the chain
+func (c Chain) Apply(item interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(item)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't marshal document: %w", err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var doc map[string]interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("couldn't unmarshal document: %w", err)
+	}
+
+	if doc == nil {
+		doc = make(map[string]interface{})
+	}
+
+	for _, step := range c {
+		if err := step(doc); err != nil {
+			return nil, err
+		}
+	}
+
+	return doc, nil
+}
+
+// Drop removes fields
+func Drop(fields ...string) Step {
+	return func(doc map[string]interface{}) error {
+		for _, f := range fields {
+			remove(doc, f)
+		}
+		return nil
+	}
+}
+
+// Rename moves fields, from the key to the value of renames
+func Rename(renames map[string]string) Step {
+	// apply them in a consistent order
+	from := make([]string, 0, len(renames))
+	for f := range renames {
+		from = append(from, f)
+	}
+	sort.Strings(from)
+
+	return func(doc map[string]interface{}) error {
+		for _, f := range from {
+			v, ok := Get(doc, f)
+			if !ok {
+				continue
+			}
+
+			remove(doc, f)
+			set(doc, renames[f], v)
+		}
+		return nil
+	}
+}
+
+// Redact replaces the value of fields with replacement, or with a hash of the value if hash is true.
+// Hashing keeps values that were the same the same, so they can still be counted.
+func Redact(fields []string, replacement string, hash bool) Step {
+	return func(doc map[string]interface{}) error {
+		for _, f := range fields {
+			v, ok := Get(doc, f)
+			if !ok || v == nil || v == "" {
+				continue
+			}
+
+			if hash {
+				sum := sha256.Sum256([]byte(fmt.Sprint(v)))
+				set(doc, f, hex.EncodeToString(sum[:]))
+				continue
+			}
+
+			set(doc, f, replacement)
+		}
+		return nil
+	}
+}
+
+// Flatten replaces objects in fields with a top level key for each value in them, named field<separator>key
+func Flatten(fields []string, separator string) Step {
+	return func(doc map[string]interface{}) error {
+		for _, f := range fields {
+			v, ok := Get(doc, f)
+			if !ok {
+				continue
+			}
+
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			remove(doc, f)
+			flatten(doc, f, obj, separator)
+		}
+		return nil
+	}
+}
+
+func flatten(doc map[string]interface{}, prefix string, obj map[string]interface{}, separator string) {
+	for k, v := range obj {
+		key := prefix + separator + k
+		if nested, ok := v.(map[string]interface{}); ok {
+			flatten(doc, key, nested, separator)
+			continue
+		}
+
+		doc[key] = v
+	}
+}
+
+// Add sets static values, overwriting anything already there
+func Add(values map[string]interface{}) Step {
+	return func(doc map[string]interface{}) error {
+		for f, v := range values {
+			set(doc, f, v)
+		}
+		return nil
+	}
+}
+
+// Derive sets field to the result of fn on the string value of from. Nothing is set if from is missing or fn returns an empty string.
+func Derive(field, from string, fn func(string) string) Step {
+	return func(doc map[string]interface{}) error {
+		v, ok := Get(doc, from)
+		if !ok {
+			return nil
+		}
+
+		s, ok := v.(string)
+		if !ok || len(s) == 0 {
+			return nil
+		}
+
+		if derived := fn(s); len(derived) > 0 {
+			set(doc, field, derived)
+		}
+		return nil
+	}
+}
+
+// BuildingFromID returns the building from a room or device ID (e.g. ITB from ITB-1101-CP1)
+func BuildingFromID(id string) string {
+	split := strings.Split(id, "-")
+	if len(split) < 2 {
+		return ""
+	}
+	return split[0]
+}
+
+// RoomFromID returns the room from a device ID (e.g. ITB-1101 from ITB-1101-CP1)
+func RoomFromID(id string) string {
+	split := strings.Split(id, "-")
+	if len(split) != 3 {
+		return ""
+	}
+	return split[0] + "-" + split[1]
+}
+
+// ElkSanitize fixes documents that ELK would reject: a data field that isn't an object is wrapped in one,
+// and empty field names are replaced with AutoGenerated
+func ElkSanitize() Step {
+	return func(doc map[string]interface{}) error {
+		if data, ok := doc["data"]; ok {
+			switch data.(type) {
+			case []interface{}:
+				doc["data"] = map[string]interface{}{
+					"values": data,
+				}
+			case nil:
+				doc["data"] = map[string]interface{}{}
+			}
+		}
+
+		fixEmptyKeys(doc)
+		return nil
+	}
+}
+
+func fixEmptyKeys(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if empty, ok := v[""]; ok {
+			delete(v, "")
+			v["AutoGenerated"] = empty
+		}
+
+		for _, val := range v {
+			fixEmptyKeys(val)
+		}
+	case []interface{}:
+		for _, val := range v {
+			fixEmptyKeys(val)
+		}
+	}
+}
+
+// Get returns the value at a dotted path, e.g. target-device.deviceID
+func Get(doc map[string]interface{}, path string) (interface{}, bool) {
+	parts := strings.Split(path, ".")
+
+	cur := doc
+	for i, p := range parts {
+		v, ok := cur[p]
+		if !ok {
+			return nil, false
+		}
+
+		if i == len(parts)-1 {
+			return v, true
+		}
+
+		if cur, ok = v.(map[string]interface{}); !ok {
+			return nil, false
+		}
+	}
+
+	return nil, false
+}
+
+// set sets the value at a dotted path, creating objects along the way
+func set(doc map[string]interface{}, path string, val interface{}) {
+	parts := strings.Split(path, ".")
+
+	cur := doc
+	for _, p := range parts[:len(parts)-1] {
+		next, ok := cur[p].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			cur[p] = next
+		}
+		cur = next
+	}
+
+	cur[parts[len(parts)-1]] = val
+}
+
+// remove deletes the value at a dotted path
+func remove(doc map[string]interface{}, path string) {
+	parts := strings.Split(path, ".")
+
+	cur := doc
+	for _, p := range parts[:len(parts)-1] {
+		next, ok := cur[p].(map[string]interface{})
+		if !ok {
+			return
+		}
+		cur = next
+	}
+
+	delete(cur, parts[len(parts)-1])
+}
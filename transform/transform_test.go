@@ -0,0 +1,103 @@
+package transform
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/byuoitav/event-forwarding-microservice/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChain(t *testing.T) {
+	event := events.Event{
+		GeneratingSystem: "ITB-1101-CP1",
+		Timestamp:        time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		EventTags:        []string{events.UserGenerated},
+		TargetDevice:     events.GenerateBasicDeviceInfo("ITB-1101-D1"),
+		AffectedRoom:     events.GenerateBasicRoomInfo("ITB-1101"),
+		Key:              "power",
+		Value:            "on",
+		User:             "jdoe",
+		Data: map[string]interface{}{
+			"input": map[string]interface{}{"name": "hdmi1", "port": 1},
+		},
+	}
+
+	chain := Chain{
+		Drop("event-tags", "target-device.buildingID"),
+		Rename(map[string]string{"key": "field", "value": "field-value"}),
+		Redact([]string{"user"}, "REDACTED", false),
+		Flatten([]string{"data"}, "_"),
+		Add(map[string]interface{}{"environment": "production", "meta.source": "test"}),
+		Derive("device-type", "target-device.deviceID", func(id string) string { return "display" }),
+		Derive("building", "target-device.deviceID", BuildingFromID),
+	}
+
+	doc, err := chain.Apply(event)
+	require.NoError(t, err)
+
+	b, err := json.Marshal(doc)
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `{
+		"generating-system": "ITB-1101-CP1",
+		"timestamp": "2024-01-02T03:04:05Z",
+		"target-device": {"roomID": "ITB-1101", "deviceID": "ITB-1101-D1"},
+		"affected-room": {"buildingID": "ITB", "roomID": "ITB-1101"},
+		"field": "power",
+		"field-value": "on",
+		"user": "REDACTED",
+		"data_input_name": "hdmi1",
+		"data_input_port": 1,
+		"environment": "production",
+		"meta": {"source": "test"},
+		"device-type": "display",
+		"building": "ITB"
+	}`, string(b))
+}
+
+func TestRedactHash(t *testing.T) {
+	chain := Chain{Redact([]string{"user"}, "", true)}
+
+	a, err := chain.Apply(events.Event{User: "jdoe"})
+	require.NoError(t, err)
+	b, err := chain.Apply(events.Event{User: "jdoe"})
+	require.NoError(t, err)
+	c, err := chain.Apply(events.Event{})
+	require.NoError(t, err)
+
+	assert.NotEqual(t, "jdoe", a["user"])
+	assert.Len(t, a["user"], 64)
+	assert.Equal(t, a["user"], b["user"])
+	assert.Equal(t, "", c["user"], "empty values should be left alone")
+}
+
+func TestElkSanitize(t *testing.T) {
+	chain := Chain{ElkSanitize()}
+
+	doc, err := chain.Apply(events.Event{Data: []string{"a", "b"}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"values": []interface{}{"a", "b"}}, doc["data"])
+
+	doc, err = chain.Apply(map[string]interface{}{
+		"data": nil,
+		"":     "empty",
+		"nested": []interface{}{
+			map[string]interface{}{"": 1},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{}, doc["data"])
+	assert.Equal(t, "empty", doc["AutoGenerated"])
+	assert.NotContains(t, doc, "")
+	assert.Equal(t, []interface{}{map[string]interface{}{"AutoGenerated": json.Number("1")}}, doc["nested"])
+}
+
+func TestFromID(t *testing.T) {
+	assert.Equal(t, "ITB", BuildingFromID("ITB-1101-CP1"))
+	assert.Equal(t, "ITB-1101", RoomFromID("ITB-1101-CP1"))
+	assert.Equal(t, "", RoomFromID("ITB-1101"))
+	assert.Equal(t, "", BuildingFromID("ITB"))
+}
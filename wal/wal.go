@@ -0,0 +1,432 @@
+// Package wal is an on-disk, segmented log of items a forwarder has buffered but not yet sent, so they can be replayed after a crash.
+package wal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Policies for what to do when the log reaches its max size
+const (
+	// DropOldest deletes the oldest segments to make room
+	DropOldest = "drop-oldest"
+
+	// DropNewest doesn't write new items until there is room
+	DropNewest = "drop-newest"
+)
+
+// Policies for when items are synced to disk
+const (
+	// SyncBatch syncs on each Checkpoint, when a forwarder hands off its buffer to be sent
+	SyncBatch = "batch"
+
+	// SyncAlways syncs after every Append
+	SyncAlways = "always"
+
+	// SyncInterval syncs on an interval until the log is closed
+	SyncInterval = "interval"
+)
+
+const (
+	segmentExt = ".wal"
+
+	// maxSegmentSize is the largest a single segment gets before a new one is started
+	maxSegmentSize = 64 * 1024 * 1024
+)
+
+// ErrFull is returned by Append when the log is full and its policy is DropNewest
+var ErrFull = errors.New("write ahead log is full")
+
+// Log is a write ahead log made up of segment files in a directory.
+// Items are appended to the current segment, Checkpoint closes it, and Ack deletes the checkpointed segments once their items have been sent.
+// Segments that are never acked stay on disk until they are replayed on the next start, or dropped to make room.
+type Log struct {
+	dir         string
+	maxSize     int64
+	segmentSize int64
+	policy      string
+
+	mu         sync.Mutex
+	syncPolicy string
+	stopSync   chan struct{}
+	cur        *os.File
+	curID      uint64
+	curSize    int64
+	size       int64
+	segments   []segment // closed segments that haven't been acked, oldest first
+	toReplay   []segment // segments that were on disk when the log was opened
+}
+
+type segment struct {
+	id           uint64
+	size         int64
+	checkpointed bool
+}
+
+// Marker is the set of segments returned by Checkpoint
+type Marker []uint64
+
+// Open opens the log in dir, creating it if it doesn't exist. Segments left from a previous run can be read with Replay.
+// A maxSize of 0 means the log can grow without limit.
+func Open(dir string, maxSize int64, policy string) (*Log, error) {
+	switch policy {
+	case "":
+		policy = DropOldest
+	case DropOldest, DropNewest:
+	default:
+		return nil, fmt.Errorf("unknown write ahead log policy %q", policy)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("couldn't create write ahead log directory %v: %w", dir, err)
+	}
+
+	l := &Log{
+		dir:         dir,
+		maxSize:     maxSize,
+		segmentSize: maxSegmentSize,
+		policy:      policy,
+		syncPolicy:  SyncBatch,
+	}
+
+	if maxSize > 0 && maxSize/8 < l.segmentSize {
+		l.segmentSize = maxSize / 8
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read write ahead log directory %v: %w", dir, err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), segmentExt) {
+			continue
+		}
+
+		id, err := strconv.ParseUint(strings.TrimSuffix(entry.Name(), segmentExt), 10, 64)
+		if err != nil {
+			slog.Warn("Ignoring unknown file in write ahead log directory", "dir", dir, "file", entry.Name())
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("couldn't stat write ahead log segment %v: %w", entry.Name(), err)
+		}
+
+		l.toReplay = append(l.toReplay, segment{id: id, size: info.Size()})
+		l.size += info.Size()
+		if id >= l.curID {
+			l.curID = id + 1
+		}
+	}
+
+	sort.Slice(l.toReplay, func(i, j int) bool { return l.toReplay[i].id < l.toReplay[j].id })
+	l.segments = append(l.segments, l.toReplay...)
+
+	if err := l.openSegment(); err != nil {
+		return nil, err
+	}
+
+	slog.Info("Opened write ahead log", "dir", dir, "segments", len(l.toReplay), "bytes", l.size)
+	return l, nil
+}
+
+// Replay calls fn with each item left from a previous run, in the order they were written.
+// Items are only replayed once, later calls do nothing. The replayed segments are included in the next Checkpoint.
+func (l *Log) Replay(fn func(item json.RawMessage) error) error {
+	l.mu.Lock()
+	toReplay := l.toReplay
+	l.toReplay = nil
+	l.mu.Unlock()
+
+	count := 0
+	for _, seg := range toReplay {
+		f, err := os.Open(l.segmentPath(seg.id))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return fmt.Errorf("couldn't open write ahead log segment: %w", err)
+		}
+
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), maxSegmentSize)
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			if len(line) == 0 || !json.Valid(line) {
+				// a partial write from a crash
+				continue
+			}
+
+			item := make(json.RawMessage, len(line))
+			copy(item, line)
+
+			if err := fn(item); err != nil {
+				f.Close()
+				return fmt.Errorf("couldn't replay item from %v: %w", l.segmentPath(seg.id), err)
+			}
+			count++
+		}
+
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("couldn't read write ahead log segment %v: %w", l.segmentPath(seg.id), err)
+		}
+	}
+
+	if count > 0 {
+		slog.Info("Replayed write ahead log", "dir", l.dir, "items", count)
+	}
+
+	return nil
+}
+
+// Append writes item to the log
+func (l *Log) Append(item interface{}) error {
+	b, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("couldn't marshal item for write ahead log: %w", err)
+	}
+	b = append(b, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.cur == nil {
+		return errors.New("write ahead log is closed")
+	}
+
+	if l.maxSize > 0 && l.size+int64(len(b)) > l.maxSize {
+		if l.policy == DropNewest {
+			return ErrFull
+		}
+
+		l.dropOldest(int64(len(b)))
+	}
+
+	if l.curSize > 0 && l.curSize+int64(len(b)) > l.segmentSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := l.cur.Write(b)
+	l.curSize += int64(n)
+	l.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("couldn't write to write ahead log: %w", err)
+	}
+
+	if l.syncPolicy == SyncAlways {
+		if err := l.cur.Sync(); err != nil {
+			return fmt.Errorf("couldn't sync write ahead log: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// SetSync sets when items are synced to disk, the default is SyncBatch. interval is only used by SyncInterval.
+// Segments are always synced when they're closed.
+func (l *Log) SetSync(policy string, interval time.Duration) error {
+	switch policy {
+	case "":
+		policy = SyncBatch
+	case SyncBatch, SyncAlways:
+	case SyncInterval:
+		if interval <= 0 {
+			return fmt.Errorf("write ahead log sync interval must be positive, got %v", interval)
+		}
+	default:
+		return fmt.Errorf("unknown write ahead log sync policy %q", policy)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.stopSync != nil {
+		close(l.stopSync)
+		l.stopSync = nil
+	}
+
+	l.syncPolicy = policy
+	if policy == SyncInterval && l.cur != nil {
+		l.stopSync = make(chan struct{})
+		go l.syncEvery(interval, l.stopSync)
+	}
+
+	return nil
+}
+
+// Sync flushes what's been written to the current segment to disk
+func (l *Log) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.cur == nil {
+		return nil
+	}
+
+	return l.cur.Sync()
+}
+
+func (l *Log) syncEvery(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := l.Sync(); err != nil {
+				slog.Warn("Couldn't sync write ahead log segment", "dir", l.dir, "error", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Checkpoint closes the current segment and returns the segments written since the last checkpoint.
+// Once the items buffered before the checkpoint have been sent, pass the marker to Ack.
+func (l *Log) Checkpoint() (Marker, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.cur == nil {
+		return nil, errors.New("write ahead log is closed")
+	}
+
+	if l.curSize > 0 {
+		if err := l.rotate(); err != nil {
+			return nil, err
+		}
+	}
+
+	var m Marker
+	for i := range l.segments {
+		if !l.segments[i].checkpointed {
+			l.segments[i].checkpointed = true
+			m = append(m, l.segments[i].id)
+		}
+	}
+
+	return m, nil
+}
+
+// Ack deletes the segments in m
+func (l *Log) Ack(m Marker) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	acked := make(map[uint64]bool, len(m))
+	for _, id := range m {
+		acked[id] = true
+	}
+
+	var errs []error
+	remaining := l.segments[:0]
+	for _, seg := range l.segments {
+		if !acked[seg.id] {
+			remaining = append(remaining, seg)
+			continue
+		}
+
+		if err := os.Remove(l.segmentPath(seg.id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+			remaining = append(remaining, seg)
+			continue
+		}
+		l.size -= seg.size
+	}
+	l.segments = remaining
+
+	return errors.Join(errs...)
+}
+
+// Close closes the current segment. Anything that hasn't been acked is replayed the next time the log is opened.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.cur == nil {
+		return nil
+	}
+
+	if l.stopSync != nil {
+		close(l.stopSync)
+		l.stopSync = nil
+	}
+
+	if err := l.cur.Sync(); err != nil {
+		slog.Warn("Couldn't sync write ahead log segment", "dir", l.dir, "error", err)
+	}
+
+	err := l.cur.Close()
+	l.cur = nil
+	return err
+}
+
+// Dir returns the directory the log is in
+func (l *Log) Dir() string {
+	return l.dir
+}
+
+func (l *Log) segmentPath(id uint64) string {
+	return filepath.Join(l.dir, fmt.Sprintf("%020d%s", id, segmentExt))
+}
+
+// openSegment starts a new segment, must hold l.mu
+func (l *Log) openSegment() error {
+	f, err := os.OpenFile(l.segmentPath(l.curID), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("couldn't create write ahead log segment: %w", err)
+	}
+
+	l.cur = f
+	l.curSize = 0
+	return nil
+}
+
+// rotate closes the current segment and starts a new one, must hold l.mu
+func (l *Log) rotate() error {
+	if err := l.cur.Sync(); err != nil {
+		slog.Warn("Couldn't sync write ahead log segment", "dir", l.dir, "error", err)
+	}
+
+	if err := l.cur.Close(); err != nil {
+		return fmt.Errorf("couldn't close write ahead log segment: %w", err)
+	}
+
+	l.segments = append(l.segments, segment{id: l.curID, size: l.curSize})
+	l.curID++
+
+	return l.openSegment()
+}
+
+// dropOldest deletes the oldest closed segments until need bytes fit, must hold l.mu
+func (l *Log) dropOldest(need int64) {
+	for len(l.segments) > 0 && l.size+need > l.maxSize {
+		oldest := l.segments[0]
+		l.segments = l.segments[1:]
+
+		if err := os.Remove(l.segmentPath(oldest.id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Error("Couldn't drop write ahead log segment", "dir", l.dir, "segment", oldest.id, "error", err)
+			continue
+		}
+
+		l.size -= oldest.size
+		slog.Warn("Write ahead log is full, dropped oldest segment", "dir", l.dir, "segment", oldest.id, "bytes", oldest.size)
+	}
+}
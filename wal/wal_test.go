@@ -0,0 +1,162 @@
+package wal
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type item struct {
+	ID int `json:"id"`
+}
+
+func replayAll(t *testing.T, l *Log) []int {
+	var ids []int
+	err := l.Replay(func(raw json.RawMessage) error {
+		var i item
+		if err := json.Unmarshal(raw, &i); err != nil {
+			return err
+		}
+
+		ids = append(ids, i.ID)
+		return nil
+	})
+	require.NoError(t, err)
+
+	return ids
+}
+
+func TestReplayAndAck(t *testing.T) {
+	dir := t.TempDir()
+
+	l, err := Open(dir, 0, "")
+	require.NoError(t, err)
+
+	require.NoError(t, l.Append(item{ID: 1}))
+	require.NoError(t, l.Append(item{ID: 2}))
+
+	// 1 and 2 are sent
+	m, err := l.Checkpoint()
+	require.NoError(t, err)
+	require.NoError(t, l.Ack(m))
+
+	// 3 is handed off but never acked, 4 is never checkpointed
+	require.NoError(t, l.Append(item{ID: 3}))
+	_, err = l.Checkpoint()
+	require.NoError(t, err)
+	require.NoError(t, l.Append(item{ID: 4}))
+	require.NoError(t, l.Close())
+
+	l, err = Open(dir, 0, "")
+	require.NoError(t, err)
+	defer l.Close()
+
+	assert.Equal(t, []int{3, 4}, replayAll(t, l))
+	assert.Empty(t, replayAll(t, l), "items should only be replayed once")
+
+	// the replayed items are included in the next checkpoint
+	m, err = l.Checkpoint()
+	require.NoError(t, err)
+	require.NoError(t, l.Ack(m))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "only the current segment should be left")
+}
+
+func TestPartialWrite(t *testing.T) {
+	dir := t.TempDir()
+
+	l, err := Open(dir, 0, "")
+	require.NoError(t, err)
+	require.NoError(t, l.Append(item{ID: 1}))
+
+	// simulate dying halfway through a write
+	_, err = l.cur.Write([]byte(`{"id":`))
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+
+	l, err = Open(dir, 0, "")
+	require.NoError(t, err)
+	defer l.Close()
+
+	assert.Equal(t, []int{1}, replayAll(t, l))
+}
+
+func TestFullPolicies(t *testing.T) {
+	// each item is 9 bytes ({"id":N}\n), so 4 fit in 40 bytes and a segment holds 5 bytes
+	t.Run(DropNewest, func(t *testing.T) {
+		dir := t.TempDir()
+
+		l, err := Open(dir, 40, DropNewest)
+		require.NoError(t, err)
+
+		for i := 1; i <= 4; i++ {
+			require.NoError(t, l.Append(item{ID: i}))
+		}
+		assert.ErrorIs(t, l.Append(item{ID: 5}), ErrFull)
+		require.NoError(t, l.Close())
+
+		l, err = Open(dir, 40, DropNewest)
+		require.NoError(t, err)
+		defer l.Close()
+
+		assert.Equal(t, []int{1, 2, 3, 4}, replayAll(t, l))
+	})
+
+	t.Run(DropOldest, func(t *testing.T) {
+		dir := t.TempDir()
+
+		l, err := Open(dir, 40, DropOldest)
+		require.NoError(t, err)
+
+		for i := 1; i <= 6; i++ {
+			require.NoError(t, l.Append(item{ID: i}))
+		}
+		require.NoError(t, l.Close())
+
+		l, err = Open(dir, 40, DropOldest)
+		require.NoError(t, err)
+		defer l.Close()
+
+		assert.Equal(t, []int{3, 4, 5, 6}, replayAll(t, l))
+	})
+
+	_, err := Open(t.TempDir(), 0, "drop-everything")
+	assert.Error(t, err)
+}
+
+func TestSetSync(t *testing.T) {
+	for _, policy := range []string{"", SyncBatch, SyncAlways, SyncInterval} {
+		t.Run(policy, func(t *testing.T) {
+			dir := t.TempDir()
+
+			l, err := Open(dir, 0, "")
+			require.NoError(t, err)
+			require.NoError(t, l.SetSync(policy, 10*time.Millisecond))
+
+			require.NoError(t, l.Append(item{ID: 1}))
+			time.Sleep(20 * time.Millisecond)
+			require.NoError(t, l.Sync())
+			require.NoError(t, l.Close())
+			assert.NoError(t, l.Sync(), "syncing a closed log does nothing")
+
+			l, err = Open(dir, 0, "")
+			require.NoError(t, err)
+			defer l.Close()
+
+			assert.Equal(t, []int{1}, replayAll(t, l))
+		})
+	}
+
+	l, err := Open(t.TempDir(), 0, "")
+	require.NoError(t, err)
+	defer l.Close()
+
+	assert.Error(t, l.SetSync("never", 0))
+	assert.Error(t, l.SetSync(SyncInterval, 0))
+}